@@ -1,9 +1,21 @@
 package api
 
-import "github.com/gin-gonic/gin"
-
-// StartServerDetached start the http rest API.
-func StartServerDetached() {
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/vivijj/ziongo/core"
+	"github.com/vivijj/ziongo/types/token"
+	"github.com/vivijj/ziongo/types/transaction"
+)
+
+// StartServerDetached start the http rest API, the tokens are shown from the
+// registry and the txs are submitted to the mempool.
+func StartServerDetached(tokens *token.Registry, mempool *core.MempoolState) {
 	router := gin.Default()
 	v1 := router.Group("/api/v1")
 
@@ -12,7 +24,7 @@ func StartServerDetached() {
 	v1Acc.GET("/:address/transactions", accountTxs)
 
 	v1Txs := v1.Group("/transactions")
-	v1Txs.POST("", submitTxs)
+	v1Txs.POST("", submitTxs(mempool))
 	v1Txs.GET("/:txHash", txStatus)
 	v1Txs.GET("/:txHash/data", txData)
 
@@ -21,6 +33,31 @@ func StartServerDetached() {
 	v1Blk.GET("/:blockNumber", blockById)
 	v1Blk.GET("/:blockNumber/transactions", blockTransactions)
 
+	v1Tok := v1.Group("/tokens")
+	v1Tok.GET("", tokenList(tokens))
+	v1Tok.GET("/:tokenId", tokenInfo(tokens))
+}
+
+func tokenList(tokens *token.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, tokens.Tokens())
+	}
+}
+
+func tokenInfo(tokens *token.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("tokenId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "token id is not a number"})
+			return
+		}
+		t, ok := tokens.Get(id)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": token.ErrTokenNotFound.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, t)
+	}
 }
 
 func blockTransactions(context *gin.Context) {
@@ -51,12 +88,33 @@ func txStatus(c *gin.Context) {
 	)
 }
 
-func submitTxs(c *gin.Context) {
-	c.JSON(
-		500, gin.H{
-			"submit_tx": 1,
-		},
-	)
+// submitTxs adds the tx of the body, in its JSON form with its type, to the
+// mempool. A rejected tx is answered with the reason, and the index of the
+// rejected tx for a batch.
+func submitTxs(mempool *core.MempoolState) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var tx transaction.TypedZionTx
+		if err := json.Unmarshal(body, &tx); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		hash, err := mempool.AddTx(tx.Value)
+		var txErr *core.TxError
+		if errors.As(err, &txErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": txErr.Err.Error(), "index": txErr.Index})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tx_hash": hash.Hex()})
+	}
 }
 
 func accountTxs(c *gin.Context) {
@@ -0,0 +1,38 @@
+package core
+
+import "fmt"
+
+type MempoolError struct{ msg string }
+
+func (err MempoolError) Error() string {
+	return err.msg
+}
+
+var (
+	ErrNonceTooLow   = &MempoolError{"nonce is lower than the account nonce"}
+	ErrNonceQueued   = &MempoolError{"a tx with the same nonce is already queued"}
+	ErrNoInitiator   = &MempoolError{"tx has no initiator account"}
+	ErrInvalidNonces = &MempoolError{"nonces of the initiator in the batch are not consecutive"}
+	ErrTxExpired     = &MempoolError{"tx is expired"}
+	ErrMempoolFull   = &MempoolError{"mempool is full of txs paying higher fees"}
+	ErrAccountFull   = &MempoolError{"too many txs of the account are queued"}
+	ErrFeeBumpTooLow = &MempoolError{"fee is not enough higher than the fee of the replaced tx"}
+)
+
+// TxError is the reason why the mempool rejects a tx, Index is the index of the
+// rejected tx in a batch, or -1 when the whole tx is rejected.
+type TxError struct {
+	Index int
+	Err   error
+}
+
+func (err *TxError) Error() string {
+	if err.Index < 0 {
+		return err.Err.Error()
+	}
+	return fmt.Sprintf("tx %d of the batch: %v", err.Index, err.Err)
+}
+
+func (err *TxError) Unwrap() error {
+	return err.Err
+}
@@ -0,0 +1,234 @@
+// Package fee computes the fees required by the txs, from the L1 cost of their
+// pubdata and the cost of proving their chunks.
+package fee
+
+import (
+	"math/big"
+
+	"github.com/vivijj/ziongo/types/account"
+	"github.com/vivijj/ziongo/types/operation"
+	"github.com/vivijj/ziongo/types/token"
+	"github.com/vivijj/ziongo/types/transaction"
+	"github.com/vivijj/ziongo/utils/floatencode"
+)
+
+type FeeError struct{ msg string }
+
+func (err FeeError) Error() string {
+	return err.msg
+}
+
+var (
+	ErrFeeTooLow       = &FeeError{"fee is lower than the required fee"}
+	ErrUnknownPrice    = &FeeError{"token price is unknown"}
+	ErrUnknownFeeToken = &FeeError{"fee token is not registered"}
+	ErrUnknownTxType   = &FeeError{"tx type has no fee"}
+)
+
+// EthSymbol is the symbol of the token the L1 gas is paid in.
+const EthSymbol = "ETH"
+
+var weiPerEth = new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+
+// Config is the cost model of the fees.
+type Config struct {
+	// GasPrice is the L1 gas price in wei.
+	GasPrice *big.Int
+	// GasPerPubdataByte is the L1 gas of a byte of pubdata, 16 for the calldata.
+	GasPerPubdataByte uint64
+	// WithdrawGas is the L1 gas spent by the contract to process a withdrawal.
+	WithdrawGas uint64
+	// ProverCostPerChunk is the cost in USD of proving a chunk.
+	ProverCostPerChunk *big.Rat
+}
+
+// DefaultConfig returns the cost model with the calldata gas cost of the pubdata.
+func DefaultConfig() Config {
+	return Config{
+		GasPrice:           big.NewInt(20_000_000_000),
+		GasPerPubdataByte:  16,
+		WithdrawGas:        10_000,
+		ProverCostPerChunk: big.NewRat(1, 1000),
+	}
+}
+
+// Engine computes the fees of the txs in their fee token.
+type Engine struct {
+	cfg    Config
+	tokens *token.Registry
+	prices PriceSource
+}
+
+func NewEngine(cfg Config, tokens *token.Registry, prices PriceSource) *Engine {
+	return &Engine{cfg: cfg, tokens: tokens, prices: prices}
+}
+
+// txCost returns the number of chunks of the operation of the tx and its number
+// of withdrawals processed on L1.  A transfer is charged as a transfer to a new
+// account, since the recipient may not exist when the tx is executed.
+func txCost(tx transaction.ZionTx) (chunks int, withdrawals uint64, err error) {
+	switch t := tx.(type) {
+	case transaction.TransferTx:
+		if account.IsNFT(t.Token) {
+			return operation.TransferNFTOpChunks, 0, nil
+		}
+		return operation.TransferToNewOpChunks, 0, nil
+	case transaction.WithdrawTx:
+		if account.IsNFT(t.Token) {
+			return operation.WithdrawNFTOpChunks, 1, nil
+		}
+		return operation.WithdrawOpChunks, 1, nil
+	case transaction.ForcedExitTx:
+		return operation.ForcedExitOpChunks, 1, nil
+	case transaction.PubkeyUpdateTx:
+		return operation.PubkeyUpdateOpChunks, 0, nil
+	case transaction.SwapTx:
+		return operation.SwapOpChunks, 0, nil
+	case transaction.MintNFTTx:
+		return operation.MintNFTOpChunks, 0, nil
+	}
+	return 0, 0, ErrUnknownTxType
+}
+
+// CostUSD returns the cost of the tx in USD: the L1 gas of its pubdata and of its
+// withdrawal if any, and the proving of its chunks.  The cost of a batch is the
+// sum of the costs of its txs.
+func (e *Engine) CostUSD(tx transaction.ZionTx) (*big.Rat, error) {
+	if batch, ok := tx.(transaction.BatchTx); ok {
+		total := new(big.Rat)
+		for _, inner := range batch.Txs {
+			cost, err := e.CostUSD(inner)
+			if err != nil {
+				return nil, err
+			}
+			total.Add(total, cost)
+		}
+		return total, nil
+	}
+
+	chunks, withdrawals, err := txCost(tx)
+	if err != nil {
+		return nil, err
+	}
+	gas := uint64(chunks*operation.ChunkBytes)*e.cfg.GasPerPubdataByte + withdrawals*e.cfg.WithdrawGas
+	ethPrice, err := e.prices.Price(EthSymbol)
+	if err != nil {
+		return nil, err
+	}
+	gasWei := new(big.Int).Mul(new(big.Int).SetUint64(gas), e.cfg.GasPrice)
+	cost := new(big.Rat).SetInt(gasWei)
+	cost.Quo(cost, weiPerEth).Mul(cost, ethPrice)
+
+	proverCost := new(big.Rat).Mul(e.cfg.ProverCostPerChunk, big.NewRat(int64(chunks), 1))
+	return cost.Add(cost, proverCost), nil
+}
+
+// tokenUnitPrice returns the price in USD of the smallest unit of the token.
+func (e *Engine) tokenUnitPrice(tokenId int) (*big.Rat, error) {
+	t, ok := e.tokens.Get(tokenId)
+	if !ok {
+		return nil, ErrUnknownFeeToken
+	}
+	price, err := e.prices.Price(t.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(t.Decimals)), nil)
+	return new(big.Rat).Quo(price, new(big.Rat).SetInt(unit)), nil
+}
+
+// RequiredFee returns the fee of the tx in the fee token, rounded up to a fee
+// packable in the pubdata.
+func (e *Engine) RequiredFee(tx transaction.ZionTx, feeToken int) (*big.Int, error) {
+	cost, err := e.CostUSD(tx)
+	if err != nil {
+		return nil, err
+	}
+	unitPrice, err := e.tokenUnitPrice(feeToken)
+	if err != nil {
+		return nil, err
+	}
+	units := new(big.Rat).Quo(cost, unitPrice)
+	// ceil of the number of units.
+	fee := new(big.Int).Add(units.Num(), new(big.Int).Sub(units.Denom(), big.NewInt(1)))
+	fee.Quo(fee, units.Denom())
+	return floatencode.RoundUpToFloatValue(fee, operation.FeeFloatEncoding)
+}
+
+// paidFee returns the fee paid by the tx and its fee token.
+func paidFee(tx transaction.ZionTx) (*big.Int, int, error) {
+	switch t := tx.(type) {
+	case transaction.TransferTx:
+		return t.Fee, t.FeeToken, nil
+	case transaction.WithdrawTx:
+		return t.Fee, t.FeeToken, nil
+	case transaction.ForcedExitTx:
+		return t.Fee, t.FeeToken, nil
+	case transaction.PubkeyUpdateTx:
+		return t.Fee, t.FeeToken, nil
+	case transaction.SwapTx:
+		return t.Fee, t.FeeToken, nil
+	case transaction.MintNFTTx:
+		return t.Fee, t.FeeToken, nil
+	}
+	return nil, 0, ErrUnknownTxType
+}
+
+// CheckFee checks that the tx pays at least its required fee.  The txs of a batch
+// may pay the fees of each other, so the batch is checked on the total value of
+// its fees against its total cost.
+func (e *Engine) CheckFee(tx transaction.ZionTx) error {
+	batch, ok := tx.(transaction.BatchTx)
+	if !ok {
+		fee, feeToken, err := paidFee(tx)
+		if err != nil {
+			return err
+		}
+		required, err := e.RequiredFee(tx, feeToken)
+		if err != nil {
+			return err
+		}
+		if fee == nil || fee.Cmp(required) < 0 {
+			return ErrFeeTooLow
+		}
+		return nil
+	}
+
+	paid, err := e.PaidUSD(batch)
+	if err != nil {
+		return err
+	}
+	cost, err := e.CostUSD(batch)
+	if err != nil {
+		return err
+	}
+	if paid.Cmp(cost) < 0 {
+		return ErrFeeTooLow
+	}
+	return nil
+}
+
+// PaidUSD returns the value in USD of the fees paid by the tx, or by every tx of a
+// batch.
+func (e *Engine) PaidUSD(tx transaction.ZionTx) (*big.Rat, error) {
+	txs := []transaction.ZionTx{tx}
+	if batch, ok := tx.(transaction.BatchTx); ok {
+		txs = batch.Txs
+	}
+	paid := new(big.Rat)
+	for _, inner := range txs {
+		fee, feeToken, err := paidFee(inner)
+		if err != nil {
+			return nil, err
+		}
+		if fee == nil || fee.Sign() == 0 {
+			continue
+		}
+		unitPrice, err := e.tokenUnitPrice(feeToken)
+		if err != nil {
+			return nil, err
+		}
+		paid.Add(paid, new(big.Rat).Mul(new(big.Rat).SetInt(fee), unitPrice))
+	}
+	return paid, nil
+}
@@ -0,0 +1,107 @@
+package fee
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vivijj/ziongo/types/token"
+	"github.com/vivijj/ziongo/types/transaction"
+)
+
+func newTestEngine(t *testing.T) *Engine {
+	tokens, err := token.NewRegistry(
+		token.Token{Id: 0, Symbol: "ETH", Decimals: 18, FeeEligible: true},
+		token.Token{Id: 1, Address: common.HexToAddress("0x01"), Symbol: "USDC", Decimals: 6, FeeEligible: true},
+		token.Token{Id: 2, Address: common.HexToAddress("0x02"), Symbol: "ZN", Decimals: 18},
+	)
+	require.NoError(t, err)
+	prices := StaticPrices{"ETH": big.NewRat(2000, 1), "USDC": big.NewRat(1, 1)}
+	cfg := Config{
+		GasPrice:           big.NewInt(10_000_000_000),
+		GasPerPubdataByte:  16,
+		WithdrawGas:        10_000,
+		ProverCostPerChunk: big.NewRat(1, 1000),
+	}
+	return NewEngine(cfg, tokens, prices)
+}
+
+func transfer(feeToken int, fee int64) transaction.TransferTx {
+	return transaction.TransferTx{FeeToken: feeToken, Fee: big.NewInt(fee), Token: 0, Amount: big.NewInt(1)}
+}
+
+func TestRequiredFee(t *testing.T) {
+	e := newTestEngine(t)
+
+	// 5 chunks: 800 gas at 10 gwei for 2000 USD/ETH, and 0.005 USD of proving.
+	cost, err := e.CostUSD(transfer(1, 0))
+	require.NoError(t, err)
+	assert.Equal(t, big.NewRat(21, 1000), cost)
+
+	fee, err := e.RequiredFee(transfer(1, 0), 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(21000), fee.Int64())
+	fee, err = e.RequiredFee(transfer(0, 0), 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10_500_000_000_000), fee.Int64())
+
+	// 6 chunks and a withdrawal: 0.2252 USD, rounded up to a packable fee.
+	withdraw := transaction.WithdrawTx{FeeToken: 1, Fee: big.NewInt(0), Token: 0, Amount: big.NewInt(1)}
+	fee, err = e.RequiredFee(withdraw, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(226000), fee.Int64())
+
+	_, err = e.RequiredFee(transfer(3, 0), 3)
+	assert.Equal(t, ErrUnknownFeeToken, err)
+	_, err = e.RequiredFee(transfer(2, 0), 2)
+	assert.Equal(t, ErrUnknownPrice, err)
+}
+
+func TestCheckFee(t *testing.T) {
+	e := newTestEngine(t)
+
+	assert.NoError(t, e.CheckFee(transfer(1, 21000)))
+	assert.Equal(t, ErrFeeTooLow, e.CheckFee(transfer(1, 20900)))
+
+	// a tx of the batch pays the fees of both.
+	batch := transaction.BatchTx{Txs: []transaction.ZionTx{transfer(1, 0), transfer(1, 42000)}}
+	assert.NoError(t, e.CheckFee(batch))
+	batch.Txs[1] = transfer(1, 41999)
+	assert.Equal(t, ErrFeeTooLow, e.CheckFee(batch))
+	batch.Txs[1] = transfer(0, 21_000_000_000_000)
+	assert.NoError(t, e.CheckFee(batch))
+}
+
+func TestPaidUSD(t *testing.T) {
+	e := newTestEngine(t)
+
+	paid, err := e.PaidUSD(transfer(1, 21000))
+	require.NoError(t, err)
+	assert.Equal(t, big.NewRat(21, 1000), paid)
+
+	batch := transaction.BatchTx{Txs: []transaction.ZionTx{transfer(1, 21000), transfer(0, 1_000_000_000_000_000)}}
+	paid, err = e.PaidUSD(batch)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewRat(2021, 1000), paid)
+}
+
+func TestLoadStaticPrices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"ETH": "3000.5", "USDC": "1"}`), 0o600))
+	prices, err := LoadStaticPrices(path)
+	require.NoError(t, err)
+	price, err := prices.Price("ETH")
+	require.NoError(t, err)
+	assert.Equal(t, big.NewRat(6001, 2), price)
+	_, err = prices.Price("DAI")
+	assert.Equal(t, ErrUnknownPrice, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"ETH": "-1"}`), 0o600))
+	_, err = LoadStaticPrices(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package fee
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+)
+
+// PriceSource gives the prices of the tokens, e.g. from an exchange or an oracle.
+type PriceSource interface {
+	// Price returns the price in USD of one whole token of the symbol, which is
+	// positive.
+	Price(symbol string) (*big.Rat, error)
+}
+
+// StaticPrices is a PriceSource of fixed prices by token symbol, for the nodes
+// without access to a price feed.
+type StaticPrices map[string]*big.Rat
+
+// Price implements the PriceSource interface.
+func (p StaticPrices) Price(symbol string) (*big.Rat, error) {
+	price, ok := p[symbol]
+	if !ok || price.Sign() <= 0 {
+		return nil, ErrUnknownPrice
+	}
+	return price, nil
+}
+
+// LoadStaticPrices returns the prices of the JSON file, an object of the decimal
+// price strings by token symbol, e.g. {"ETH": "3000.5", "USDC": "1"}.
+func LoadStaticPrices(path string) (StaticPrices, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var prices map[string]string
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return nil, err
+	}
+	p := make(StaticPrices, len(prices))
+	for symbol, s := range prices {
+		price, ok := new(big.Rat).SetString(s)
+		if !ok || price.Sign() <= 0 {
+			return nil, &FeeError{"price of " + symbol + " is not a positive decimal"}
+		}
+		p[symbol] = price
+	}
+	return p, nil
+}
@@ -1,58 +1,488 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 
+	"github.com/vivijj/ziongo/core/fee"
+	"github.com/vivijj/ziongo/core/state"
+	"github.com/vivijj/ziongo/types/account"
 	"github.com/vivijj/ziongo/types/block"
+	"github.com/vivijj/ziongo/types/token"
 	"github.com/vivijj/ziongo/types/transaction"
 	"github.com/vivijj/ziongo/utils/deque"
 )
 
+// StateView is the committed state read by the mempool, like a state.View.
+type StateView interface {
+	// GetAccount returns a copy of the account of the id, or nil if it doesn't
+	// exist.
+	GetAccount(id int) *account.Account
+	GetNFT(tokenId int) (account.NFT, bool)
+	// AuthDomain returns the domain of the signatures of the txs.
+	AuthDomain() transaction.AuthDomain
+}
+
+// MempoolConfig is the capacity of the mempool, and the fee bump of the
+// replacements.
+type MempoolConfig struct {
+	// MaxTxs is the max number of txs in the mempool, a batch counts for its txs.
+	MaxTxs int
+	// MaxAccountTxs is the max number of txs queued for an account.
+	MaxAccountTxs int
+	// FeeBumpPercent is how much the fee of a tx must exceed, in percent, the fee
+	// of the queued tx of the same nonce to replace it.
+	FeeBumpPercent int
+}
+
+// DefaultMempoolConfig returns a capacity of 100000 txs, and 128 txs of an
+// account, with replacements paying 10% more.
+func DefaultMempoolConfig() MempoolConfig {
+	return MempoolConfig{
+		MaxTxs:         100_000,
+		MaxAccountTxs:  128,
+		FeeBumpPercent: 10,
+	}
+}
+
+// MempoolState keeps the txs of every account in a queue sorted by nonce. The
+// txs following the committed nonce of the account are ready to be proposed,
+// the others are pending until the missing nonces are filled or executed. When
+// the mempool is full, the queued txs paying the lowest fees are evicted for the
+// new ones.
 type MempoolState struct {
-	TxsQueue    *deque.Deque[transaction.ZionTx]
+	mu       sync.Mutex
+	accounts map[int]*accountQueue
+	// size is the number of txs queued, a batch counts for its txs.
+	size int
+	// proposed are the txs and the priority txs of the proposed blocks, removed
+	// from the store once their block is executed.
+	proposed       []common.Hash
+	proposedPriTxs []transaction.PriorityTx
+	// order is the order of the accounts in the proposed blocks, the accounts
+	// whose txs are proposed move to the end.
+	order []int
+	// spenders are the queued and proposed txs by hash, for every account they
+	// spend from, until their block is executed.
+	spenders map[int]map[common.Hash]transaction.ZionTx
+
 	PriTxsQueue *deque.Deque[transaction.ZionPriTx]
+	// State is the committed state, for the nonces of the accounts.
+	State StateView
+	// Tokens is the registry of the tokens accepted by the txs.
+	Tokens *token.Registry
+	// Fees computes the fees required by the txs.
+	Fees   *fee.Engine
+	Config MempoolConfig
+	// Store persists the txs of the mempool, if it's set.
+	Store MempoolStore
+
+	// now returns the current time, the txs valid until an earlier time are
+	// rejected.
+	now func() int
 }
 
-func NewMempool() *MempoolState {
+func NewMempool(view StateView, tokens *token.Registry, fees *fee.Engine, cfg MempoolConfig) *MempoolState {
 	return &MempoolState{
-		TxsQueue:    deque.New[transaction.ZionTx](),
+		accounts:    make(map[int]*accountQueue),
+		spenders:    make(map[int]map[common.Hash]transaction.ZionTx),
 		PriTxsQueue: deque.New[transaction.ZionPriTx](),
+		State:       view,
+		Tokens:      tokens,
+		Fees:        fees,
+		Config:      cfg,
+		now:         func() int { return int(time.Now().Unix()) },
+	}
+}
+
+// AddTx adds the tx to the queue of its initiator account. The tx is rejected
+// with a *TxError if it could not be executed on the committed state after the
+// queued txs: because of its tokens, amounts, signature, nonce, balances or
+// expiry, or if its fee is lower than the required fee. A BatchTx is kept as a
+// single element of the queue, so its txs stay contiguous in the proposed block.
+//
+// A tx of the same nonces as a queued tx replaces it if its fee is higher by
+// Config.FeeBumpPercent. The tx is rejected too if its account has too many
+// queued txs, or if the mempool is full of txs paying higher fees.
+//
+// The tx is stored before it's queued, an error of the Store is returned as is.
+func (ms *MempoolState) AddTx(tx transaction.ZionTx) (common.Hash, error) {
+	qt, err := ms.prepareTx(tx)
+	if err != nil {
+		return common.Hash{}, err
 	}
+	// the signatures are checked without the lock, so only the nonces and the
+	// balances are checked with it.
+	sigs := ms.collectSigChecks(qt)
+	runSigChecks(sigs)
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.queueTx(context.TODO(), qt, ms.Store != nil, sigs)
 }
 
-func (ms *MempoolState) AddTx(tx transaction.ZionTx) common.Hash {
-	ms.TxsQueue.PushBack(tx)
-	return transaction.ZionTxHash(tx)
+// prepareTx checks the tx without the state, and returns it ready to be queued.
+func (ms *MempoolState) prepareTx(tx transaction.ZionTx) (queuedTx, error) {
+	if err := ms.checkTx(tx); err != nil {
+		return queuedTx{}, &TxError{Index: -1, Err: err}
+	}
+	qt, err := newQueuedTx(tx)
+	if err != nil {
+		return queuedTx{}, &TxError{Index: -1, Err: err}
+	}
+	if qt.fee, err = ms.Fees.PaidUSD(tx); err != nil {
+		return queuedTx{}, &TxError{Index: -1, Err: err}
+	}
+	return qt, nil
 }
 
-func (ms MempoolState) AddPriorityTx(tx transaction.PriorityTx) common.Hash {
+// queueTx checks the tx against the state and queues it like AddTx, the tx is
+// stored if persist is set. The signatures are checked by sigs, see validateTx.
+func (ms *MempoolState) queueTx(ctx context.Context, qt queuedTx, persist bool, sigs []sigCheck) (common.Hash, error) {
+	tx := qt.tx
+	q, ok := ms.accounts[qt.accountId]
+	replaced := ms.replacedBy(qt)
+	if replaced != nil && !ms.feeBumped(*replaced, qt) {
+		return common.Hash{}, &TxError{Index: -1, Err: ErrFeeBumpTooLow}
+	}
+	if err := ms.validateTx(tx, replaced, sigs); err != nil {
+		return common.Hash{}, err
+	}
+	if !ok {
+		q = newAccountQueue(ms.State.GetAccount(qt.accountId).Nonce)
+	}
+
+	need := qt.size
+	if replaced != nil {
+		need -= replaced.size
+	} else if err := q.check(qt); err != nil {
+		return common.Hash{}, &TxError{Index: -1, Err: err}
+	}
+	if q.size+need > ms.Config.MaxAccountTxs {
+		return common.Hash{}, &TxError{Index: -1, Err: ErrAccountFull}
+	}
+	evicted, err := ms.evict(qt, need)
+	if err != nil {
+		return common.Hash{}, &TxError{Index: -1, Err: err}
+	}
+	if persist {
+		if err := ms.Store.StoreTx(ctx, qt.hash, tx); err != nil {
+			ms.unevict(evicted)
+			return common.Hash{}, err
+		}
+	}
+
+	if replaced != nil {
+		q.replace(qt)
+		ms.untrack(*replaced)
+	} else if err := q.add(qt); err != nil {
+		return common.Hash{}, &TxError{Index: -1, Err: err}
+	}
+	ms.track(qt)
+	ms.size += need
+	if !ok {
+		ms.accounts[qt.accountId] = q
+		ms.order = append(ms.order, qt.accountId)
+	}
+
+	if ms.Store != nil {
+		removed := make([]common.Hash, 0, len(evicted)+1)
+		for _, e := range evicted {
+			removed = append(removed, e.qt.hash)
+		}
+		if replaced != nil {
+			removed = append(removed, replaced.hash)
+		}
+		// a tx left in the store is checked again when it's restored, so the
+		// error is only logged.
+		if err := ms.removeTxs(ctx, removed); err != nil {
+			log.Printf("can't remove the evicted txs from the mempool store: %v", err)
+		}
+	}
+	return qt.hash, nil
+}
+
+// replacedBy returns the queued tx of the same nonces as qt, which qt replaces, or
+// nil.
+func (ms *MempoolState) replacedBy(qt queuedTx) *queuedTx {
+	q, ok := ms.accounts[qt.accountId]
+	if !ok {
+		return nil
+	}
+	if old, found := q.find(qt.nonce); found && old.nextNonce == qt.nextNonce {
+		return &old
+	}
+	return nil
+}
+
+// track records the tx qt as a spender of the accounts it spends from.
+func (ms *MempoolState) track(qt queuedTx) {
+	txSpending(qt.tx, func(accountId int, _ int, _ *big.Int) {
+		txs, ok := ms.spenders[accountId]
+		if !ok {
+			txs = make(map[common.Hash]transaction.ZionTx)
+			ms.spenders[accountId] = txs
+		}
+		txs[qt.hash] = qt.tx
+	})
+}
+
+// untrack removes the tx qt from the spenders of the accounts it spends from.
+func (ms *MempoolState) untrack(qt queuedTx) {
+	txSpending(qt.tx, func(accountId int, _ int, _ *big.Int) {
+		delete(ms.spenders[accountId], qt.hash)
+		if len(ms.spenders[accountId]) == 0 {
+			delete(ms.spenders, accountId)
+		}
+	})
+}
+
+// removeTxs removes the txs of the hashes from the store.
+func (ms *MempoolState) removeTxs(ctx context.Context, hashes []common.Hash) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	return ms.Store.RemoveTxs(ctx, hashes)
+}
+
+// feeBumped reports whether the fee of the tx is enough to replace the old tx.
+func (ms *MempoolState) feeBumped(old queuedTx, qt queuedTx) bool {
+	bumped := new(big.Rat).Mul(old.fee, big.NewRat(int64(100+ms.Config.FeeBumpPercent), 100))
+	return qt.fee.Cmp(old.fee) > 0 && qt.fee.Cmp(bumped) >= 0
+}
+
+// eviction is a tx evicted from the queue q.
+type eviction struct {
+	q  *accountQueue
+	qt queuedTx
+}
+
+// evict makes room for need more txs in the mempool by evicting the queued txs
+// paying a lower fee rate than the tx qt, and returns them. The last tx of an
+// account is evicted first, so its other txs keep their order, and the txs of the
+// account of qt are kept. If there is not enough room, nothing is evicted.
+func (ms *MempoolState) evict(qt queuedTx, need int) ([]eviction, error) {
+	var evicted []eviction
+	for ms.size+need > ms.Config.MaxTxs {
+		var victim eviction
+		for _, id := range ms.order {
+			q := ms.accounts[id]
+			if id == qt.accountId || q.len() == 0 {
+				continue
+			}
+			last := q.last()
+			if victim.q == nil || last.feeRate().Cmp(victim.qt.feeRate()) < 0 {
+				victim = eviction{q, last}
+			}
+		}
+		if victim.q == nil || victim.qt.feeRate().Cmp(qt.feeRate()) >= 0 {
+			ms.unevict(evicted)
+			return nil, ErrMempoolFull
+		}
+		victim.q.removeLast()
+		ms.untrack(victim.qt)
+		ms.size -= victim.qt.size
+		evicted = append(evicted, victim)
+	}
+	return evicted, nil
+}
+
+// unevict queues the evicted txs again.
+func (ms *MempoolState) unevict(evicted []eviction) {
+	for i := len(evicted) - 1; i >= 0; i-- {
+		_ = evicted[i].q.add(evicted[i].qt)
+		ms.track(evicted[i].qt)
+		ms.size += evicted[i].qt.size
+	}
+}
+
+// checkTx checks the tx without the state: its tokens, its packed amounts and its
+// fee.
+func (ms *MempoolState) checkTx(tx transaction.ZionTx) error {
+	if batch, ok := tx.(transaction.BatchTx); ok && batch.Validate() != nil {
+		return state.ErrInvalidBatch
+	}
+	if err := state.CheckTokens(ms.Tokens, tx); err != nil {
+		return err
+	}
+	if err := state.CheckPackable(tx); err != nil {
+		return err
+	}
+	return ms.Fees.CheckFee(tx)
+}
+
+// AddPriorityTx queues the priority tx after the others, and returns its hash.
+// The priority txs are added in the order of their L1 blocks and indexes.
+func (ms *MempoolState) AddPriorityTx(tx transaction.PriorityTx) (common.Hash, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.Store != nil {
+		if err := ms.Store.StorePriorityTx(context.TODO(), tx); err != nil {
+			return common.Hash{}, err
+		}
+	}
 	ms.PriTxsQueue.PushBack(tx)
-	return common.Hash{}
+	return transaction.PriTxHash(tx), nil
+}
+
+// ReadyTxs returns the ready txs of the account, by nonce.
+func (ms *MempoolState) ReadyTxs(accountId int) []transaction.ZionTx {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	q, ok := ms.accounts[accountId]
+	if !ok {
+		return nil
+	}
+	txs := make([]transaction.ZionTx, len(q.ready))
+	for i, qt := range q.ready {
+		txs[i] = qt.tx
+	}
+	return txs
+}
+
+// PendingTxs returns the pending txs of the account, by nonce.
+func (ms *MempoolState) PendingTxs(accountId int) []transaction.ZionTx {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	q, ok := ms.accounts[accountId]
+	if !ok {
+		return nil
+	}
+	txs := make([]transaction.ZionTx, 0, len(q.pending))
+	for _, qt := range q.txs()[len(q.ready):] {
+		txs = append(txs, qt.tx)
+	}
+	return txs
 }
 
-func (ms *MempoolState) ProposeNewBlock() block.ProposedBlock {
+// ProposeNewBlock removes the priority txs and at most maxTxs ready txs from the
+// mempool, maxTxs is unlimited when it's not positive. The ready txs are taken one
+// account at a time, so every account gets its turn, and the txs of an account
+// stay in the order of their nonces.
+func (ms *MempoolState) ProposeNewBlock(maxTxs int) block.ProposedBlock {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
 	numPriTxs := ms.PriTxsQueue.Len()
 	priTxs := make([]transaction.ZionPriTx, 0, numPriTxs)
 	for i := 0; i < numPriTxs; i++ {
 		t := ms.PriTxsQueue.PopFront()
 		priTxs = append(priTxs, t)
+		if priTx, ok := t.(transaction.PriorityTx); ok {
+			ms.proposedPriTxs = append(ms.proposedPriTxs, priTx)
+		}
 	}
 
-	numTxs := ms.TxsQueue.Len()
-	txs := make([]transaction.ZionTx, 0, numTxs)
-	for i := 0; i < numTxs; i++ {
-		t := ms.TxsQueue.PopFront()
-		txs = append(txs, t)
+	var txs []transaction.ZionTx
+	left := maxTxs
+	served := make(map[int]bool)
+	for more := true; more; {
+		more = false
+		for _, id := range ms.order {
+			q := ms.accounts[id]
+			if len(q.ready) == 0 {
+				continue
+			}
+			n := q.ready[0].size
+			if maxTxs > 0 && n > left {
+				continue
+			}
+			qt := q.popReady()
+			txs = append(txs, qt.tx)
+			ms.proposed = append(ms.proposed, qt.hash)
+			ms.size -= n
+			served[id] = true
+			left -= n
+			more = true
+		}
 	}
 
+	order := make([]int, 0, len(ms.order))
+	for _, id := range ms.order {
+		if !served[id] {
+			order = append(order, id)
+		}
+	}
+	for _, id := range ms.order {
+		if served[id] {
+			order = append(order, id)
+		}
+	}
+	ms.order = order
+
 	return block.ProposedBlock{
 		Txs:    txs,
 		PriTxs: priTxs,
 	}
 }
 
+// BlockExecuted queues the txs again from the nonces of the committed state,
+// once a block is executed: the txs of the used nonces are dropped, and the
+// pending txs following the new nonces become ready. The txs of a proposed block
+// which were not executed are dropped too. The proposed and the dropped txs are
+// removed from the store, after the tokens of the executed NewToken priority txs
+// are stored, so they are still registered after a restart.
+func (ms *MempoolState) BlockExecuted() error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	removed := ms.proposed
+	order := ms.order[:0]
+	ms.size = 0
+	// the proposed txs are executed, so only the queued txs spend from the
+	// committed balances.
+	ms.spenders = make(map[int]map[common.Hash]transaction.ZionTx)
+	for _, id := range ms.order {
+		q := ms.accounts[id]
+		if acc := ms.State.GetAccount(id); acc != nil {
+			for _, qt := range q.reset(acc.Nonce) {
+				removed = append(removed, qt.hash)
+			}
+		}
+		ms.size += q.size
+		if q.len() == 0 {
+			delete(ms.accounts, id)
+			continue
+		}
+		for _, qt := range q.txs() {
+			ms.track(qt)
+		}
+		order = append(order, id)
+	}
+	ms.order = order
+
+	priTxs := ms.proposedPriTxs
+	ms.proposed, ms.proposedPriTxs = nil, nil
+	if ms.Store == nil {
+		return nil
+	}
+	if err := ms.removeTxs(context.TODO(), removed); err != nil {
+		return err
+	}
+	if len(priTxs) == 0 {
+		return nil
+	}
+	for _, priTx := range priTxs {
+		newToken, ok := priTx.Data.(transaction.NewTokenTx)
+		if !ok {
+			continue
+		}
+		// the registry holds the fee eligibility set since.
+		t, ok := ms.Tokens.Get(newToken.Id)
+		if !ok || t.Address != newToken.Address {
+			continue
+		}
+		if err := ms.Store.StoreToken(context.TODO(), t); err != nil {
+			return err
+		}
+	}
+	return ms.Store.RemovePriorityTxs(context.TODO(), priTxs)
+}
+
 func (ms *MempoolState) Run() {
 	fmt.Println("Mempool handler is running.")
 	select {}
@@ -0,0 +1,687 @@
+package core
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vivijj/ziongo/core/fee"
+	"github.com/vivijj/ziongo/core/state"
+	"github.com/vivijj/ziongo/crypto/babyjub"
+	"github.com/vivijj/ziongo/types/token"
+	"github.com/vivijj/ziongo/types/transaction"
+)
+
+const testChainId = 1
+
+var (
+	testEthKey, _ = crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	// testKeys are the keys of the accounts 1 to 3, the account 4 of testEthKey has
+	// no public key.
+	testKeys  = map[int]babyjub.PrivateKey{1: {1}, 2: {2}, 3: {3}}
+	testAddrs = map[int]common.Address{
+		0: common.HexToAddress("0xaa"),
+		1: common.HexToAddress("0x01"),
+		2: common.HexToAddress("0x02"),
+		3: common.HexToAddress("0x03"),
+		4: crypto.PubkeyToAddress(testEthKey.PublicKey),
+	}
+)
+
+// newTestMempool returns a mempool on the state of the operator account 0 and the
+// accounts 1 to 4, with the nonces 0, 5, 0 and 0, where the txs pay 1 USDC of fee.
+// The accounts have 10 USDC and 1 ETH, but the account 3 only has 2.5 USDC.
+func newTestMempool(t *testing.T) (*MempoolState, *state.View) {
+	tokens, err := token.NewRegistry(
+		token.Token{Id: 0, Symbol: "ETH", Decimals: 18, FeeEligible: true},
+		token.Token{Id: 1, Address: common.HexToAddress("0x01"), Symbol: "USDC", Decimals: 6, FeeEligible: true},
+	)
+	require.NoError(t, err)
+	prices := fee.StaticPrices{"ETH": big.NewRat(2000, 1), "USDC": big.NewRat(1, 1)}
+	fees := fee.NewEngine(fee.DefaultConfig(), tokens, prices)
+
+	s := state.New(testChainId, common.Address{}, tokens)
+	for id := 0; id <= 4; id++ {
+		usdc := int64(10_000_000)
+		if id == 3 {
+			usdc = 2_500_000
+		}
+		for tokenId, amount := range []int64{1e18, usdc} {
+			_, err := s.ExecutePriorityTx(transaction.PriorityTx{
+				Data: transaction.DepositTx{To: testAddrs[id], Token: uint16(tokenId), Amount: big.NewInt(amount)},
+			})
+			require.NoError(t, err)
+		}
+		if k, ok := testKeys[id]; ok {
+			s.Accounts[id].PublicKey = *k.Public()
+		}
+	}
+	s.Accounts[2].Nonce = 5
+
+	view := state.NewView(s)
+	ms := NewMempool(view, tokens, fees, DefaultMempoolConfig())
+	ms.now = func() int { return 1000 }
+	return ms, view
+}
+
+func setNonce(view *state.View, id int, nonce int) {
+	view.Update(func(s *state.State) { s.Accounts[id].Nonce = nonce })
+}
+
+func testTx(accountId int, nonce int) transaction.TransferTx {
+	return testTxFee(accountId, nonce, 1_000_000)
+}
+
+// testTxFee returns a transfer of the account paying the fee in USDC.
+func testTxFee(accountId int, nonce int, fee int64) transaction.TransferTx {
+	tx := transaction.TransferTx{
+		AccountId:  accountId,
+		Nonce:      nonce,
+		ValidUntil: 2000,
+		FeeToken:   1,
+		Fee:        big.NewInt(fee),
+		From:       testAddrs[accountId],
+		To:         testAddrs[0],
+		Token:      0,
+		Amount:     big.NewInt(1000),
+	}
+	k := testKeys[accountId]
+	tx.Signature = *k.SignPoseidon(tx.EncodeBi(testChainId))
+	return tx
+}
+
+// proposedNonces returns the account and the nonce of the proposed txs.
+func proposedNonces(txs []transaction.ZionTx) [][2]int {
+	nonces := make([][2]int, len(txs))
+	for i, tx := range txs {
+		if batch, ok := tx.(transaction.BatchTx); ok {
+			tx = batch.Txs[0]
+		}
+		id, nonce, _ := txNonce(tx)
+		nonces[i] = [2]int{id, nonce}
+	}
+	return nonces
+}
+
+func TestMempoolNonceOrder(t *testing.T) {
+	ms, _ := newTestMempool(t)
+
+	for _, nonce := range []int{2, 0, 4, 1} {
+		_, err := ms.AddTx(testTx(1, nonce))
+		require.NoError(t, err)
+	}
+	assert.Len(t, ms.ReadyTxs(1), 3)
+	assert.Len(t, ms.PendingTxs(1), 1)
+
+	_, err := ms.AddTx(transaction.BatchTx{Txs: []transaction.ZionTx{testTx(1, 2), testTx(1, 3)}})
+	assert.ErrorIs(t, err, ErrNonceQueued)
+	_, err = ms.AddTx(testTx(2, 4))
+	assert.ErrorIs(t, err, ErrNonceTooLow)
+	_, err = ms.AddTx(testTx(7, 0))
+	assert.ErrorIs(t, err, state.ErrAccountNotFound)
+
+	b := ms.ProposeNewBlock(0)
+	assert.Equal(t, [][2]int{{1, 0}, {1, 1}, {1, 2}}, proposedNonces(b.Txs))
+	assert.Len(t, ms.PendingTxs(1), 1)
+
+	// the nonces of the proposed txs are used until the block is executed.
+	_, err = ms.AddTx(testTx(1, 1))
+	assert.ErrorIs(t, err, ErrNonceTooLow)
+	_, err = ms.AddTx(testTx(1, 3))
+	require.NoError(t, err)
+	assert.Len(t, ms.ReadyTxs(1), 2)
+}
+
+func TestMempoolFairness(t *testing.T) {
+	ms, _ := newTestMempool(t)
+
+	for nonce := 0; nonce < 4; nonce++ {
+		_, err := ms.AddTx(testTx(1, nonce))
+		require.NoError(t, err)
+	}
+	for nonce := 5; nonce < 7; nonce++ {
+		_, err := ms.AddTx(testTx(2, nonce))
+		require.NoError(t, err)
+	}
+	_, err := ms.AddTx(testTx(3, 0))
+	require.NoError(t, err)
+
+	b := ms.ProposeNewBlock(2)
+	assert.Equal(t, [][2]int{{1, 0}, {2, 5}}, proposedNonces(b.Txs))
+
+	// the account left out of the last block is first in the next one.
+	b = ms.ProposeNewBlock(0)
+	assert.Equal(t, [][2]int{{3, 0}, {1, 1}, {2, 6}, {1, 2}, {1, 3}}, proposedNonces(b.Txs))
+}
+
+func TestMempoolBatch(t *testing.T) {
+	ms, _ := newTestMempool(t)
+
+	batch := transaction.BatchTx{Txs: []transaction.ZionTx{testTx(1, 0), testTx(1, 1), testTx(3, 0)}}
+	_, err := ms.AddTx(batch)
+	require.NoError(t, err)
+	_, err = ms.AddTx(testTx(1, 1))
+	assert.ErrorIs(t, err, ErrNonceQueued)
+	_, err = ms.AddTx(testTx(1, 2))
+	require.NoError(t, err)
+	assert.Len(t, ms.ReadyTxs(1), 2)
+
+	_, err = ms.AddTx(transaction.BatchTx{Txs: []transaction.ZionTx{testTx(2, 5), testTx(2, 7)}})
+	assert.ErrorIs(t, err, ErrInvalidNonces)
+
+	// the batch doesn't fit in the block, the txs of the account wait for it.
+	b := ms.ProposeNewBlock(2)
+	assert.Empty(t, b.Txs)
+	b = ms.ProposeNewBlock(3)
+	assert.IsType(t, transaction.BatchTx{}, b.Txs[0])
+}
+
+func TestMempoolBlockExecuted(t *testing.T) {
+	ms, view := newTestMempool(t)
+
+	for _, nonce := range []int{0, 1, 3} {
+		_, err := ms.AddTx(testTx(1, nonce))
+		require.NoError(t, err)
+	}
+	b := ms.ProposeNewBlock(0)
+	require.Len(t, b.Txs, 2)
+	_, err := ms.AddTx(testTx(1, 2))
+	require.NoError(t, err)
+
+	// the tx of the nonce 1 failed, so the txs after it wait for a tx of nonce 1.
+	setNonce(view, 1, 1)
+	require.NoError(t, ms.BlockExecuted())
+	assert.Empty(t, ms.ReadyTxs(1))
+	assert.Len(t, ms.PendingTxs(1), 2)
+
+	_, err = ms.AddTx(testTx(1, 1))
+	require.NoError(t, err)
+	assert.Len(t, ms.ReadyTxs(1), 3)
+	assert.Empty(t, ms.PendingTxs(1))
+
+	// the txs of the used nonces are dropped, and the empty queues too.
+	setNonce(view, 1, 4)
+	require.NoError(t, ms.BlockExecuted())
+	assert.Empty(t, ms.ReadyTxs(1))
+	assert.Empty(t, ms.accounts)
+	assert.Empty(t, ms.ProposeNewBlock(0).Txs)
+}
+
+func TestMempoolValidation(t *testing.T) {
+	ms, view := newTestMempool(t)
+
+	wrongKey := testTx(1, 0)
+	k := testKeys[2]
+	wrongKey.Signature = *k.SignPoseidon(wrongKey.EncodeBi(testChainId))
+	wrongAddr := testTx(1, 0)
+	wrongAddr.From = testAddrs[2]
+	expired := testTx(1, 0)
+	expired.ValidUntil = 999
+	nft := testTx(1, 0)
+	nft.Token, nft.Amount = 1<<16, big.NewInt(1)
+	k = testKeys[1]
+	nft.Signature = *k.SignPoseidon(nft.EncodeBi(testChainId))
+	for err, tx := range map[error]transaction.ZionTx{
+		state.ErrInvalidSignature: wrongKey,
+		state.ErrAccountIncorrect: wrongAddr,
+		ErrTxExpired:              expired,
+		state.ErrNFTNotFound:      nft,
+		state.ErrFromAccountLocked: transaction.TransferTx{
+			AccountId: 4, From: testAddrs[4], ValidUntil: 2000,
+			FeeToken: 1, Fee: big.NewInt(1_000_000), Token: 0, Amount: big.NewInt(1000),
+		},
+	} {
+		_, e := ms.AddTx(tx)
+		var txErr *TxError
+		require.ErrorAs(t, e, &txErr)
+		assert.Equal(t, err, txErr.Err)
+		assert.Equal(t, -1, txErr.Index)
+	}
+
+	// the balance left for a tx is after the queued txs, pending or not.
+	_, err := ms.AddTx(testTx(3, 0))
+	require.NoError(t, err)
+	_, err = ms.AddTx(testTx(3, 2))
+	require.NoError(t, err)
+	_, err = ms.AddTx(testTx(3, 1))
+	assert.ErrorIs(t, err, state.ErrInsufficientBalance)
+	view.Update(func(s *state.State) { s.Accounts[3].UpdateBalance(1, big.NewInt(1_000_000)) })
+	_, err = ms.AddTx(testTx(3, 1))
+	require.NoError(t, err)
+
+	// the error of a batch tells which of its txs is rejected.
+	expired = testTx(1, 1)
+	expired.ValidUntil = 999
+	_, err = ms.AddTx(transaction.BatchTx{Txs: []transaction.ZionTx{testTx(1, 0), expired}})
+	var txErr *TxError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, 1, txErr.Index)
+	assert.Equal(t, ErrTxExpired, txErr.Err)
+	assert.Equal(t, "tx 1 of the batch: tx is expired", err.Error())
+}
+
+// testSwap returns the swap of 9.5 USDC of the account 1 for 1000 wei of the
+// account 2, submitted by the account 3.
+func testSwap(nonce1 int) transaction.SwapTx {
+	orders := [2]transaction.Order{{
+		AccountId: 1, Nonce: nonce1, TokenSell: 1, TokenBuy: 0,
+		PriceSell: big.NewInt(9500), PriceBuy: big.NewInt(1), Amount: big.NewInt(9_500_000), ValidUntil: 2000,
+	}, {
+		AccountId: 2, Nonce: 5, TokenSell: 0, TokenBuy: 1,
+		PriceSell: big.NewInt(1), PriceBuy: big.NewInt(9500), Amount: big.NewInt(1000), ValidUntil: 2000,
+	}}
+	for i := range orders {
+		k := testKeys[orders[i].AccountId]
+		orders[i].Signature = *k.SignPoseidon(orders[i].EncodeBi(testChainId))
+	}
+	tx := transaction.SwapTx{
+		SubmitterId:      3,
+		SubmitterAddress: testAddrs[3],
+		Orders:           orders,
+		Amounts:          [2]*big.Int{big.NewInt(9_500_000), big.NewInt(1000)},
+		FeeToken:         1,
+		Fee:              big.NewInt(1_000_000),
+	}
+	k := testKeys[3]
+	tx.Signature = *k.SignPoseidon(tx.EncodeBi(testChainId))
+	return tx
+}
+
+func TestMempoolSpending(t *testing.T) {
+	ms, view := newTestMempool(t)
+
+	// an order is executed on the nonce of its account.
+	_, err := ms.AddTx(testSwap(1))
+	assert.ErrorIs(t, err, state.ErrNonceMismatch)
+
+	// the swap queued for the account 3 spends the USDC of the account 1 too.
+	_, err = ms.AddTx(testSwap(0))
+	require.NoError(t, err)
+	_, err = ms.AddTx(testTx(1, 0))
+	assert.ErrorIs(t, err, state.ErrInsufficientBalance)
+
+	// the proposed txs spend from the balances until their block is executed.
+	ms, view = newTestMempool(t)
+	_, err = ms.AddTx(testTx(3, 0))
+	require.NoError(t, err)
+	require.Len(t, ms.ProposeNewBlock(0).Txs, 1)
+	_, err = ms.AddTx(testTx(3, 1))
+	require.NoError(t, err)
+	_, err = ms.AddTx(testTx(3, 2))
+	assert.ErrorIs(t, err, state.ErrInsufficientBalance)
+
+	view.Update(func(s *state.State) {
+		s.Accounts[3].Nonce = 1
+		s.Accounts[3].UpdateBalance(1, big.NewInt(-1_000_000))
+	})
+	require.NoError(t, ms.BlockExecuted())
+	_, err = ms.AddTx(testTx(3, 2))
+	assert.ErrorIs(t, err, state.ErrInsufficientBalance)
+	view.Update(func(s *state.State) { s.Accounts[3].UpdateBalance(1, big.NewInt(1_000_000)) })
+	_, err = ms.AddTx(testTx(3, 2))
+	assert.NoError(t, err)
+}
+
+func TestMempoolSigChecks(t *testing.T) {
+	ms, view := newTestMempool(t)
+	qt, err := ms.prepareTx(testTx(1, 0))
+	require.NoError(t, err)
+
+	// the result of a signature check made with the same key is used.
+	sigs := ms.collectSigChecks(qt)
+	require.Len(t, sigs, 1)
+	sigs[0].err = state.ErrInvalidSignature
+	assert.ErrorIs(t, ms.validateTx(qt.tx, nil, sigs), state.ErrInvalidSignature)
+
+	// the signature is checked again when the key has changed in between.
+	runSigChecks(sigs)
+	require.NoError(t, sigs[0].err)
+	view.Update(func(s *state.State) { s.Accounts[1].PublicKey = s.Accounts[2].PublicKey })
+	assert.ErrorIs(t, ms.validateTx(qt.tx, nil, sigs), state.ErrInvalidSignature)
+}
+
+func TestMempoolBatchSigChecks(t *testing.T) {
+	ms, _ := newTestMempool(t)
+	bad := testTx(1, 2)
+	bad.Signature = testTx(1, 3).Signature
+	batch := transaction.BatchTx{Txs: []transaction.ZionTx{testTx(1, 0), testTx(1, 1), bad, testTx(3, 0)}}
+	qt, err := ms.prepareTx(batch)
+	require.NoError(t, err)
+
+	// the signatures are checked in a single batch, which finds out the bad one.
+	sigs := ms.collectSigChecks(qt)
+	require.Len(t, sigs, 4)
+	runSigChecks(sigs)
+	for i, sig := range sigs {
+		if i == 2 {
+			assert.ErrorIs(t, sig.err, state.ErrInvalidSignature)
+		} else {
+			assert.NoError(t, sig.err)
+		}
+	}
+	_, err = ms.AddTx(batch)
+	var txErr *TxError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, 2, txErr.Index)
+	assert.ErrorIs(t, err, state.ErrInvalidSignature)
+}
+
+func TestMempoolPubkeyUpdate(t *testing.T) {
+	ms, view := newTestMempool(t)
+
+	l2Key := babyjub.PrivateKey{4}
+	domain := view.AuthDomain()
+	pubkeyUpdate, err := transaction.NewPubkeyUpdateTx(
+		testEthKey, domain, transaction.EIP712Auth, *l2Key.Public(), 4, 0, 2000, 1, big.NewInt(1_000_000),
+	)
+	require.NoError(t, err)
+	transfer := transaction.TransferTx{
+		AccountId: 4, Nonce: 1, From: testAddrs[4], ValidUntil: 2000,
+		FeeToken: 1, Fee: big.NewInt(1_000_000), Token: 0, Amount: big.NewInt(1000),
+	}
+	transfer.Signature = *l2Key.SignPoseidon(transfer.EncodeBi(testChainId))
+
+	// the transfer is signed by the key set by the queued pubkey update.
+	_, err = ms.AddTx(transfer)
+	assert.ErrorIs(t, err, state.ErrFromAccountLocked)
+	_, err = ms.AddTx(pubkeyUpdate)
+	require.NoError(t, err)
+	_, err = ms.AddTx(transfer)
+	require.NoError(t, err)
+	assert.Len(t, ms.ReadyTxs(4), 2)
+
+	wrongDomain := domain
+	wrongDomain.ChainId++
+	pubkeyUpdate, err = transaction.NewPubkeyUpdateTx(
+		testEthKey, wrongDomain, transaction.EIP712Auth, *l2Key.Public(), 4, 2, 2000, 1, big.NewInt(1_000_000),
+	)
+	require.NoError(t, err)
+	_, err = ms.AddTx(pubkeyUpdate)
+	assert.ErrorIs(t, err, state.ErrInvalidAuthData)
+}
+
+func TestMempoolReplaceByFee(t *testing.T) {
+	ms, _ := newTestMempool(t)
+
+	for nonce := 0; nonce < 3; nonce++ {
+		_, err := ms.AddTx(testTx(1, nonce))
+		require.NoError(t, err)
+	}
+	_, err := ms.AddTx(testTxFee(1, 1, 1_090_000))
+	assert.ErrorIs(t, err, ErrFeeBumpTooLow)
+	hash, err := ms.AddTx(testTxFee(1, 1, 1_100_000))
+	require.NoError(t, err)
+	ready := ms.ReadyTxs(1)
+	require.Len(t, ready, 3)
+	assert.Equal(t, hash, transaction.ZionTxHash(ready[1]))
+	assert.Equal(t, 3, ms.size)
+
+	// the replaced tx doesn't count in the balance left for its replacement.
+	_, err = ms.AddTx(testTxFee(1, 1, 7_000_000))
+	require.NoError(t, err)
+	_, err = ms.AddTx(testTxFee(1, 1, 9_000_000))
+	assert.ErrorIs(t, err, state.ErrInsufficientBalance)
+}
+
+func TestMempoolCapacity(t *testing.T) {
+	ms, _ := newTestMempool(t)
+	ms.Config.MaxTxs = 4
+	ms.Config.MaxAccountTxs = 3
+	store := newMemStore()
+	ms.Store = store
+
+	for nonce := 0; nonce < 3; nonce++ {
+		_, err := ms.AddTx(testTx(1, nonce))
+		require.NoError(t, err)
+	}
+	_, err := ms.AddTx(testTx(1, 3))
+	assert.ErrorIs(t, err, ErrAccountFull)
+
+	_, err = ms.AddTx(testTxFee(2, 5, 1_100_000))
+	require.NoError(t, err)
+	// the mempool is full of txs paying as much.
+	_, err = ms.AddTx(testTx(3, 0))
+	assert.ErrorIs(t, err, ErrMempoolFull)
+
+	// the last tx of the account paying the lowest fee is evicted.
+	_, err = ms.AddTx(testTxFee(3, 0, 1_200_000))
+	require.NoError(t, err)
+	assert.Len(t, ms.ReadyTxs(1), 2)
+	assert.Len(t, ms.ReadyTxs(2), 1)
+	_, err = ms.AddTx(testTxFee(3, 1, 1_050_000))
+	require.NoError(t, err)
+	assert.Len(t, ms.ReadyTxs(1), 1)
+
+	// nothing is evicted if there is not enough room for the tx: the batch evicts
+	// the tx of the account 1, but not the last tx of the account 3.
+	batch := transaction.BatchTx{Txs: []transaction.ZionTx{testTxFee(2, 6, 1_030_000), testTxFee(2, 7, 1_030_000)}}
+	_, err = ms.AddTx(batch)
+	assert.ErrorIs(t, err, ErrMempoolFull)
+	assert.Equal(t, 4, ms.size)
+	assert.Len(t, ms.ReadyTxs(1), 1)
+	// the evicted txs are removed from the store.
+	assert.Len(t, store.txs, 4)
+}
+
+// memStore is a MempoolStore in memory.
+type memStore struct {
+	hashes []common.Hash
+	txs    map[common.Hash]transaction.ZionTx
+	priTxs []transaction.PriorityTx
+	tokens map[int]token.Token
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		txs:    make(map[common.Hash]transaction.ZionTx),
+		tokens: make(map[int]token.Token),
+	}
+}
+
+func (s *memStore) StoreTx(_ context.Context, hash common.Hash, tx transaction.ZionTx) error {
+	if _, ok := s.txs[hash]; !ok {
+		s.hashes = append(s.hashes, hash)
+	}
+	s.txs[hash] = tx
+	return nil
+}
+
+func (s *memStore) RemoveTxs(_ context.Context, hashes []common.Hash) error {
+	for _, hash := range hashes {
+		delete(s.txs, hash)
+	}
+	return nil
+}
+
+func (s *memStore) LoadTxs(context.Context) ([]transaction.ZionTx, error) {
+	var txs []transaction.ZionTx
+	for _, hash := range s.hashes {
+		if tx, ok := s.txs[hash]; ok {
+			txs = append(txs, tx)
+		}
+	}
+	return txs, nil
+}
+
+func (s *memStore) StorePriorityTx(_ context.Context, tx transaction.PriorityTx) error {
+	s.priTxs = append(s.priTxs, tx)
+	return nil
+}
+
+func (s *memStore) RemovePriorityTxs(_ context.Context, txs []transaction.PriorityTx) error {
+	left := s.priTxs[:0]
+	for _, stored := range s.priTxs {
+		removed := false
+		for _, tx := range txs {
+			removed = removed || (tx.L1Block == stored.L1Block && tx.L1BlockIndex == stored.L1BlockIndex)
+		}
+		if !removed {
+			left = append(left, stored)
+		}
+	}
+	s.priTxs = left
+	return nil
+}
+
+// LoadPriorityTxs returns the priority txs in the order they were stored, which
+// Restore sorts.
+func (s *memStore) LoadPriorityTxs(context.Context) ([]transaction.PriorityTx, error) {
+	return append([]transaction.PriorityTx{}, s.priTxs...), nil
+}
+
+func (s *memStore) StoreToken(_ context.Context, t token.Token) error {
+	s.tokens[t.Id] = t
+	return nil
+}
+
+// LoadRegistry returns the registry of the stored tokens, like
+// storage.TokensSchema.LoadRegistry.
+func (s *memStore) LoadRegistry() (*token.Registry, error) {
+	tokens := make([]token.Token, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		tokens = append(tokens, t)
+	}
+	return token.NewRegistry(tokens...)
+}
+
+func testPriorityTx(l1Block int, l1BlockIndex int) transaction.PriorityTx {
+	return transaction.PriorityTx{
+		L1Block:      l1Block,
+		L1BlockIndex: l1BlockIndex,
+		Data:         transaction.DepositTx{To: testAddrs[1], Token: 0, Amount: big.NewInt(1)},
+	}
+}
+
+func TestMempoolRestore(t *testing.T) {
+	ms, view := newTestMempool(t)
+	store := newMemStore()
+	ms.Store = store
+
+	for _, tx := range []transaction.ZionTx{testTx(1, 0), testTx(1, 1), testTx(2, 5), testTx(3, 0), testTxFee(1, 1, 2_000_000)} {
+		_, err := ms.AddTx(tx)
+		require.NoError(t, err)
+	}
+	for _, priTx := range []transaction.PriorityTx{testPriorityTx(3, 0), testPriorityTx(2, 1), testPriorityTx(2, 0)} {
+		_, err := ms.AddPriorityTx(priTx)
+		require.NoError(t, err)
+	}
+	// the replaced tx is removed from the store.
+	assert.Len(t, store.txs, 4)
+	assert.NotContains(t, store.txs, transaction.ZionTxHash(testTx(1, 1)))
+
+	// the node restarts after the tx of nonce 0 and the first priority tx are
+	// committed.
+	setNonce(view, 1, 1)
+	included := transaction.PriTxHash(testPriorityTx(2, 0))
+	restored, _ := newTestMempool(t)
+	restored.State, restored.Store = view, store
+	require.NoError(t, restored.Restore(context.Background(), func(hash common.Hash) bool { return hash == included }))
+
+	assert.Equal(t, []transaction.ZionTx{testTxFee(1, 1, 2_000_000)}, restored.ReadyTxs(1))
+	assert.Len(t, restored.ReadyTxs(2), 1)
+	assert.Len(t, restored.ReadyTxs(3), 1)
+	assert.Equal(t, 3, restored.size)
+	assert.Len(t, store.txs, 3)
+	assert.NotContains(t, store.txs, transaction.ZionTxHash(testTx(1, 0)))
+	assert.ElementsMatch(t, []transaction.PriorityTx{testPriorityTx(2, 1), testPriorityTx(3, 0)}, store.priTxs)
+
+	b := restored.ProposeNewBlock(0)
+	assert.Equal(t, []transaction.ZionPriTx{testPriorityTx(2, 1), testPriorityTx(3, 0)}, b.PriTxs)
+	assert.Len(t, b.Txs, 3)
+	// the txs stay in the store until their block is executed.
+	assert.Len(t, store.txs, 3)
+	require.NoError(t, restored.BlockExecuted())
+	assert.Empty(t, store.txs)
+	assert.Empty(t, store.priTxs)
+}
+
+func TestMempoolStoreNewToken(t *testing.T) {
+	ms, _ := newTestMempool(t)
+	store := newMemStore()
+	ms.Store = store
+
+	dai := transaction.NewTokenTx{Id: 2, Address: common.HexToAddress("0x02"), Symbol: "DAI", Decimals: 18}
+	for _, priTx := range []transaction.PriorityTx{testPriorityTx(1, 0), {L1Block: 1, L1BlockIndex: 1, Data: dai}} {
+		_, err := ms.AddPriorityTx(priTx)
+		require.NoError(t, err)
+	}
+	b := ms.ProposeNewBlock(0)
+	_, err := state.New(testChainId, common.Address{}, ms.Tokens).ExecuteProposedBlock(b, 0, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, ms.Tokens.SetFeeEligible(dai.Id, true))
+	// the token is stored along with the removal of its priority tx.
+	assert.Empty(t, store.tokens)
+	require.NoError(t, ms.BlockExecuted())
+	assert.Empty(t, store.priTxs)
+
+	// the node restarts with the registry of the stored tokens.
+	registry, err := store.LoadRegistry()
+	require.NoError(t, err)
+	stored, ok := registry.Get(dai.Id)
+	require.True(t, ok)
+	assert.Equal(t, token.Token{Id: 2, Address: dai.Address, Symbol: "DAI", Decimals: 18, FeeEligible: true}, stored)
+	assert.Len(t, registry.Tokens(), 1)
+}
+
+func TestMempoolRestoreSigChecks(t *testing.T) {
+	store := newMemStore()
+	bad := testTx(2, 5)
+	bad.Signature = testTx(2, 6).Signature
+	txs := []transaction.ZionTx{testTx(1, 0), bad, testTx(3, 0), testTx(1, 1)}
+	for _, tx := range txs {
+		require.NoError(t, store.StoreTx(context.Background(), transaction.ZionTxHash(tx), tx))
+	}
+
+	// the signatures of the restored txs are checked in a batch, and only the tx
+	// of the bad one is dropped.
+	ms, _ := newTestMempool(t)
+	ms.Store = store
+	require.NoError(t, ms.Restore(context.Background(), nil))
+	assert.Len(t, ms.ReadyTxs(1), 2)
+	assert.Empty(t, ms.ReadyTxs(2))
+	assert.Len(t, ms.ReadyTxs(3), 1)
+	assert.Len(t, store.txs, 3)
+	assert.NotContains(t, store.txs, transaction.ZionTxHash(bad))
+}
+
+func TestMempoolBatchSignatureForcedExit(t *testing.T) {
+	ms, view := newTestMempool(t)
+	k := babyjub.PrivateKey{4}
+	view.Update(func(s *state.State) { s.Accounts[4].PublicKey = *k.Public() })
+
+	// the batch is signed on L1 by the account 4, the initiator of the forced exit.
+	forcedExit := transaction.ForcedExitTx{
+		AccountId:  4,
+		Nonce:      0,
+		ValidUntil: 2000,
+		FeeToken:   1,
+		Fee:        big.NewInt(2_000_000),
+		Target:     testAddrs[0],
+		Token:      1,
+	}
+	forcedExit.Signature = *k.SignPoseidon(forcedExit.EncodeBi(testChainId))
+	batch := transaction.BatchTx{Txs: []transaction.ZionTx{forcedExit}}
+	var err error
+	batch.Signature, err = crypto.Sign(batch.HashEncodeData(testChainId), testEthKey)
+	require.NoError(t, err)
+	batch.Signature[crypto.RecoveryIDOffset] += 27
+	_, err = ms.AddTx(batch)
+	require.NoError(t, err)
+
+	// the same batch signed by another key.
+	forcedExit.Nonce = 1
+	forcedExit.Signature = *k.SignPoseidon(forcedExit.EncodeBi(testChainId))
+	batch = transaction.BatchTx{Txs: []transaction.ZionTx{forcedExit}}
+	otherKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	batch.Signature, err = crypto.Sign(batch.HashEncodeData(testChainId), otherKey)
+	require.NoError(t, err)
+	batch.Signature[crypto.RecoveryIDOffset] += 27
+	_, err = ms.AddTx(batch)
+	assert.ErrorIs(t, err, state.ErrInvalidBatchSignature)
+}
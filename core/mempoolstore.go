@@ -0,0 +1,113 @@
+package core
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vivijj/ziongo/types/token"
+	"github.com/vivijj/ziongo/types/transaction"
+)
+
+// MempoolStore persists the txs of the mempool, so they are restored after a
+// restart. It's implemented by storage.MempoolSchema.
+type MempoolStore interface {
+	// StoreTx stores the tx of the hash, after the stored txs.
+	StoreTx(ctx context.Context, hash common.Hash, tx transaction.ZionTx) error
+	RemoveTxs(ctx context.Context, hashes []common.Hash) error
+	// LoadTxs returns the stored txs in the order they were stored.
+	LoadTxs(ctx context.Context) ([]transaction.ZionTx, error)
+
+	StorePriorityTx(ctx context.Context, tx transaction.PriorityTx) error
+	// RemovePriorityTxs removes the priority txs of the same L1 blocks and
+	// indexes.
+	RemovePriorityTxs(ctx context.Context, txs []transaction.PriorityTx) error
+	// LoadPriorityTxs returns the stored priority txs by L1 block and index.
+	LoadPriorityTxs(ctx context.Context) ([]transaction.PriorityTx, error)
+
+	// StoreToken stores the token registered by an executed NewToken priority tx,
+	// replacing the stored token of the same id.
+	StoreToken(ctx context.Context, t token.Token) error
+}
+
+// Restore queues the txs of the store in the empty mempool, after a restart. The
+// txs are checked again against the committed state, so the txs whose nonces are
+// used are dropped, and the txs of the hashes included in the committed blocks
+// are dropped too, the hash of a priority tx being its transaction.PriTxHash.
+// The signatures of all the txs are checked in a single batch. The dropped txs
+// are removed from the store. The priority txs keep the order of
+// their L1 blocks and indexes. A nil included drops no tx.
+func (ms *MempoolState) Restore(ctx context.Context, included func(common.Hash) bool) error {
+	if included == nil {
+		included = func(common.Hash) bool { return false }
+	}
+	priTxs, err := ms.Store.LoadPriorityTxs(ctx)
+	if err != nil {
+		return err
+	}
+	txs, err := ms.Store.LoadTxs(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the txs are prepared and their signatures checked before they are queued.
+	var dropped []common.Hash
+	var restored []queuedTx
+	var sigs [][]sigCheck
+	var allSigs []sigCheck
+	for _, tx := range txs {
+		hash := transaction.ZionTxHash(tx)
+		if included(hash) {
+			dropped = append(dropped, hash)
+			continue
+		}
+		qt, err := ms.prepareTx(tx)
+		if err != nil {
+			dropped = append(dropped, hash)
+			continue
+		}
+		restored = append(restored, qt)
+		qtSigs := ms.collectSigChecks(qt)
+		sigs = append(sigs, qtSigs)
+		allSigs = append(allSigs, qtSigs...)
+	}
+	runSigChecks(allSigs)
+	for i := range sigs {
+		sigs[i], allSigs = allSigs[:len(sigs[i])], allSigs[len(sigs[i]):]
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	sort.SliceStable(priTxs, func(i, j int) bool {
+		if priTxs[i].L1Block != priTxs[j].L1Block {
+			return priTxs[i].L1Block < priTxs[j].L1Block
+		}
+		return priTxs[i].L1BlockIndex < priTxs[j].L1BlockIndex
+	})
+	var droppedPriTxs []transaction.PriorityTx
+	for _, priTx := range priTxs {
+		if included(transaction.PriTxHash(priTx)) {
+			droppedPriTxs = append(droppedPriTxs, priTx)
+			continue
+		}
+		ms.PriTxsQueue.PushBack(priTx)
+	}
+
+	for i, qt := range restored {
+		_, err := ms.queueTx(ctx, qt, false, sigs[i])
+		if _, ok := err.(*TxError); ok {
+			dropped = append(dropped, qt.hash)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if err := ms.removeTxs(ctx, dropped); err != nil {
+		return err
+	}
+	if len(droppedPriTxs) == 0 {
+		return nil
+	}
+	return ms.Store.RemovePriorityTxs(ctx, droppedPriTxs)
+}
@@ -0,0 +1,104 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/vivijj/ziongo/types/block"
+	"github.com/vivijj/ziongo/types/operation"
+	"github.com/vivijj/ziongo/types/transaction"
+)
+
+// ExecuteProposedBlock executes the priority txs and then the txs of the proposed
+// block, and returns the executed operations in the order of the block.  A failed
+// tx is recorded and doesn't stop the block.  The txs of a batch stay contiguous
+// and share a BatchId, numbered from 1 in the block; when one of them fails, the
+// whole batch is reverted and every tx of it is failed.  The timestamp is the time
+// of the block, it's set as the Timestamp of the state, which rejects the expired
+// orders, and it's the creation time of the executed operations.  A new token that
+// conflicts with the registry is recorded as the Conflict of its executed priority
+// tx.  An error is only returned for a priority tx of an unknown type, and then the
+// state is left unchanged.
+func (s *State) ExecuteProposedBlock(
+	proposed block.ProposedBlock,
+	curCond int,
+	operatorId int,
+	timestamp int,
+) ([]block.ExecutedOperation, error) {
+	s.Timestamp = timestamp
+	createdAt := int64(timestamp)
+	priTxs := make([]transaction.PriorityTx, len(proposed.PriTxs))
+	for i, t := range proposed.PriTxs {
+		priTx, ok := t.(transaction.PriorityTx)
+		if !ok {
+			priTx = transaction.PriorityTx{Data: t}
+		}
+		if err := checkPriorityTx(priTx); err != nil {
+			return nil, err
+		}
+		priTxs[i] = priTx
+	}
+
+	exeOps := make([]block.ExecutedOperation, 0, len(proposed.PriTxs)+len(proposed.Txs))
+	for _, priTx := range priTxs {
+		op, conflict, err := s.executePriorityTx(priTx)
+		if err != nil {
+			return nil, err
+		}
+		exe := block.ExecutedPriorityTx{
+			PriTx:      priTx,
+			Op:         op,
+			BlockIndex: len(exeOps),
+			CreatedAt:  createdAt,
+		}
+		if conflict != nil {
+			exe.Conflict = conflict.Error()
+		}
+		exeOps = append(exeOps, exe)
+	}
+
+	var batchId int64
+	for _, tx := range proposed.Txs {
+		batch, ok := tx.(transaction.BatchTx)
+		if !ok {
+			op, err := s.ExecuteTx(tx, curCond, operatorId)
+			exeOps = append(exeOps, executedTx(tx, op, err, len(exeOps), createdAt, 0))
+			continue
+		}
+
+		batchId++
+		ops, failed, err := s.ExecuteBatch(batch, curCond, operatorId)
+		if err != nil {
+			err = fmt.Errorf("tx %d of the batch failed: %w", failed, err)
+		}
+		for i, inner := range batch.Txs {
+			var op operation.ZionOp
+			if err == nil {
+				op = ops[i]
+			}
+			exeOps = append(exeOps, executedTx(inner, op, err, len(exeOps), createdAt, batchId))
+		}
+	}
+	return exeOps, nil
+}
+
+func executedTx(
+	tx transaction.ZionTx,
+	op operation.ZionOp,
+	err error,
+	blockIndex int,
+	createdAt int64,
+	batchId int64,
+) block.ExecutedTx {
+	exe := block.ExecutedTx{
+		Tx:         tx,
+		Success:    err == nil,
+		Op:         op,
+		BlockIndex: blockIndex,
+		CreatedAt:  createdAt,
+		BatchId:    batchId,
+	}
+	if err != nil {
+		exe.FailReason = err.Error()
+	}
+	return exe
+}
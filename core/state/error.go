@@ -7,15 +7,34 @@ func (err OpError) Error() string {
 }
 
 var (
-	ErrInvalidFeeToken     = &OpError{"feeToken is not supported"}
-	ErrInvalidToken        = &OpError{"token is not supported"}
-	ErrAccountNotFound     = &OpError{"account does not exist"}
-	ErrInvalidAccount      = &OpError{"invalid account id"}
-	ErrInvalidAuthData     = &OpError{"l1 auth data(signature) is incorrect"}
-	ErrInvalidSignature    = &OpError{"signature is incorrect"}
-	ErrNonceMismatch       = &OpError{"nonce mismatch"}
-	ErrInsufficientBalance = &OpError{"not enough balance"}
-	ErrFromAccountLocked   = &OpError{"account is locked"}
-	ErrAccountIncorrect    = &OpError{"account id is incorrect"}
-	ErrAccountIdTooBig     = &OpError{"account id is bigger than max limit"}
+	ErrInvalidFeeToken         = &OpError{"feeToken is not supported"}
+	ErrInvalidToken            = &OpError{"token is not supported"}
+	ErrAccountNotFound         = &OpError{"account does not exist"}
+	ErrInvalidAccount          = &OpError{"invalid account id"}
+	ErrInvalidAuthData         = &OpError{"l1 auth data(signature) is incorrect"}
+	ErrInvalidSignature        = &OpError{"signature is incorrect"}
+	ErrNonceMismatch           = &OpError{"nonce mismatch"}
+	ErrInsufficientBalance     = &OpError{"not enough balance"}
+	ErrFromAccountLocked       = &OpError{"account is locked"}
+	ErrAccountIncorrect        = &OpError{"account id is incorrect"}
+	ErrAccountIdTooBig         = &OpError{"account id is bigger than max limit"}
+	ErrAmountNotPackable       = &OpError{"amount is not packable"}
+	ErrFeeNotPackable          = &OpError{"fee is not packable"}
+	ErrInvalidTxType           = &OpError{"tx type is not supported"}
+	ErrInvalidPubKey           = &OpError{"public key is invalid"}
+	ErrInvalidAmount           = &OpError{"amount is invalid"}
+	ErrAmountTooBig            = &OpError{"amount doesn't fit in the pubdata"}
+	ErrOperatorNotFound        = &OpError{"operator account does not exist"}
+	ErrInvalidBatch            = &OpError{"batch is invalid"}
+	ErrInvalidBatchSignature   = &OpError{"batch signature is incorrect"}
+	ErrTargetNotLocked         = &OpError{"target account has a public key"}
+	ErrEmptyBalance            = &OpError{"balance to withdraw is empty"}
+	ErrOrdersMismatch          = &OpError{"orders don't match"}
+	ErrOrderExpired            = &OpError{"order is expired"}
+	ErrPriceMismatch           = &OpError{"amounts don't satisfy the order price"}
+	ErrOrderOverfilled         = &OpError{"amount is more than the order amount left"}
+	ErrSubmitterIsOrderAccount = &OpError{"swap submitter is the account of an order"}
+	ErrInvalidNFTAmount        = &OpError{"amount of a NFT must be 1"}
+	ErrNFTNotFound             = &OpError{"NFT does not exist"}
+	ErrNFTIdExhausted          = &OpError{"no NFT token id is left"}
 )
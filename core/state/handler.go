@@ -1 +1,427 @@
 package state
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+	"github.com/vivijj/ziongo/types/account"
+	"github.com/vivijj/ziongo/types/operation"
+	"github.com/vivijj/ziongo/types/token"
+	"github.com/vivijj/ziongo/types/transaction"
+	"github.com/vivijj/ziongo/types/witness"
+)
+
+// maxTokenId is the biggest token id of the balance tree.
+const maxTokenId = 1<<(2*account.BalanceTreeDepth) - 1
+
+func (s *State) executeTransfer(tx transaction.TransferTx, operatorId int) (operation.ZionOp, error) {
+	from, err := s.checkInitiator(tx.AccountId, tx.From, tx.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkL2Signature(from, tx.VerifySignature); err != nil {
+		return nil, err
+	}
+	if err := checkTokens(s.Tokens, tx.Token, tx.FeeToken); err != nil {
+		return nil, err
+	}
+	isNFT := account.IsNFT(tx.Token)
+	if isNFT {
+		if err := s.checkNFT(tx.Token, tx.Amount); err != nil {
+			return nil, err
+		}
+	}
+	if tx.To == (common.Address{}) {
+		return nil, ErrInvalidAccount
+	}
+	if err := checkBalances(from, tx.Token, tx.Amount, tx.FeeToken, tx.Fee); err != nil {
+		return nil, err
+	}
+	if s.GetAccount(operatorId) == nil {
+		return nil, ErrOperatorNotFound
+	}
+
+	toId, to := s.GetAccountByAddress(tx.To)
+	putAddressInDa := to == nil
+	if putAddressInDa {
+		toId, _ = s.createAccount(tx.To)
+	}
+	s.updateBalance(tx.AccountId, tx.Token, new(big.Int).Neg(tx.Amount))
+	s.updateBalance(toId, tx.Token, tx.Amount)
+	s.collectFee(tx.AccountId, operatorId, tx.FeeToken, tx.Fee)
+	s.incrementNonce(tx.AccountId)
+
+	if isNFT {
+		return operation.TransferNFTOp{Tx: tx, ToId: toId}, nil
+	}
+	return operation.TransferOp{
+		Tx:             tx,
+		ToId:           toId,
+		PutAddressInDa: putAddressInDa,
+	}, nil
+}
+
+func (s *State) executeWithdraw(tx transaction.WithdrawTx, operatorId int) (operation.ZionOp, error) {
+	from, err := s.checkInitiator(tx.AccountId, tx.From, tx.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkL2Signature(from, tx.VerifySignature); err != nil {
+		return nil, err
+	}
+	if err := checkTokens(s.Tokens, tx.Token, tx.FeeToken); err != nil {
+		return nil, err
+	}
+	isNFT := account.IsNFT(tx.Token)
+	if isNFT {
+		if err := s.checkNFT(tx.Token, tx.Amount); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkBalances(from, tx.Token, tx.Amount, tx.FeeToken, tx.Fee); err != nil {
+		return nil, err
+	}
+	if s.GetAccount(operatorId) == nil {
+		return nil, ErrOperatorNotFound
+	}
+
+	s.updateBalance(tx.AccountId, tx.Token, new(big.Int).Neg(tx.Amount))
+	s.collectFee(tx.AccountId, operatorId, tx.FeeToken, tx.Fee)
+	s.incrementNonce(tx.AccountId)
+
+	if isNFT {
+		// the record stays in the NFT tree, so the NFT can't be minted again.
+		nft := s.NFTs[tx.Token]
+		return operation.WithdrawNFTOp{
+			Tx:             tx,
+			CreatorId:      nft.CreatorId,
+			CreatorAddress: nft.CreatorAddress,
+			Serial:         nft.Serial,
+			ContentHash:    nft.ContentHash,
+		}, nil
+	}
+	return operation.WithdrawOp{Tx: tx}, nil
+}
+
+func (s *State) executeMintNFT(tx transaction.MintNFTTx, operatorId int) (operation.ZionOp, error) {
+	creator, err := s.checkInitiator(tx.CreatorId, tx.CreatorAddress, tx.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkL2Signature(creator, tx.VerifySignature); err != nil {
+		return nil, err
+	}
+	if err := checkFeeToken(s.Tokens, tx.FeeToken); err != nil {
+		return nil, err
+	}
+	recipientId, recipient := s.GetAccountByAddress(tx.Recipient)
+	if recipient == nil {
+		return nil, ErrAccountNotFound
+	}
+	if s.NextNFTTokenId > maxTokenId {
+		return nil, ErrNFTIdExhausted
+	}
+	if creator.GetBalance(tx.FeeToken).Cmp(tx.Fee) < 0 {
+		return nil, ErrInsufficientBalance
+	}
+	if s.GetAccount(operatorId) == nil {
+		return nil, ErrOperatorNotFound
+	}
+
+	nft := s.createNFT(tx.CreatorId, tx.CreatorAddress, tx.ContentHash)
+	s.updateBalance(recipientId, nft.Id, big.NewInt(1))
+	s.collectFee(tx.CreatorId, operatorId, tx.FeeToken, tx.Fee)
+	s.incrementNonce(tx.CreatorId)
+
+	return operation.MintNFTOp{
+		Tx:          tx,
+		TokenId:     nft.Id,
+		Serial:      nft.Serial,
+		RecipientId: recipientId,
+	}, nil
+}
+
+func (s *State) executePubkeyUpdate(tx transaction.PubkeyUpdateTx, operatorId int) (operation.ZionOp, error) {
+	acc, err := s.checkInitiator(tx.AccountId, tx.Account, tx.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Encode(); err != nil {
+		return nil, ErrInvalidPubKey
+	}
+	domain := transaction.AuthDomain{ChainId: s.ChainId, VerifyingContract: s.ContractAddr}
+	if tx.VerifyAuthData(domain) != nil {
+		return nil, ErrInvalidAuthData
+	}
+	if err := checkFeeToken(s.Tokens, tx.FeeToken); err != nil {
+		return nil, err
+	}
+	if acc.GetBalance(tx.FeeToken).Cmp(tx.Fee) < 0 {
+		return nil, ErrInsufficientBalance
+	}
+	if s.GetAccount(operatorId) == nil {
+		return nil, ErrOperatorNotFound
+	}
+
+	s.setPublicKey(tx.AccountId, tx.PubKey)
+	s.collectFee(tx.AccountId, operatorId, tx.FeeToken, tx.Fee)
+	s.incrementNonce(tx.AccountId)
+
+	return operation.PubkeyUpdateOp{Tx: tx}, nil
+}
+
+// ExecuteForcedExit executes the forced exit and returns its operation with its
+// witness.  On error the state is left unchanged.
+func (s *State) ExecuteForcedExit(
+	tx transaction.ForcedExitTx,
+	operatorId int,
+) (operation.ForcedExitOp, witness.TxWitness, error) {
+	if err := CheckPackable(tx); err != nil {
+		return operation.ForcedExitOp{}, witness.TxWitness{}, err
+	}
+	initiator := s.GetAccount(tx.AccountId)
+	if initiator == nil {
+		return operation.ForcedExitOp{}, witness.TxWitness{}, ErrAccountNotFound
+	}
+	if initiator.Nonce != tx.Nonce {
+		return operation.ForcedExitOp{}, witness.TxWitness{}, ErrNonceMismatch
+	}
+	if err := s.checkL2Signature(initiator, tx.VerifySignature); err != nil {
+		return operation.ForcedExitOp{}, witness.TxWitness{}, err
+	}
+	if err := checkFungibleTokens(s.Tokens, tx.Token, tx.FeeToken); err != nil {
+		return operation.ForcedExitOp{}, witness.TxWitness{}, err
+	}
+	targetId, target := s.GetAccountByAddress(tx.Target)
+	if target == nil {
+		return operation.ForcedExitOp{}, witness.TxWitness{}, ErrAccountNotFound
+	}
+	if target.HasPublicKey() {
+		return operation.ForcedExitOp{}, witness.TxWitness{}, ErrTargetNotLocked
+	}
+	amount := new(big.Int).Set(target.GetBalance(tx.Token))
+	if amount.Sign() == 0 {
+		return operation.ForcedExitOp{}, witness.TxWitness{}, ErrEmptyBalance
+	}
+	if !operation.FitsFullAmount(amount) {
+		return operation.ForcedExitOp{}, witness.TxWitness{}, ErrAmountTooBig
+	}
+	if initiator.GetBalance(tx.FeeToken).Cmp(tx.Fee) < 0 {
+		return operation.ForcedExitOp{}, witness.TxWitness{}, ErrInsufficientBalance
+	}
+	if s.GetAccount(operatorId) == nil {
+		return operation.ForcedExitOp{}, witness.TxWitness{}, ErrOperatorNotFound
+	}
+
+	targetUpdate := s.updateBalance(targetId, tx.Token, new(big.Int).Neg(amount))
+	feeUpdate, operatorUpdate := s.collectFee(tx.AccountId, operatorId, tx.FeeToken, tx.Fee)
+	s.incrementNonce(tx.AccountId)
+
+	op := operation.ForcedExitOp{
+		Tx:              tx,
+		TargetAccountId: targetId,
+		WithdrawAmount:  amount,
+	}
+	return op, witness.TxWitness{
+		TxType: string(transaction.ForcedExit),
+		Tx:     op,
+		Witness: witness.Witness{
+			SignatureFrom:         &tx.Signature,
+			AccountMerkleRoot:     string(s.AccountTree.RootHash()),
+			BalanceUpdateFeeFrom:  feeUpdate,
+			BalanceUpdateTo:       targetUpdate,
+			BalanceUpdateOperator: operatorUpdate,
+		},
+	}, nil
+}
+
+func (s *State) executeDeposit(tx transaction.DepositTx) operation.ZionOp {
+	id, acc := s.GetAccountByAddress(tx.To)
+	if acc == nil {
+		id, _ = s.createAccount(tx.To)
+	}
+	s.updateBalance(id, int(tx.Token), tx.Amount)
+	return operation.DepositOp{Tx: tx, AccountId: id}
+}
+
+// executeFullExit withdraws the whole balance of the token, if the L1 sender owns
+// the account and the balance fits in the pubdata. Otherwise it changes nothing,
+// and the op withdraws 0.
+func (s *State) executeFullExit(tx transaction.FullExitTx) operation.ZionOp {
+	op := operation.FullExitOp{Tx: tx, WithdrawAmount: big.NewInt(0)}
+	acc := s.GetAccount(tx.AccountId)
+	if acc == nil || acc.Address != tx.EthAddress ||
+		account.IsNFT(tx.Token) || checkToken(s.Tokens, tx.Token) != nil {
+		return op
+	}
+	balance := acc.GetBalance(tx.Token)
+	if balance.Sign() == 0 || !operation.FitsFullAmount(balance) {
+		return op
+	}
+	op.WithdrawAmount.Set(balance)
+	s.updateBalance(tx.AccountId, tx.Token, new(big.Int).Neg(op.WithdrawAmount))
+	return op
+}
+
+// checkInitiator checks the account that initiates a L2 tx, and returns it.
+func (s *State) checkInitiator(accountId int, addr common.Address, nonce int) (*account.Account, error) {
+	acc := s.GetAccount(accountId)
+	if acc == nil {
+		return nil, ErrAccountNotFound
+	}
+	if acc.Address != addr {
+		return nil, ErrAccountIncorrect
+	}
+	if acc.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+	return acc, nil
+}
+
+// checkL2Signature checks the signature of a tx by the public key of the account,
+// for the chain of the state.
+func (s *State) checkL2Signature(acc *account.Account, verify func(int, *babyjub.PublicKey) error) error {
+	if !acc.HasPublicKey() {
+		return ErrFromAccountLocked
+	}
+	if verify(s.ChainId, &acc.PublicKey) != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// checkToken checks that the token is registered, or is in the NFT range.
+func checkToken(tokens *token.Registry, tokenId int) error {
+	if account.IsNFT(tokenId) {
+		if tokenId > maxTokenId {
+			return ErrInvalidToken
+		}
+		return nil
+	}
+	if _, ok := tokens.Get(tokenId); !ok {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// checkFeeToken checks that the fees may be paid in the token, which is never a
+// NFT.
+func checkFeeToken(tokens *token.Registry, feeToken int) error {
+	if !tokens.IsFeeEligible(feeToken) {
+		return ErrInvalidFeeToken
+	}
+	return nil
+}
+
+// checkTokens checks the token of a tx, which may be a NFT, and its fee token.
+func checkTokens(tokens *token.Registry, tokenId int, feeToken int) error {
+	if err := checkToken(tokens, tokenId); err != nil {
+		return err
+	}
+	return checkFeeToken(tokens, feeToken)
+}
+
+// checkFungibleTokens checks the tokens like checkTokens, for the txs that only
+// support fungible tokens.
+func checkFungibleTokens(tokens *token.Registry, tokenId int, feeToken int) error {
+	if account.IsNFT(tokenId) {
+		return ErrInvalidToken
+	}
+	return checkTokens(tokens, tokenId, feeToken)
+}
+
+// checkNFT checks that the NFT of the token id exists and that the amount moved
+// is exactly 1.
+func (s *State) checkNFT(tokenId int, amount *big.Int) error {
+	if amount == nil || amount.Cmp(big.NewInt(1)) != 0 {
+		return ErrInvalidNFTAmount
+	}
+	if _, ok := s.NFTs[tokenId]; !ok {
+		return ErrNFTNotFound
+	}
+	return nil
+}
+
+// checkBalances checks that the account can pay both the amount and the fee.
+func checkBalances(acc *account.Account, token int, amount *big.Int, feeToken int, fee *big.Int) error {
+	if token == feeToken {
+		if acc.GetBalance(token).Cmp(new(big.Int).Add(amount, fee)) < 0 {
+			return ErrInsufficientBalance
+		}
+		return nil
+	}
+	if acc.GetBalance(token).Cmp(amount) < 0 || acc.GetBalance(feeToken).Cmp(fee) < 0 {
+		return ErrInsufficientBalance
+	}
+	return nil
+}
+
+// createAccount creates the account of the address with the next free id.
+func (s *State) createAccount(addr common.Address) (int, *account.Account) {
+	id := s.NextFreeId
+	s.journal.touch(s, id)
+	acc := account.New(addr)
+	s.Accounts[id] = acc
+	s.AccountIdByAddr[addr] = id
+	s.NextFreeId++
+	s.updateAccountLeaf(id)
+	return id, acc
+}
+
+// updateAccountLeaf sets the leaf of the account in the account tree to its hash,
+// after every change of the account.
+func (s *State) updateAccountLeaf(id int) {
+	s.AccountTree.Update(id, s.Accounts[id].Hash())
+}
+
+func (s *State) setPublicKey(accountId int, key babyjub.PublicKey) {
+	s.journal.touch(s, accountId)
+	s.Accounts[accountId].PublicKey = key
+	s.updateAccountLeaf(accountId)
+}
+
+// createNFT records the NFT of the creator with the next NFT token id and the next
+// serial of the creator, and returns it.
+func (s *State) createNFT(creatorId int, creatorAddr common.Address, contentHash common.Hash) account.NFT {
+	nft := account.NFT{
+		Id:             s.NextNFTTokenId,
+		CreatorId:      creatorId,
+		CreatorAddress: creatorAddr,
+		Serial:         s.NFTSerials[creatorId],
+		ContentHash:    contentHash,
+	}
+	s.journal.touchNFT(s, nft.Id, creatorId)
+	s.NFTs[nft.Id] = nft
+	s.NFTTree.Update(nft.Id-account.MinNFTTokenId, nft.Hash())
+	s.NFTSerials[creatorId]++
+	s.NextNFTTokenId++
+	return nft
+}
+
+func (s *State) updateBalance(accountId int, tokenId int, delta *big.Int) witness.BalanceUpdateWitness {
+	s.journal.touch(s, accountId)
+	w := s.Accounts[accountId].UpdateBalance(tokenId, delta)
+	s.updateAccountLeaf(accountId)
+	return w
+}
+
+// collectFee moves the fee from the account to the operator, and returns the
+// witnesses of both balance updates.
+func (s *State) collectFee(
+	fromId int,
+	operatorId int,
+	feeToken int,
+	fee *big.Int,
+) (witness.BalanceUpdateWitness, witness.BalanceUpdateWitness) {
+	from := s.updateBalance(fromId, feeToken, new(big.Int).Neg(fee))
+	operator := s.updateBalance(operatorId, feeToken, fee)
+	return from, operator
+}
+
+func (s *State) incrementNonce(accountId int) {
+	s.journal.touch(s, accountId)
+	s.Accounts[accountId].Nonce++
+	s.updateAccountLeaf(accountId)
+}
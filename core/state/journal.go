@@ -0,0 +1,116 @@
+package state
+
+import (
+	"math/big"
+
+	"github.com/vivijj/ziongo/types/account"
+	"github.com/vivijj/ziongo/types/fr"
+)
+
+// journal keeps the accounts as they were before their first change, so the state
+// can be reverted to the time the journal was created.
+type journal struct {
+	nextFreeId int
+	// accounts before their first change, nil for the accounts created since.
+	accounts map[int]*account.Account
+	// fills of the orders before their first change, nil for the new ones.
+	fills map[OrderKey]*big.Int
+
+	// the nodes of the account and NFT trees are never removed, so their roots
+	// are enough to revert them.
+	accountRoot    fr.Repr
+	nextNFTTokenId int
+	nftRoot        fr.Repr
+	// token ids of the NFTs minted since.
+	nfts []int
+	// serials of the creators before their first mint.
+	serials map[int]int
+}
+
+func newJournal(s *State) *journal {
+	return &journal{
+		nextFreeId:     s.NextFreeId,
+		accounts:       make(map[int]*account.Account),
+		fills:          make(map[OrderKey]*big.Int),
+		accountRoot:    s.AccountTree.Root,
+		nextNFTTokenId: s.NextNFTTokenId,
+		nftRoot:        s.NFTTree.Root,
+		serials:        make(map[int]int),
+	}
+}
+
+// touchNFT records the NFT of the token id before it's minted by the creator.
+func (j *journal) touchNFT(s *State, tokenId int, creatorId int) {
+	if j == nil {
+		return
+	}
+	j.nfts = append(j.nfts, tokenId)
+	if _, ok := j.serials[creatorId]; !ok {
+		j.serials[creatorId] = s.NFTSerials[creatorId]
+	}
+}
+
+// touchFill records the fill of the order before it's changed.
+func (j *journal) touchFill(s *State, key OrderKey) {
+	if j == nil {
+		return
+	}
+	if _, ok := j.fills[key]; ok {
+		return
+	}
+	j.fills[key] = s.OrderFills[key]
+}
+
+// touch records the account of the id before it's changed or created.
+func (j *journal) touch(s *State, id int) {
+	if j == nil {
+		return
+	}
+	if _, ok := j.accounts[id]; ok {
+		return
+	}
+	if acc, ok := s.Accounts[id]; ok {
+		j.accounts[id] = acc.Copy()
+	} else {
+		j.accounts[id] = nil
+	}
+}
+
+// revert sets back the accounts, order fills and NFTs recorded by the journal.
+func (j *journal) revert(s *State) {
+	for id, acc := range j.accounts {
+		if acc != nil {
+			s.Accounts[id] = acc
+			continue
+		}
+		if created, ok := s.Accounts[id]; ok {
+			delete(s.AccountIdByAddr, created.Address)
+			delete(s.Accounts, id)
+		}
+	}
+	for key, fill := range j.fills {
+		if fill != nil {
+			s.OrderFills[key] = fill
+		} else {
+			delete(s.OrderFills, key)
+		}
+	}
+	for _, tokenId := range j.nfts {
+		delete(s.NFTs, tokenId)
+	}
+	for creatorId, serial := range j.serials {
+		if serial != 0 {
+			s.NFTSerials[creatorId] = serial
+		} else {
+			delete(s.NFTSerials, creatorId)
+		}
+	}
+	s.AccountTree.Root = j.accountRoot
+	s.NFTTree.Root = j.nftRoot
+	s.NextNFTTokenId = j.nextNFTTokenId
+	s.NextFreeId = j.nextFreeId
+	j.accounts = make(map[int]*account.Account)
+	j.fills = make(map[OrderKey]*big.Int)
+	j.nfts = nil
+	j.serials = make(map[int]int)
+}
@@ -3,13 +3,26 @@ package state
 import (
 	"math/big"
 
-	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common"
 
 	"github.com/vivijj/ziongo/crypto/babyjub"
+	"github.com/vivijj/ziongo/types/account"
 	"github.com/vivijj/ziongo/types/fr"
+	"github.com/vivijj/ziongo/types/operation"
 	"github.com/vivijj/ziongo/types/smt"
+	"github.com/vivijj/ziongo/types/token"
 	"github.com/vivijj/ziongo/types/transaction"
+	"github.com/vivijj/ziongo/utils/floatencode"
+	"github.com/vivijj/ziongo/utils/hasher"
+)
+
+// AccountTreeDepth is the depth of the account tree.
+const AccountTreeDepth = 16
+
+var (
+	accountTreeHasher = hasher.NewPoseidonHasher(5)
+	// stateRootHasher commits both the account and the NFT trees in the state root.
+	stateRootHasher = hasher.NewPoseidonHasher(3)
 )
 
 type TransitionVariant struct {
@@ -36,17 +49,291 @@ type TransitionVariant struct {
 }
 
 type State struct {
+	// ChainId is the id of the chain the tx signatures are verified for.
+	ChainId int
+	// ContractAddr is the address of the zion contract, which verifies the L1
+	// authorizations.
+	ContractAddr common.Address
+	// Tokens is the registry of the fungible tokens accepted by the txs.
+	Tokens          *token.Registry
 	BlockNumber     int
 	NextFreeId      int
 	AccountIdByAddr map[common.Address]int
-	Accounts        map[int]accounts.Account
+	Accounts        map[int]*account.Account
 	AccountTree     smt.SparseQuadMerkleTree
+	// OrderFills is the amount already sold by the orders partially filled.
+	OrderFills map[OrderKey]*big.Int
+	// Timestamp is the time of the block being executed, the orders valid until
+	// an earlier time are rejected.  It's set by ExecuteProposedBlock.
+	Timestamp int
+	// NFTs is the record of every minted NFT by its token id, the records are also
+	// the leaves of NFTTree.
+	NFTs    map[int]account.NFT
+	NFTTree smt.SparseQuadMerkleTree
+	// NextNFTTokenId is the token id of the next minted NFT.
+	NextNFTTokenId int
+	// NFTSerials is the number of NFTs minted by each creator account.
+	NFTSerials map[int]int
+
+	// journal records the changes of the state while a batch is executed, to
+	// revert them if a tx of the batch fails.
+	journal *journal
+}
+
+// New returns an empty state of the chain chainId, with the tokens of the
+// registry.
+func New(chainId int, contractAddr common.Address, tokens *token.Registry) *State {
+	return &State{
+		ChainId:         chainId,
+		ContractAddr:    contractAddr,
+		Tokens:          tokens,
+		AccountIdByAddr: make(map[common.Address]int),
+		Accounts:        make(map[int]*account.Account),
+		OrderFills:      make(map[OrderKey]*big.Int),
+		AccountTree:     *smt.New(AccountTreeDepth, fr.FromInt(0), *accountTreeHasher),
+		NFTs:            make(map[int]account.NFT),
+		NFTTree:         *smt.New(account.NFTTreeDepth, account.NFT{}.Hash(), *account.NFTTreeHasher),
+		NextNFTTokenId:  account.MinNFTTokenId,
+		NFTSerials:      make(map[int]int),
+	}
+}
+
+// OrderKey identifies an order by its account and nonce.
+type OrderKey struct {
+	AccountId int
+	Nonce     int
 }
 
+// GetOrderFill returns the amount already sold by the order.
+func (s *State) GetOrderFill(order transaction.Order) *big.Int {
+	if fill, ok := s.OrderFills[OrderKey{order.AccountId, order.Nonce}]; ok {
+		return fill
+	}
+	return big.NewInt(0)
+}
+
+// RootHash returns the state root, which commits the account tree and the NFT
+// tree.
 func (s *State) RootHash() fr.Repr {
-	return s.AccountTree.RootHash()
+	return stateRootHasher.HashFrRepr([]fr.Repr{s.AccountTree.RootHash(), s.NFTTree.RootHash()})
+}
+
+// GetNFT returns the record of the NFT of the token id, and whether it exists.
+func (s *State) GetNFT(tokenId int) (account.NFT, bool) {
+	nft, ok := s.NFTs[tokenId]
+	return nft, ok
+}
+
+// GetAccount returns the account of the id, or nil if it doesn't exist.
+func (s *State) GetAccount(id int) *account.Account {
+	return s.Accounts[id]
+}
+
+// accountAddress returns the address of the account of the id, see
+// transaction.AccountAddress.
+func (s *State) accountAddress(id int) (common.Address, bool) {
+	acc := s.GetAccount(id)
+	if acc == nil {
+		return common.Address{}, false
+	}
+	return acc.Address, true
+}
+
+// GetAccountByAddress returns the account of the address and its id, the account
+// is nil if it doesn't exist.
+func (s *State) GetAccountByAddress(addr common.Address) (int, *account.Account) {
+	id, ok := s.AccountIdByAddr[addr]
+	if !ok {
+		return 0, nil
+	}
+	return id, s.Accounts[id]
+}
+
+// ExecuteTx executes the L2 tx and returns its operation.  The tx is fully checked
+// before any change, so on error the state is left unchanged.  A batch is executed
+// by ExecuteBatch, and its operation is an operation.BatchOp.
+func (s *State) ExecuteTx(tx transaction.ZionTx, curCond int, operatorId int) (operation.ZionOp, error) {
+	if err := CheckPackable(tx); err != nil {
+		return nil, err
+	}
+	switch t := tx.(type) {
+	case transaction.TransferTx:
+		return s.executeTransfer(t, operatorId)
+	case transaction.WithdrawTx:
+		return s.executeWithdraw(t, operatorId)
+	case transaction.PubkeyUpdateTx:
+		return s.executePubkeyUpdate(t, operatorId)
+	case transaction.ForcedExitTx:
+		op, _, err := s.ExecuteForcedExit(t, operatorId)
+		if err != nil {
+			return nil, err
+		}
+		return op, nil
+	case transaction.SwapTx:
+		op, _, err := s.ExecuteSwap(t, operatorId)
+		if err != nil {
+			return nil, err
+		}
+		return op, nil
+	case transaction.MintNFTTx:
+		return s.executeMintNFT(t, operatorId)
+	case transaction.BatchTx:
+		ops, _, err := s.ExecuteBatch(t, curCond, operatorId)
+		if err != nil {
+			return nil, err
+		}
+		return operation.BatchOp{Ops: ops}, nil
+	}
+	return nil, ErrInvalidTxType
+}
+
+// ExecutePriorityTx executes the priority tx submitted on L1 and returns its
+// operation.  A priority tx can't fail, the error is only returned for an unknown
+// type of priority tx.  A new token has no operation, since the contract registers
+// it on its own, but a new token that conflicts with the registry is not
+// registered and its operation is a NoopOp.
+func (s *State) ExecutePriorityTx(priTx transaction.PriorityTx) (operation.ZionOp, error) {
+	op, _, err := s.executePriorityTx(priTx)
+	return op, err
 }
 
-func (s *State) ExecuteTx(tx transaction.ZionTx, curCond int, operatorId int) {
+// executePriorityTx executes the priority tx like ExecutePriorityTx, and also
+// returns the conflict of a new token with the registry.
+func (s *State) executePriorityTx(priTx transaction.PriorityTx) (operation.ZionOp, error, error) {
+	switch t := priTx.Data.(type) {
+	case transaction.DepositTx:
+		return s.executeDeposit(t), nil, nil
+	case transaction.FullExitTx:
+		return s.executeFullExit(t), nil, nil
+	case transaction.NewTokenTx:
+		conflict := s.Tokens.Add(token.Token{
+			Id:       t.Id,
+			Address:  t.Address,
+			Symbol:   t.Symbol,
+			Decimals: t.Decimals,
+		})
+		if conflict != nil {
+			return operation.NoopOp{}, conflict, nil
+		}
+		return nil, nil, nil
+	}
+	return nil, nil, ErrInvalidTxType
+}
+
+// checkPriorityTx checks that the priority tx is of a known type, so it can be
+// executed.
+func checkPriorityTx(priTx transaction.PriorityTx) error {
+	switch priTx.Data.(type) {
+	case transaction.DepositTx, transaction.FullExitTx, transaction.NewTokenTx:
+		return nil
+	}
+	return ErrInvalidTxType
+}
+
+// ExecuteBatch executes the txs of the batch in order, atomically: if a tx fails,
+// the changes of the previous ones are reverted and the error is returned along
+// with the index of the failed tx.
+func (s *State) ExecuteBatch(batch transaction.BatchTx, curCond int, operatorId int) ([]operation.ZionOp, int, error) {
+	if batch.Validate() != nil {
+		return nil, 0, ErrInvalidBatch
+	}
+	if len(batch.Signature) != 0 {
+		if err := batch.VerifySignature(s.ChainId, s.accountAddress); err != nil {
+			return nil, 0, ErrInvalidBatchSignature
+		}
+	}
+
+	s.journal = newJournal(s)
+	defer func() { s.journal = nil }()
+	ops := make([]operation.ZionOp, 0, len(batch.Txs))
+	for i, tx := range batch.Txs {
+		op, err := s.ExecuteTx(tx, curCond, operatorId)
+		if err != nil {
+			s.journal.revert(s)
+			return nil, i, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, 0, nil
+}
+
+// CheckTokens checks the tokens of the tx against the registry: a fungible token
+// must be registered, and the fee token must be fee eligible.  Whether a NFT exists
+// is only known by the state.
+func CheckTokens(tokens *token.Registry, tx transaction.ZionTx) error {
+	switch t := tx.(type) {
+	case transaction.TransferTx:
+		return checkTokens(tokens, t.Token, t.FeeToken)
+	case transaction.WithdrawTx:
+		return checkTokens(tokens, t.Token, t.FeeToken)
+	case transaction.PubkeyUpdateTx:
+		return checkFeeToken(tokens, t.FeeToken)
+	case transaction.ForcedExitTx:
+		return checkFungibleTokens(tokens, t.Token, t.FeeToken)
+	case transaction.SwapTx:
+		for _, order := range t.Orders {
+			if err := checkFungibleTokens(tokens, order.TokenSell, t.FeeToken); err != nil {
+				return err
+			}
+		}
+		return nil
+	case transaction.MintNFTTx:
+		return checkFeeToken(tokens, t.FeeToken)
+	case transaction.BatchTx:
+		for _, inner := range t.Txs {
+			if err := CheckTokens(tokens, inner); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
+// CheckPackable checks that the transfer amount and the fee of the tx are exactly
+// packable in the pubdata, as they would be rounded down otherwise, and that the
+// amount of a withdraw fits in the pubdata.  It's checked before the signature,
+// which hashes the amounts.
+func CheckPackable(tx transaction.ZionTx) error {
+	var fee *big.Int
+	switch t := tx.(type) {
+	case transaction.TransferTx:
+		if !floatencode.IsPackable(t.Amount, operation.AmountFloatEncoding) {
+			return ErrAmountNotPackable
+		}
+		fee = t.Fee
+	case transaction.WithdrawTx:
+		if t.Amount == nil || t.Amount.Sign() < 0 {
+			return ErrInvalidAmount
+		}
+		if !operation.FitsFullAmount(t.Amount) {
+			return ErrAmountTooBig
+		}
+		fee = t.Fee
+	case transaction.PubkeyUpdateTx:
+		fee = t.Fee
+	case transaction.ForcedExitTx:
+		fee = t.Fee
+	case transaction.MintNFTTx:
+		fee = t.Fee
+	case transaction.SwapTx:
+		for _, amount := range t.Amounts {
+			if !floatencode.IsPackable(amount, operation.AmountFloatEncoding) {
+				return ErrAmountNotPackable
+			}
+		}
+		fee = t.Fee
+	case transaction.BatchTx:
+		for _, inner := range t.Txs {
+			if err := CheckPackable(inner); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return nil
+	}
+	if !floatencode.IsPackable(fee, operation.FeeFloatEncoding) {
+		return ErrFeeNotPackable
+	}
+	return nil
 }
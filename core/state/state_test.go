@@ -0,0 +1,739 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+	"github.com/vivijj/ziongo/types/account"
+	"github.com/vivijj/ziongo/types/block"
+	"github.com/vivijj/ziongo/types/operation"
+	"github.com/vivijj/ziongo/types/token"
+	"github.com/vivijj/ziongo/types/transaction"
+)
+
+const testChainId = 1
+
+var (
+	testOperatorAddr = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	testUserAddr     = common.HexToAddress("0x2a500A5e1950aea40C22d8885C8DC3c02e99b3E2")
+	testUserKey      = babyjub.PrivateKey{1, 2, 3}
+	testExchangeAddr = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+)
+
+// newTestTokens returns the registry of the tokens 0 to 3, the fees may be paid in
+// the tokens 0 to 2.
+func newTestTokens() *token.Registry {
+	tokens, err := token.NewRegistry(
+		token.Token{Id: 0, Symbol: "ETH", Decimals: 18, FeeEligible: true},
+		token.Token{Id: 1, Address: common.HexToAddress("0x01"), Symbol: "USDC", Decimals: 6, FeeEligible: true},
+		token.Token{Id: 2, Address: common.HexToAddress("0x02"), Symbol: "DAI", Decimals: 18, FeeEligible: true},
+		token.Token{Id: 3, Address: common.HexToAddress("0x03"), Symbol: "ZN", Decimals: 18},
+	)
+	if err != nil {
+		panic(err)
+	}
+	return tokens
+}
+
+// newTestState returns a state with the operator account 0 and the user account 1,
+// which has 1000 of the tokens 0 and 1.
+func newTestState() *State {
+	s := New(testChainId, common.Address{}, newTestTokens())
+	s.createAccount(testOperatorAddr)
+	_, user := s.createAccount(testUserAddr)
+	user.PublicKey = *testUserKey.Public()
+	user.UpdateBalance(0, big.NewInt(1000))
+	user.UpdateBalance(1, big.NewInt(1000))
+	return s
+}
+
+func signedTransfer(nonce int, to common.Address, token int, amount int64, feeToken int, fee int64) transaction.TransferTx {
+	tx := transaction.TransferTx{
+		AccountId:  1,
+		Nonce:      nonce,
+		ValidUntil: 1 << 32,
+		FeeToken:   feeToken,
+		Fee:        big.NewInt(fee),
+		From:       testUserAddr,
+		To:         to,
+		Token:      token,
+		Amount:     big.NewInt(amount),
+	}
+	tx.Signature = *testUserKey.SignPoseidon(tx.EncodeBi(testChainId))
+	return tx
+}
+
+func TestCheckPackable(t *testing.T) {
+	tx := transaction.TransferTx{Amount: big.NewInt(123456000), Fee: big.NewInt(2047)}
+	assert.NoError(t, CheckPackable(tx))
+
+	tx.Amount = big.NewInt(123456789)
+	assert.Equal(t, ErrAmountNotPackable, CheckPackable(tx))
+
+	tx.Amount = big.NewInt(123456000)
+	tx.Fee = big.NewInt(2049)
+	assert.Equal(t, ErrFeeNotPackable, CheckPackable(tx))
+
+	// the withdraw amount is not packed in the pubdata.
+	withdraw := transaction.WithdrawTx{Amount: big.NewInt(123456789), Fee: nil}
+	assert.Equal(t, ErrFeeNotPackable, CheckPackable(withdraw))
+	withdraw.Fee = big.NewInt(0)
+	assert.NoError(t, CheckPackable(withdraw))
+	withdraw.Amount = big.NewInt(-1)
+	assert.Equal(t, ErrInvalidAmount, CheckPackable(withdraw))
+
+	// a malformed amount is rejected before the signature hashes it.
+	s := newTestState()
+	withdraw = transaction.WithdrawTx{AccountId: 1, From: testUserAddr, Fee: big.NewInt(0)}
+	_, err := s.ExecuteTx(withdraw, 0, 0)
+	assert.Equal(t, ErrInvalidAmount, err)
+}
+
+func TestExecuteTransfer(t *testing.T) {
+	s := newTestState()
+
+	op, err := s.ExecuteTx(signedTransfer(0, testExchangeAddr, 1, 100, 0, 10), 0, 0)
+	require.NoError(t, err)
+	transferOp := op.(operation.TransferOp)
+	assert.True(t, transferOp.PutAddressInDa)
+	assert.Equal(t, 2, transferOp.ToId)
+
+	assert.Equal(t, int64(900), s.GetAccount(1).GetBalance(1).Int64())
+	assert.Equal(t, int64(990), s.GetAccount(1).GetBalance(0).Int64())
+	assert.Equal(t, int64(100), s.GetAccount(2).GetBalance(1).Int64())
+	assert.Equal(t, int64(10), s.GetAccount(0).GetBalance(0).Int64())
+	assert.Equal(t, 1, s.GetAccount(1).Nonce)
+
+	_, err = s.ExecuteTx(signedTransfer(0, testExchangeAddr, 1, 100, 0, 10), 0, 0)
+	assert.Equal(t, ErrNonceMismatch, err)
+
+	_, err = s.ExecuteTx(signedTransfer(1, testExchangeAddr, 1, 1000, 0, 10), 0, 0)
+	assert.Equal(t, ErrInsufficientBalance, err)
+
+	otherChain := signedTransfer(1, testExchangeAddr, 1, 100, 0, 10)
+	otherChain.Signature = *testUserKey.SignPoseidon(otherChain.EncodeBi(testChainId + 1))
+	_, err = s.ExecuteTx(otherChain, 0, 0)
+	assert.Equal(t, ErrInvalidSignature, err)
+}
+
+func TestExecuteBatch(t *testing.T) {
+	s := newTestState()
+
+	// the sweep of the token 1 to the exchange, with the fee paid in the token 0
+	// by another transfer.
+	batch := transaction.BatchTx{Txs: []transaction.ZionTx{
+		signedTransfer(0, testExchangeAddr, 1, 1000, 1, 0),
+		signedTransfer(1, testOperatorAddr, 0, 0, 0, 20),
+	}}
+	ops, _, err := s.ExecuteBatch(batch, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, ops, 2)
+	assert.Equal(t, int64(0), s.GetAccount(1).GetBalance(1).Int64())
+	assert.Equal(t, int64(1000), s.GetAccount(2).GetBalance(1).Int64())
+	assert.Equal(t, int64(20), s.GetAccount(0).GetBalance(0).Int64())
+	assert.Equal(t, 2, s.GetAccount(1).Nonce)
+}
+
+func TestExecuteBatchRevert(t *testing.T) {
+	s := newTestState()
+	user := s.GetAccount(1).Copy()
+	operator := s.GetAccount(0).Copy()
+
+	batch := transaction.BatchTx{Txs: []transaction.ZionTx{
+		signedTransfer(0, testExchangeAddr, 1, 1000, 1, 0),
+		signedTransfer(1, testOperatorAddr, 0, 0, 1, 20),
+	}}
+	_, failed, err := s.ExecuteBatch(batch, 0, 0)
+	assert.Equal(t, ErrInsufficientBalance, err)
+	assert.Equal(t, 1, failed)
+
+	// the first transfer, and the account it created, are reverted.
+	assert.Equal(t, 2, s.NextFreeId)
+	_, exchange := s.GetAccountByAddress(testExchangeAddr)
+	assert.Nil(t, exchange)
+	assert.Nil(t, s.GetAccount(2))
+	assert.Equal(t, user.Nonce, s.GetAccount(1).Nonce)
+	assert.Equal(t, user.Balances, s.GetAccount(1).Balances)
+	assert.Equal(t, user.BalanceRoot(), s.GetAccount(1).BalanceRoot())
+	assert.Equal(t, operator.Balances, s.GetAccount(0).Balances)
+
+	// the state is still usable after the revert.
+	_, err = s.ExecuteTx(signedTransfer(0, testExchangeAddr, 1, 1000, 1, 0), 0, 0)
+	assert.NoError(t, err)
+}
+
+func TestExecuteBatchSignature(t *testing.T) {
+	ethKey, err := crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	require.NoError(t, err)
+	s := New(testChainId, common.Address{}, newTestTokens())
+	s.createAccount(testOperatorAddr)
+	_, user := s.createAccount(crypto.PubkeyToAddress(ethKey.PublicKey))
+	user.PublicKey = *testUserKey.Public()
+	user.UpdateBalance(0, big.NewInt(1000))
+
+	tx := signedTransfer(0, testExchangeAddr, 0, 100, 0, 0)
+	tx.From = user.Address
+	tx.Signature = *testUserKey.SignPoseidon(tx.EncodeBi(testChainId))
+	batch := transaction.BatchTx{Txs: []transaction.ZionTx{tx}}
+
+	batch.Signature, err = crypto.Sign(batch.HashEncodeData(testChainId+1), ethKey)
+	require.NoError(t, err)
+	batch.Signature[crypto.RecoveryIDOffset] += 27
+	_, _, err = s.ExecuteBatch(batch, 0, 0)
+	assert.Equal(t, ErrInvalidBatchSignature, err)
+
+	batch.Signature, err = crypto.Sign(batch.HashEncodeData(testChainId), ethKey)
+	require.NoError(t, err)
+	batch.Signature[crypto.RecoveryIDOffset] += 27
+	_, _, err = s.ExecuteBatch(batch, 0, 0)
+	assert.NoError(t, err)
+
+	// the initiator of a forced exit is known by its account id.
+	forcedExit := transaction.ForcedExitTx{
+		AccountId:  1,
+		Nonce:      1,
+		ValidUntil: 1 << 32,
+		Fee:        big.NewInt(0),
+		Target:     testExchangeAddr,
+		Token:      0,
+	}
+	forcedExit.Signature = *testUserKey.SignPoseidon(forcedExit.EncodeBi(testChainId))
+	batch = transaction.BatchTx{Txs: []transaction.ZionTx{forcedExit}}
+	batch.Signature, err = crypto.Sign(batch.HashEncodeData(testChainId), ethKey)
+	require.NoError(t, err)
+	batch.Signature[crypto.RecoveryIDOffset] += 27
+	ops, _, err := s.ExecuteBatch(batch, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), ops[0].(operation.ForcedExitOp).WithdrawAmount.Int64())
+}
+
+func TestExecuteProposedBlock(t *testing.T) {
+	s := newTestState()
+	deposit := transaction.PriorityTx{
+		Data: transaction.DepositTx{To: testExchangeAddr, Amount: big.NewInt(50), Token: 3},
+	}
+	proposed := block.ProposedBlock{
+		PriTxs: []transaction.ZionPriTx{deposit},
+		Txs: []transaction.ZionTx{
+			signedTransfer(0, testExchangeAddr, 1, 100, 0, 10),
+			// the second transfer fails, so the first one is reverted.
+			transaction.BatchTx{Txs: []transaction.ZionTx{
+				signedTransfer(1, testExchangeAddr, 1, 100, 1, 0),
+				signedTransfer(2, testExchangeAddr, 0, 2000, 0, 0),
+			}},
+			transaction.BatchTx{Txs: []transaction.ZionTx{
+				signedTransfer(1, testExchangeAddr, 1, 100, 1, 0),
+				signedTransfer(2, testOperatorAddr, 0, 0, 0, 20),
+			}},
+			signedTransfer(3, testExchangeAddr, 1, 100, 0, 10),
+		},
+	}
+	exeOps, err := s.ExecuteProposedBlock(proposed, 0, 0, 7)
+	require.NoError(t, err)
+	require.Len(t, exeOps, 7)
+
+	pri := exeOps[0].(block.ExecutedPriorityTx)
+	assert.Equal(t, deposit, pri.PriTx)
+	assert.Equal(t, 2, pri.Op.(operation.DepositOp).AccountId)
+	wants := []struct {
+		success bool
+		batchId int64
+	}{{true, 0}, {false, 1}, {false, 1}, {true, 2}, {true, 2}, {true, 0}}
+	for i, want := range wants {
+		exe := exeOps[i+1].(block.ExecutedTx)
+		assert.Equal(t, want.success, exe.Success, "tx %d", i)
+		assert.Equal(t, want.batchId, exe.BatchId, "tx %d", i)
+		assert.Equal(t, i+1, exe.BlockIndex)
+		assert.Equal(t, int64(7), exe.CreatedAt)
+		assert.Equal(t, want.success, exe.Op != nil, "tx %d", i)
+	}
+	assert.Equal(t, proposed.Txs[1].(transaction.BatchTx).Txs[1], exeOps[3].(block.ExecutedTx).Tx)
+	assert.Contains(t, exeOps[2].(block.ExecutedTx).FailReason, "tx 1 of the batch failed")
+	assert.Equal(t, 4, s.GetAccount(1).Nonce)
+	assert.Equal(t, int64(700), s.GetAccount(1).GetBalance(1).Int64())
+
+	// a batch executed on its own gives the operations of its txs.
+	op, err := s.ExecuteTx(transaction.BatchTx{Txs: []transaction.ZionTx{
+		signedTransfer(4, testExchangeAddr, 1, 100, 0, 10),
+	}}, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, op.(operation.BatchOp).Ops, 1)
+}
+
+func TestExecuteProposedBlockOrderExpired(t *testing.T) {
+	s := newTestState()
+	makerKey := babyjub.PrivateKey{9, 9}
+	makerId, maker := s.createAccount(testExchangeAddr)
+	maker.PublicKey = *makerKey.Public()
+	maker.UpdateBalance(2, big.NewInt(1000))
+
+	userOrder := transaction.Order{
+		AccountId: 1, TokenSell: 1, TokenBuy: 2,
+		PriceSell: big.NewInt(1), PriceBuy: big.NewInt(1), Amount: big.NewInt(100), ValidUntil: 1000,
+	}
+	userOrder.Signature = *testUserKey.SignPoseidon(userOrder.EncodeBi(testChainId))
+	makerOrder := transaction.Order{
+		AccountId: makerId, TokenSell: 2, TokenBuy: 1,
+		PriceSell: big.NewInt(1), PriceBuy: big.NewInt(1), Amount: big.NewInt(100), ValidUntil: 1 << 32,
+	}
+	makerOrder.Signature = *makerKey.SignPoseidon(makerOrder.EncodeBi(testChainId))
+	swap := transaction.SwapTx{
+		SubmitterId:      0,
+		SubmitterAddress: testOperatorAddr,
+		Orders:           [2]transaction.Order{userOrder, makerOrder},
+		Amounts:          [2]*big.Int{big.NewInt(10), big.NewInt(10)},
+		Fee:              big.NewInt(0),
+	}
+	operatorKey := babyjub.PrivateKey{7, 7}
+	s.GetAccount(0).PublicKey = *operatorKey.Public()
+	swap.Signature = *operatorKey.SignPoseidon(swap.EncodeBi(testChainId))
+	proposed := block.ProposedBlock{Txs: []transaction.ZionTx{swap}}
+
+	// the user order expires before the block.
+	exeOps, err := s.ExecuteProposedBlock(proposed, 0, 0, 1001)
+	require.NoError(t, err)
+	exe := exeOps[0].(block.ExecutedTx)
+	assert.False(t, exe.Success)
+	assert.Equal(t, ErrOrderExpired.Error(), exe.FailReason)
+	assert.Equal(t, int64(1001), exe.CreatedAt)
+
+	exeOps, err = s.ExecuteProposedBlock(proposed, 0, 0, 1000)
+	require.NoError(t, err)
+	assert.True(t, exeOps[0].(block.ExecutedTx).Success)
+}
+
+func TestAccountTree(t *testing.T) {
+	s := New(testChainId, common.Address{}, newTestTokens())
+	_, err := s.ExecutePriorityTx(transaction.PriorityTx{
+		Data: transaction.DepositTx{To: testOperatorAddr, Amount: big.NewInt(0), Token: 0},
+	})
+	require.NoError(t, err)
+	_, err = s.ExecutePriorityTx(transaction.PriorityTx{
+		Data: transaction.DepositTx{To: testUserAddr, Amount: big.NewInt(1000), Token: 1},
+	})
+	require.NoError(t, err)
+	s.setPublicKey(1, *testUserKey.Public())
+	// every leaf is the hash of its account.
+	checkLeaves := func() {
+		for id, acc := range s.Accounts {
+			assert.Equal(t, acc.Hash(), s.AccountTree.GetHash(id), "account %d", id)
+		}
+	}
+	checkLeaves()
+
+	root := s.RootHash()
+	_, err = s.ExecuteTx(signedTransfer(0, testExchangeAddr, 1, 100, 1, 10), 0, 0)
+	require.NoError(t, err)
+	checkLeaves()
+	assert.NotEqual(t, root, s.RootHash())
+
+	// a reverted batch leaves the root unchanged.
+	root = s.RootHash()
+	_, _, err = s.ExecuteBatch(transaction.BatchTx{Txs: []transaction.ZionTx{
+		signedTransfer(1, testOperatorAddr, 1, 100, 1, 0),
+		signedTransfer(2, testOperatorAddr, 1, 1000, 1, 0),
+	}}, 0, 0)
+	assert.Equal(t, ErrInsufficientBalance, err)
+	assert.Equal(t, root, s.RootHash())
+	checkLeaves()
+}
+
+func TestExecuteForcedExit(t *testing.T) {
+	s := newTestState()
+	targetId, target := s.createAccount(testExchangeAddr)
+	target.UpdateBalance(1, big.NewInt(300))
+
+	newTx := func(nonce int) transaction.ForcedExitTx {
+		tx := transaction.ForcedExitTx{
+			AccountId:  1,
+			Nonce:      nonce,
+			ValidUntil: 1 << 32,
+			FeeToken:   0,
+			Fee:        big.NewInt(10),
+			Target:     testExchangeAddr,
+			Token:      1,
+		}
+		tx.Signature = *testUserKey.SignPoseidon(tx.EncodeBi(testChainId))
+		return tx
+	}
+
+	op, w, err := s.ExecuteForcedExit(newTx(0), 0)
+	require.NoError(t, err)
+	assert.Equal(t, targetId, op.TargetAccountId)
+	assert.Equal(t, int64(300), op.WithdrawAmount.Int64())
+	assert.Equal(t, int64(0), s.GetAccount(targetId).GetBalance(1).Int64())
+	assert.Equal(t, int64(990), s.GetAccount(1).GetBalance(0).Int64())
+	assert.Equal(t, int64(10), s.GetAccount(0).GetBalance(0).Int64())
+	assert.Equal(t, int64(300), w.Witness.BalanceUpdateTo.Before.Balance.Int64())
+	assert.Equal(t, int64(0), w.Witness.BalanceUpdateTo.After.Balance.Int64())
+	assert.Equal(t, int64(10), w.Witness.BalanceUpdateOperator.After.Balance.Int64())
+
+	_, _, err = s.ExecuteForcedExit(newTx(1), 0)
+	assert.Equal(t, ErrEmptyBalance, err)
+
+	// the balance doesn't fit in the pubdata.
+	target.UpdateBalance(1, new(big.Int).Lsh(big.NewInt(1), 128))
+	_, _, err = s.ExecuteForcedExit(newTx(1), 0)
+	assert.Equal(t, ErrAmountTooBig, err)
+	assert.Equal(t, 1, s.GetAccount(1).Nonce)
+
+	target.PublicKey = *testUserKey.Public()
+	_, err = s.ExecuteTx(newTx(1), 0, 0)
+	assert.Equal(t, ErrTargetNotLocked, err)
+}
+
+func TestExecuteFullExit(t *testing.T) {
+	s := newTestState()
+
+	fullExit := func(accountId int, ethAddress common.Address) operation.FullExitOp {
+		op, err := s.ExecutePriorityTx(transaction.PriorityTx{
+			Data: transaction.FullExitTx{AccountId: accountId, EthAddress: ethAddress, Token: 1},
+		})
+		require.NoError(t, err)
+		return op.(operation.FullExitOp)
+	}
+
+	// not the owner of the account.
+	op := fullExit(1, testExchangeAddr)
+	assert.Equal(t, int64(0), op.WithdrawAmount.Int64())
+	assert.Equal(t, int64(1000), s.GetAccount(1).GetBalance(1).Int64())
+
+	// no such account.
+	op = fullExit(7, testUserAddr)
+	assert.Equal(t, int64(0), op.WithdrawAmount.Int64())
+
+	// the balance doesn't fit in the pubdata.
+	s.GetAccount(1).UpdateBalance(1, new(big.Int).Lsh(big.NewInt(1), 128))
+	op = fullExit(1, testUserAddr)
+	assert.Equal(t, int64(0), op.WithdrawAmount.Int64())
+	s.GetAccount(1).UpdateBalance(1, new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 128)))
+
+	op = fullExit(1, testUserAddr)
+	assert.Equal(t, int64(1000), op.WithdrawAmount.Int64())
+	assert.Equal(t, int64(0), s.GetAccount(1).GetBalance(1).Int64())
+	assert.Equal(t, int64(1000), s.GetAccount(1).GetBalance(0).Int64())
+	assert.Equal(t, 0, s.GetAccount(1).Nonce)
+}
+
+func TestExecuteDeposit(t *testing.T) {
+	s := newTestState()
+	op, err := s.ExecutePriorityTx(transaction.PriorityTx{
+		Data: transaction.DepositTx{To: testExchangeAddr, Amount: big.NewInt(50), Token: 3},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, op.(operation.DepositOp).AccountId)
+	assert.Equal(t, int64(50), s.GetAccount(2).GetBalance(3).Int64())
+}
+
+func TestExecuteSwap(t *testing.T) {
+	s := newTestState()
+	makerKey := babyjub.PrivateKey{9, 9}
+	makerId, maker := s.createAccount(testExchangeAddr)
+	maker.PublicKey = *makerKey.Public()
+	maker.UpdateBalance(2, big.NewInt(100000))
+
+	// the user sells up to 1000 of token 1 for at least 20 of token 2 each, the
+	// maker sells up to 50000 of token 2 for at most 25 of them for each token 1.
+	userOrder := transaction.Order{
+		AccountId: 1, TokenSell: 1, TokenBuy: 2,
+		PriceSell: big.NewInt(1), PriceBuy: big.NewInt(20), Amount: big.NewInt(1000), ValidUntil: 1 << 32,
+	}
+	userOrder.Signature = *testUserKey.SignPoseidon(userOrder.EncodeBi(testChainId))
+	makerOrder := transaction.Order{
+		AccountId: makerId, TokenSell: 2, TokenBuy: 1,
+		PriceSell: big.NewInt(25), PriceBuy: big.NewInt(1), Amount: big.NewInt(50000), ValidUntil: 1 << 32,
+	}
+	makerOrder.Signature = *makerKey.SignPoseidon(makerOrder.EncodeBi(testChainId))
+
+	matcherKey := babyjub.PrivateKey{7, 7}
+	matcherAddr := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	matcherId, matcher := s.createAccount(matcherAddr)
+	matcher.PublicKey = *matcherKey.Public()
+	matcher.UpdateBalance(2, big.NewInt(100))
+
+	swap := func(amount0, amount1 int64) transaction.SwapTx {
+		tx := transaction.SwapTx{
+			SubmitterId:      matcherId,
+			SubmitterAddress: matcherAddr,
+			Nonce:            s.GetAccount(matcherId).Nonce,
+			Orders:           [2]transaction.Order{userOrder, makerOrder},
+			Amounts:          [2]*big.Int{big.NewInt(amount0), big.NewInt(amount1)},
+			FeeToken:         2,
+			Fee:              big.NewInt(10),
+		}
+		tx.Signature = *matcherKey.SignPoseidon(tx.EncodeBi(testChainId))
+		return tx
+	}
+
+	// 600 for 15000 is within both prices, and fills the user order partially.
+	op, w, err := s.ExecuteSwap(swap(600, 15000), 0)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0), op.NonceMask)
+	assert.Equal(t, int64(400), s.GetAccount(1).GetBalance(1).Int64())
+	assert.Equal(t, int64(15000), s.GetAccount(1).GetBalance(2).Int64())
+	assert.Equal(t, int64(600), s.GetAccount(makerId).GetBalance(1).Int64())
+	assert.Equal(t, int64(100000-15000), s.GetAccount(makerId).GetBalance(2).Int64())
+	assert.Equal(t, int64(90), s.GetAccount(matcherId).GetBalance(2).Int64())
+	assert.Equal(t, int64(10), s.GetAccount(0).GetBalance(2).Int64())
+	assert.Equal(t, int64(600), s.GetOrderFill(userOrder).Int64())
+	assert.Equal(t, int64(15000), w.BalanceUpdateBuy[0].After.Balance.Int64())
+	assert.Equal(t, int64(600), w.BalanceUpdateBuy[1].After.Balance.Int64())
+	assert.Equal(t, 0, s.GetAccount(1).Nonce)
+
+	// the user order price is not met.
+	_, _, err = s.ExecuteSwap(swap(400, 7000), 0)
+	assert.Equal(t, ErrPriceMismatch, err)
+	// the maker order price is not met.
+	_, _, err = s.ExecuteSwap(swap(400, 11000), 0)
+	assert.Equal(t, ErrPriceMismatch, err)
+	// only 400 is left in the user order.
+	_, _, err = s.ExecuteSwap(swap(500, 12000), 0)
+	assert.Equal(t, ErrOrderOverfilled, err)
+
+	op, _, err = s.ExecuteSwap(swap(400, 9000), 0)
+	require.NoError(t, err)
+	assert.Equal(t, byte(1), op.NonceMask)
+	assert.Equal(t, 1, s.GetAccount(1).Nonce)
+	assert.Equal(t, int64(0), s.GetOrderFill(userOrder).Int64())
+
+	// the user order is done, its nonce is not the account nonce anymore.
+	_, _, err = s.ExecuteSwap(swap(1, 20), 0)
+	assert.Equal(t, ErrNonceMismatch, err)
+
+	selfSubmitted := swap(1, 20)
+	selfSubmitted.SubmitterId = makerId
+	_, _, err = s.ExecuteSwap(selfSubmitted, 0)
+	assert.Equal(t, ErrSubmitterIsOrderAccount, err)
+}
+
+func TestExecuteSwapRevertFill(t *testing.T) {
+	s := newTestState()
+	order := transaction.Order{AccountId: 1, Nonce: 0}
+	key := OrderKey{1, 0}
+
+	s.journal = newJournal(s)
+	s.journal.touchFill(s, key)
+	s.OrderFills[key] = big.NewInt(5)
+	s.journal.revert(s)
+	s.journal = nil
+	assert.Equal(t, int64(0), s.GetOrderFill(order).Int64())
+}
+
+func signedMintNFT(nonce int, recipient common.Address, contentHash common.Hash, fee int64) transaction.MintNFTTx {
+	tx := transaction.MintNFTTx{
+		CreatorId:      1,
+		CreatorAddress: testUserAddr,
+		ContentHash:    contentHash,
+		Recipient:      recipient,
+		FeeToken:       0,
+		Fee:            big.NewInt(fee),
+		Nonce:          nonce,
+		ValidUntil:     1 << 32,
+	}
+	tx.Signature = *testUserKey.SignPoseidon(tx.EncodeBi(testChainId))
+	return tx
+}
+
+func TestExecuteMintNFT(t *testing.T) {
+	s := newTestState()
+	rootBefore := s.RootHash()
+
+	op, err := s.ExecuteTx(signedMintNFT(0, testUserAddr, common.HexToHash("0x01"), 10), 0, 0)
+	require.NoError(t, err)
+	mintOp := op.(operation.MintNFTOp)
+	assert.Equal(t, account.MinNFTTokenId, mintOp.TokenId)
+	assert.Equal(t, 0, mintOp.Serial)
+	assert.Equal(t, 1, mintOp.RecipientId)
+	assert.Equal(t, int64(1), s.GetAccount(1).GetBalance(account.MinNFTTokenId).Int64())
+	assert.Equal(t, int64(990), s.GetAccount(1).GetBalance(0).Int64())
+	assert.Equal(t, int64(10), s.GetAccount(0).GetBalance(0).Int64())
+	assert.Equal(t, 1, s.GetAccount(1).Nonce)
+	assert.NotEqual(t, rootBefore, s.RootHash())
+
+	nft, ok := s.GetNFT(account.MinNFTTokenId)
+	require.True(t, ok)
+	assert.Equal(t, common.HexToHash("0x01"), nft.ContentHash)
+	assert.Equal(t, nft.Hash(), s.NFTTree.GetHash(0))
+
+	op, err = s.ExecuteTx(signedMintNFT(1, testOperatorAddr, common.HexToHash("0x02"), 0), 0, 0)
+	require.NoError(t, err)
+	mintOp = op.(operation.MintNFTOp)
+	assert.Equal(t, account.MinNFTTokenId+1, mintOp.TokenId)
+	assert.Equal(t, 1, mintOp.Serial)
+	assert.Equal(t, 0, mintOp.RecipientId)
+
+	// the recipient must exist, and the fee can't be paid with a NFT.
+	_, err = s.ExecuteTx(signedMintNFT(2, testExchangeAddr, common.HexToHash("0x03"), 0), 0, 0)
+	assert.Equal(t, ErrAccountNotFound, err)
+	_, err = s.ExecuteTx(signedTransfer(2, testExchangeAddr, 0, 10, account.MinNFTTokenId, 1), 0, 0)
+	assert.Equal(t, ErrInvalidFeeToken, err)
+}
+
+func TestExecuteTransferNFT(t *testing.T) {
+	s := newTestState()
+	_, err := s.ExecuteTx(signedMintNFT(0, testUserAddr, common.HexToHash("0x01"), 0), 0, 0)
+	require.NoError(t, err)
+
+	_, err = s.ExecuteTx(signedTransfer(1, testExchangeAddr, account.MinNFTTokenId, 2, 0, 0), 0, 0)
+	assert.Equal(t, ErrInvalidNFTAmount, err)
+	_, err = s.ExecuteTx(signedTransfer(1, testExchangeAddr, account.MinNFTTokenId+1, 1, 0, 0), 0, 0)
+	assert.Equal(t, ErrNFTNotFound, err)
+
+	op, err := s.ExecuteTx(signedTransfer(1, testExchangeAddr, account.MinNFTTokenId, 1, 0, 10), 0, 0)
+	require.NoError(t, err)
+	transferOp := op.(operation.TransferNFTOp)
+	assert.Equal(t, 2, transferOp.ToId)
+	assert.Equal(t, int64(0), s.GetAccount(1).GetBalance(account.MinNFTTokenId).Int64())
+	assert.Equal(t, int64(1), s.GetAccount(2).GetBalance(account.MinNFTTokenId).Int64())
+
+	_, err = s.ExecuteTx(signedTransfer(2, testExchangeAddr, account.MinNFTTokenId, 1, 0, 0), 0, 0)
+	assert.Equal(t, ErrInsufficientBalance, err)
+}
+
+func TestExecuteWithdrawAmountTooBig(t *testing.T) {
+	s := newTestState()
+	tx := transaction.WithdrawTx{
+		AccountId:  1,
+		Nonce:      0,
+		ValidUntil: 1 << 32,
+		FeeToken:   0,
+		Fee:        big.NewInt(10),
+		From:       testUserAddr,
+		To:         testUserAddr,
+		Token:      1,
+		Amount:     new(big.Int).Lsh(big.NewInt(1), 128),
+	}
+	tx.Signature = *testUserKey.SignPoseidon(tx.EncodeBi(testChainId))
+	_, err := s.ExecuteTx(tx, 0, 0)
+	assert.Equal(t, ErrAmountTooBig, err)
+}
+
+func TestExecuteWithdrawNFT(t *testing.T) {
+	s := newTestState()
+	_, err := s.ExecuteTx(signedMintNFT(0, testUserAddr, common.HexToHash("0x01"), 0), 0, 0)
+	require.NoError(t, err)
+
+	tx := transaction.WithdrawTx{
+		AccountId:  1,
+		Nonce:      1,
+		ValidUntil: 1 << 32,
+		FeeToken:   0,
+		Fee:        big.NewInt(10),
+		From:       testUserAddr,
+		To:         testUserAddr,
+		Token:      account.MinNFTTokenId,
+		Amount:     big.NewInt(1),
+	}
+	tx.Signature = *testUserKey.SignPoseidon(tx.EncodeBi(testChainId))
+	op, err := s.ExecuteTx(tx, 0, 0)
+	require.NoError(t, err)
+	withdrawOp := op.(operation.WithdrawNFTOp)
+	assert.Equal(t, 1, withdrawOp.CreatorId)
+	assert.Equal(t, testUserAddr, withdrawOp.CreatorAddress)
+	assert.Equal(t, 0, withdrawOp.Serial)
+	assert.Equal(t, common.HexToHash("0x01"), withdrawOp.ContentHash)
+	assert.Equal(t, int64(0), s.GetAccount(1).GetBalance(account.MinNFTTokenId).Int64())
+
+	// forced and full exits only support fungible tokens.
+	assert.Equal(t, ErrInvalidToken, checkFungibleTokens(s.Tokens, account.MinNFTTokenId, 0))
+}
+
+func TestExecuteBatchRevertNFT(t *testing.T) {
+	s := newTestState()
+	rootBefore := s.RootHash()
+
+	batch := transaction.BatchTx{Txs: []transaction.ZionTx{
+		signedMintNFT(0, testUserAddr, common.HexToHash("0x01"), 0),
+		signedTransfer(1, testExchangeAddr, account.MinNFTTokenId, 2, 0, 0),
+	}}
+	_, failed, err := s.ExecuteBatch(batch, 0, 0)
+	assert.Equal(t, ErrInvalidNFTAmount, err)
+	assert.Equal(t, 1, failed)
+
+	assert.Equal(t, rootBefore, s.RootHash())
+	assert.Equal(t, account.MinNFTTokenId, s.NextNFTTokenId)
+	assert.Empty(t, s.NFTs)
+	assert.Empty(t, s.NFTSerials)
+	assert.Equal(t, int64(0), s.GetAccount(1).GetBalance(account.MinNFTTokenId).Int64())
+
+	// the token id and the serial are assigned again.
+	op, err := s.ExecuteTx(signedMintNFT(0, testUserAddr, common.HexToHash("0x02"), 0), 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, account.MinNFTTokenId, op.(operation.MintNFTOp).TokenId)
+	assert.Equal(t, 0, op.(operation.MintNFTOp).Serial)
+}
+
+func TestCheckTokens(t *testing.T) {
+	s := newTestState()
+
+	_, err := s.ExecuteTx(signedTransfer(0, testExchangeAddr, 4, 0, 0, 0), 0, 0)
+	assert.Equal(t, ErrInvalidToken, err)
+	_, err = s.ExecuteTx(signedTransfer(0, testExchangeAddr, 0, 10, 3, 0), 0, 0)
+	assert.Equal(t, ErrInvalidFeeToken, err)
+	assert.Equal(t, ErrInvalidFeeToken, CheckTokens(s.Tokens, transaction.BatchTx{Txs: []transaction.ZionTx{
+		signedTransfer(0, testExchangeAddr, 0, 10, 0, 0),
+		signedTransfer(1, testExchangeAddr, 0, 10, 3, 0),
+	}}))
+
+	require.NoError(t, s.Tokens.SetFeeEligible(3, true))
+	assert.NoError(t, CheckTokens(s.Tokens, signedTransfer(0, testExchangeAddr, 0, 10, 3, 0)))
+}
+
+func TestExecuteNewToken(t *testing.T) {
+	s := newTestState()
+	newToken := transaction.NewTokenTx{Id: 4, Address: common.HexToAddress("0x04"), Symbol: "WBTC", Decimals: 8}
+
+	op, err := s.ExecutePriorityTx(transaction.PriorityTx{Data: newToken})
+	require.NoError(t, err)
+	assert.Nil(t, op)
+	registered, ok := s.Tokens.Get(4)
+	require.True(t, ok)
+	assert.Equal(t, "WBTC", registered.Symbol)
+	assert.False(t, registered.FeeEligible)
+
+	// the event may be replayed, but not conflict with the registry.
+	_, err = s.ExecutePriorityTx(transaction.PriorityTx{Data: newToken})
+	assert.NoError(t, err)
+	// a conflicting token is not registered, it's a noop.
+	newToken.Symbol = "BTC"
+	op, err = s.ExecutePriorityTx(transaction.PriorityTx{Data: newToken})
+	require.NoError(t, err)
+	assert.Equal(t, operation.NoopOp{}, op)
+	registered, _ = s.Tokens.Get(4)
+	assert.Equal(t, "WBTC", registered.Symbol)
+}
+
+func TestExecuteProposedBlockNewTokenConflict(t *testing.T) {
+	s := newTestState()
+	registered, _ := s.Tokens.Get(3)
+	deposit := transaction.PriorityTx{
+		Data: transaction.DepositTx{To: testExchangeAddr, Amount: big.NewInt(50), Token: 3},
+	}
+	newToken := transaction.PriorityTx{
+		Data: transaction.NewTokenTx{Id: 3, Address: common.HexToAddress("0x99"), Symbol: "BAD", Decimals: 18},
+	}
+	exeOps, err := s.ExecuteProposedBlock(block.ProposedBlock{
+		PriTxs: []transaction.ZionPriTx{deposit, newToken},
+	}, 0, 0, 7)
+	require.NoError(t, err)
+	require.Len(t, exeOps, 2)
+
+	dep := exeOps[0].(block.ExecutedPriorityTx)
+	assert.Equal(t, 2, dep.Op.(operation.DepositOp).AccountId)
+	assert.Empty(t, dep.Conflict)
+	assert.Equal(t, int64(50), s.GetAccount(2).GetBalance(3).Int64())
+
+	conflict := exeOps[1].(block.ExecutedPriorityTx)
+	assert.Equal(t, newToken, conflict.PriTx)
+	assert.Equal(t, operation.NoopOp{}, conflict.Op)
+	assert.Equal(t, 1, conflict.BlockIndex)
+	assert.Equal(t, token.ErrTokenIdExists.Error(), conflict.Conflict)
+	current, _ := s.Tokens.Get(3)
+	assert.Equal(t, registered, current)
+}
@@ -0,0 +1,123 @@
+package state
+
+import (
+	"math/big"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+	"github.com/vivijj/ziongo/types/operation"
+	"github.com/vivijj/ziongo/types/transaction"
+	"github.com/vivijj/ziongo/types/witness"
+)
+
+// ExecuteSwap executes the swap and returns its operation with its combined
+// witness.  On error the state is left unchanged.
+func (s *State) ExecuteSwap(tx transaction.SwapTx, operatorId int) (operation.SwapOp, witness.SwapWitness, error) {
+	if err := s.checkSwap(tx, operatorId); err != nil {
+		return operation.SwapOp{}, witness.SwapWitness{}, err
+	}
+
+	w := witness.SwapWitness{
+		SignatureSubmitter: &tx.Signature,
+		SignatureOrders:    [2]*babyjub.Signature{&tx.Orders[0].Signature, &tx.Orders[1].Signature},
+	}
+	for i, order := range tx.Orders {
+		other := tx.Orders[1-i]
+		w.BalanceUpdateSell[i] = s.updateBalance(order.AccountId, order.TokenSell, new(big.Int).Neg(tx.Amounts[i]))
+		w.BalanceUpdateBuy[1-i] = s.updateBalance(other.AccountId, order.TokenSell, tx.Amounts[i])
+	}
+	w.BalanceUpdateFee, w.BalanceUpdateOperator = s.collectFee(tx.SubmitterId, operatorId, tx.FeeToken, tx.Fee)
+
+	s.incrementNonce(tx.SubmitterId)
+	var nonceMask byte
+	for i, order := range tx.Orders {
+		key := OrderKey{order.AccountId, order.Nonce}
+		fill := new(big.Int).Add(s.GetOrderFill(order), tx.Amounts[i])
+		s.journal.touchFill(s, key)
+		if fill.Cmp(order.Amount) < 0 {
+			s.OrderFills[key] = fill
+			continue
+		}
+		delete(s.OrderFills, key)
+		nonceMask |= 1 << i
+		s.incrementNonce(order.AccountId)
+	}
+
+	w.AccountMerkleRoot = string(s.AccountTree.RootHash())
+	return operation.SwapOp{Tx: tx, NonceMask: nonceMask}, w, nil
+}
+
+// checkSwap checks the swap and its orders against the state.
+func (s *State) checkSwap(tx transaction.SwapTx, operatorId int) error {
+	if err := CheckPackable(tx); err != nil {
+		return err
+	}
+	o0, o1 := tx.Orders[0], tx.Orders[1]
+	if o0.AccountId == o1.AccountId || o0.TokenSell == o0.TokenBuy ||
+		o0.TokenSell != o1.TokenBuy || o1.TokenSell != o0.TokenBuy {
+		return ErrOrdersMismatch
+	}
+	// the nonce of the submitter is incremented by every swap, which would cancel
+	// its own order while it's partially filled.
+	if tx.SubmitterId == o0.AccountId || tx.SubmitterId == o1.AccountId {
+		return ErrSubmitterIsOrderAccount
+	}
+	for i, order := range tx.Orders {
+		if err := checkFungibleTokens(s.Tokens, order.TokenSell, tx.FeeToken); err != nil {
+			return err
+		}
+		if !isPositive(tx.Amounts[i]) || !isPositive(order.PriceSell) ||
+			!isPositive(order.PriceBuy) || !isPositive(order.Amount) {
+			return ErrInvalidAmount
+		}
+	}
+
+	submitter, err := s.checkInitiator(tx.SubmitterId, tx.SubmitterAddress, tx.Nonce)
+	if err != nil {
+		return err
+	}
+	if err := s.checkL2Signature(submitter, tx.VerifySignature); err != nil {
+		return err
+	}
+	for i, order := range tx.Orders {
+		acc := s.GetAccount(order.AccountId)
+		if acc == nil {
+			return ErrAccountNotFound
+		}
+		if acc.Nonce != order.Nonce {
+			return ErrNonceMismatch
+		}
+		if err := s.checkL2Signature(acc, order.VerifySignature); err != nil {
+			return err
+		}
+		if order.ValidUntil < s.Timestamp {
+			return ErrOrderExpired
+		}
+
+		// Amounts[i] / Amounts[1-i] <= PriceSell / PriceBuy
+		sold := new(big.Int).Mul(tx.Amounts[i], order.PriceBuy)
+		bought := new(big.Int).Mul(tx.Amounts[1-i], order.PriceSell)
+		if sold.Cmp(bought) > 0 {
+			return ErrPriceMismatch
+		}
+		if new(big.Int).Add(s.GetOrderFill(order), tx.Amounts[i]).Cmp(order.Amount) > 0 {
+			return ErrOrderOverfilled
+		}
+	}
+
+	for i, order := range tx.Orders {
+		if s.GetAccount(order.AccountId).GetBalance(order.TokenSell).Cmp(tx.Amounts[i]) < 0 {
+			return ErrInsufficientBalance
+		}
+	}
+	if submitter.GetBalance(tx.FeeToken).Cmp(tx.Fee) < 0 {
+		return ErrInsufficientBalance
+	}
+	if s.GetAccount(operatorId) == nil {
+		return ErrOperatorNotFound
+	}
+	return nil
+}
+
+func isPositive(v *big.Int) bool {
+	return v != nil && v.Sign() > 0
+}
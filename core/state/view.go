@@ -0,0 +1,53 @@
+package state
+
+import (
+	"sync"
+
+	"github.com/vivijj/ziongo/types/account"
+	"github.com/vivijj/ziongo/types/transaction"
+)
+
+// View is a read-only view of the committed state, safe for concurrent use. The
+// blocks are executed on the state by Update, so the view never shows a block
+// partially executed.
+type View struct {
+	mu sync.RWMutex
+	s  *State
+}
+
+func NewView(s *State) *View {
+	return &View{s: s}
+}
+
+// Update runs f with the exclusive access to the state, to execute and commit a
+// block.
+func (v *View) Update(f func(s *State)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	f(v.s)
+}
+
+// GetAccount returns a copy of the account of the id, or nil if it doesn't exist.
+func (v *View) GetAccount(id int) *account.Account {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	acc := v.s.GetAccount(id)
+	if acc == nil {
+		return nil
+	}
+	return acc.Copy()
+}
+
+// GetNFT returns the record of the NFT of the token id, and whether it exists.
+func (v *View) GetNFT(tokenId int) (account.NFT, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.s.GetNFT(tokenId)
+}
+
+// AuthDomain returns the domain of the signatures verified by the state.
+func (v *View) AuthDomain() transaction.AuthDomain {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return transaction.AuthDomain{ChainId: v.s.ChainId, VerifyingContract: v.s.ContractAddr}
+}
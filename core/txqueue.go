@@ -0,0 +1,262 @@
+package core
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vivijj/ziongo/types/transaction"
+)
+
+// queuedTx is a tx of the mempool, queued for its initiator account. A BatchTx is
+// queued for the initiator of its first tx, and it uses every nonce of that
+// account in the batch.
+type queuedTx struct {
+	tx        transaction.ZionTx
+	hash      common.Hash
+	accountId int
+	nonce     int
+	// nextNonce is the nonce of the account once the tx is executed.
+	nextNonce int
+	// fee is the value in USD of the fees paid by the tx.
+	fee *big.Rat
+	// size is the number of txs of the block taken by the tx.
+	size int
+}
+
+// feeRate returns the value of the fees paid by the tx for each tx of the block it
+// takes, so a batch is compared fairly with the single txs.
+func (qt queuedTx) feeRate() *big.Rat {
+	return new(big.Rat).Quo(qt.fee, big.NewRat(int64(qt.size), 1))
+}
+
+// txsCount is the number of txs of the block taken by the tx.
+func txsCount(tx transaction.ZionTx) int {
+	if batch, ok := tx.(transaction.BatchTx); ok {
+		return len(batch.Txs)
+	}
+	return 1
+}
+
+// txNonce returns the initiator account of the tx and its nonce.
+func txNonce(tx transaction.ZionTx) (accountId int, nonce int, ok bool) {
+	switch t := tx.(type) {
+	case transaction.TransferTx:
+		return t.AccountId, t.Nonce, true
+	case transaction.WithdrawTx:
+		return t.AccountId, t.Nonce, true
+	case transaction.PubkeyUpdateTx:
+		return t.AccountId, t.Nonce, true
+	case transaction.ForcedExitTx:
+		return t.AccountId, t.Nonce, true
+	case transaction.SwapTx:
+		return t.SubmitterId, t.Nonce, true
+	case transaction.MintNFTTx:
+		return t.CreatorId, t.Nonce, true
+	}
+	return 0, 0, false
+}
+
+// newQueuedTx returns the tx queued for its initiator. The txs of a batch from the
+// initiator of the first one must have consecutive nonces.
+func newQueuedTx(tx transaction.ZionTx) (queuedTx, error) {
+	qt := queuedTx{tx: tx, hash: transaction.ZionTxHash(tx), size: txsCount(tx)}
+	batch, ok := tx.(transaction.BatchTx)
+	if !ok {
+		accountId, nonce, ok := txNonce(tx)
+		if !ok {
+			return queuedTx{}, ErrNoInitiator
+		}
+		qt.accountId, qt.nonce, qt.nextNonce = accountId, nonce, nonce+1
+		return qt, nil
+	}
+
+	accountId, nonce, ok := txNonce(batch.Txs[0])
+	if !ok {
+		return queuedTx{}, ErrNoInitiator
+	}
+	qt.accountId, qt.nonce, qt.nextNonce = accountId, nonce, nonce
+	for _, inner := range batch.Txs {
+		if id, n, ok := txNonce(inner); ok && id == accountId {
+			if n != qt.nextNonce {
+				return queuedTx{}, ErrInvalidNonces
+			}
+			qt.nextNonce++
+		}
+	}
+	return qt, nil
+}
+
+// accountQueue is the queue of the txs of an account, by nonce. The ready txs
+// follow each other from the committed nonce of the account, so they may be
+// proposed in this order, while the pending txs are after a missing nonce.
+type accountQueue struct {
+	// start is the nonce of the first ready tx, the txs before it are executed or
+	// in a proposed block.
+	start int
+	// nonce is the nonce of the account once its ready txs are executed.
+	nonce   int
+	ready   []queuedTx
+	pending map[int]queuedTx
+	// size is the number of txs of the blocks taken by the queued txs.
+	size int
+}
+
+func newAccountQueue(nonce int) *accountQueue {
+	return &accountQueue{start: nonce, nonce: nonce, pending: make(map[int]queuedTx)}
+}
+
+func (q *accountQueue) len() int {
+	return len(q.ready) + len(q.pending)
+}
+
+// find returns the queued tx of the nonce.
+func (q *accountQueue) find(nonce int) (queuedTx, bool) {
+	if qt, ok := q.pending[nonce]; ok {
+		return qt, true
+	}
+	for _, qt := range q.ready {
+		if qt.nonce == nonce {
+			return qt, true
+		}
+	}
+	return queuedTx{}, false
+}
+
+// replace replaces the queued tx of the same nonces by qt.
+func (q *accountQueue) replace(qt queuedTx) {
+	q.size += qt.size
+	if old, ok := q.pending[qt.nonce]; ok {
+		q.size -= old.size
+		q.pending[qt.nonce] = qt
+		return
+	}
+	for i, old := range q.ready {
+		if old.nonce == qt.nonce {
+			q.size -= old.size
+			q.ready[i] = qt
+			return
+		}
+	}
+}
+
+// last returns the queued tx of the highest nonce, the queue must have one.
+func (q *accountQueue) last() queuedTx {
+	if len(q.pending) == 0 {
+		return q.ready[len(q.ready)-1]
+	}
+	var last queuedTx
+	for _, qt := range q.pending {
+		if qt.nonce >= last.nonce {
+			last = qt
+		}
+	}
+	return last
+}
+
+// removeLast removes the queued tx of the highest nonce, so the others stay in
+// order, and returns it.
+func (q *accountQueue) removeLast() queuedTx {
+	last := q.last()
+	q.size -= last.size
+	if _, ok := q.pending[last.nonce]; ok {
+		delete(q.pending, last.nonce)
+		return last
+	}
+	q.ready = q.ready[:len(q.ready)-1]
+	q.nonce = last.nonce
+	return last
+}
+
+// has reports whether a queued tx uses the nonce.
+func (q *accountQueue) has(nonce int) bool {
+	for _, qt := range q.ready {
+		if nonce >= qt.nonce && nonce < qt.nextNonce {
+			return true
+		}
+	}
+	for _, qt := range q.pending {
+		if nonce >= qt.nonce && nonce < qt.nextNonce {
+			return true
+		}
+	}
+	return false
+}
+
+// check checks that the tx may be queued, its nonces must be free.
+func (q *accountQueue) check(qt queuedTx) error {
+	if qt.nonce < q.start {
+		return ErrNonceTooLow
+	}
+	for n := qt.nonce; n < qt.nextNonce; n++ {
+		if q.has(n) {
+			return ErrNonceQueued
+		}
+	}
+	return nil
+}
+
+// add queues the tx, which is ready if it follows the ready txs.
+func (q *accountQueue) add(qt queuedTx) error {
+	if err := q.check(qt); err != nil {
+		return err
+	}
+	q.pending[qt.nonce] = qt
+	q.size += qt.size
+	q.promote()
+	return nil
+}
+
+// promote moves the pending txs following the ready txs to them.
+func (q *accountQueue) promote() {
+	for {
+		qt, ok := q.pending[q.nonce]
+		if !ok {
+			return
+		}
+		delete(q.pending, q.nonce)
+		q.ready = append(q.ready, qt)
+		q.nonce = qt.nextNonce
+	}
+}
+
+// popReady removes the first ready tx, the queue must have one.
+func (q *accountQueue) popReady() queuedTx {
+	qt := q.ready[0]
+	q.ready = q.ready[1:]
+	q.start = qt.nextNonce
+	q.size -= qt.size
+	return qt
+}
+
+// reset queues the txs again from the committed nonce of the account, the txs
+// before it are dropped since their nonces are used, and returned.
+func (q *accountQueue) reset(nonce int) []queuedTx {
+	for _, qt := range q.ready {
+		q.pending[qt.nonce] = qt
+	}
+	q.ready = nil
+	q.start, q.nonce = nonce, nonce
+	var dropped []queuedTx
+	for n, qt := range q.pending {
+		if n < nonce {
+			delete(q.pending, n)
+			q.size -= qt.size
+			dropped = append(dropped, qt)
+		}
+	}
+	q.promote()
+	return dropped
+}
+
+// txs returns the queued txs sorted by nonce.
+func (q *accountQueue) txs() []queuedTx {
+	txs := append([]queuedTx{}, q.ready...)
+	pending := make([]queuedTx, 0, len(q.pending))
+	for _, qt := range q.pending {
+		pending = append(pending, qt)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].nonce < pending[j].nonce })
+	return append(txs, pending...)
+}
@@ -0,0 +1,450 @@
+package core
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vivijj/ziongo/core/state"
+	"github.com/vivijj/ziongo/crypto/babyjub"
+	"github.com/vivijj/ziongo/types/account"
+	"github.com/vivijj/ziongo/types/transaction"
+)
+
+// keyUpdate is the public key set by a pubkey update of the nonce.
+type keyUpdate struct {
+	nonce int
+	key   babyjub.PublicKey
+}
+
+// sigCheck is a check of a signature of a tx made with key, the zero key when the
+// signature is not an EdDSA one.
+type sigCheck struct {
+	key babyjub.PublicKey
+	// msg and sig are the message and the EdDSA signature made with key, which
+	// are checked in a batch. check is run instead when sig is nil.
+	msg   *big.Int
+	sig   *babyjub.Signature
+	check func() error
+	err   error
+}
+
+// run checks the signature on its own.
+func (c *sigCheck) run() error {
+	if c.sig == nil {
+		return c.check()
+	}
+	if c.key.VerifyPoseidonStrict(c.msg, c.sig) != nil {
+		return state.ErrInvalidSignature
+	}
+	return nil
+}
+
+// signedMsg is a tx or an order signed with EdDSA.
+type signedMsg interface {
+	EncodeBi(chainId int) *big.Int
+}
+
+// validator checks the txs against the committed state, along with the txs
+// already queued or proposed: the balances left to the accounts are their
+// committed balances less what those txs spend from them, and the public keys set
+// by their pubkey updates sign the txs of the next nonces.
+//
+// The signatures are checked without the lock of the mempool: a first validator
+// collects the signature checks of the tx, which are run, and a second one uses
+// their results, unless a key has changed in between.
+type validator struct {
+	ms *MempoolState
+	// replaced is the queued tx replaced by the tx checked, if any.
+	replaced *queuedTx
+	domain   transaction.AuthDomain
+	now      int
+	accounts map[int]*account.Account
+	keys     map[int][]keyUpdate
+	// sigs are the signature checks of the tx in the order they are made, only
+	// recorded when collect is set. nextSig is the index of the next one.
+	sigs    []sigCheck
+	nextSig int
+	collect bool
+}
+
+func newValidator(ms *MempoolState, replaced *queuedTx) *validator {
+	return &validator{
+		ms:       ms,
+		replaced: replaced,
+		domain:   ms.State.AuthDomain(),
+		now:      ms.now(),
+		accounts: make(map[int]*account.Account),
+		keys:     make(map[int][]keyUpdate),
+	}
+}
+
+// account returns the account of the id after the queued and proposed txs which
+// spend from it, or nil if it doesn't exist.
+func (v *validator) account(id int) *account.Account {
+	if acc, ok := v.accounts[id]; ok {
+		return acc
+	}
+	acc := v.ms.State.GetAccount(id)
+	v.accounts[id] = acc
+	if acc == nil {
+		return nil
+	}
+	for hash, tx := range v.ms.spenders[id] {
+		if v.replaced != nil && v.replaced.hash == hash {
+			continue
+		}
+		v.spend(id, tx)
+		v.recordKeys(id, tx)
+	}
+	return acc
+}
+
+// spend takes what the tx spends from the balances of the account.
+func (v *validator) spend(id int, tx transaction.ZionTx) {
+	txSpending(tx, func(accountId int, tokenId int, amount *big.Int) {
+		if accountId == id && amount != nil {
+			v.accounts[id].Balances[tokenId] = new(big.Int).Sub(v.accounts[id].GetBalance(tokenId), amount)
+		}
+	})
+}
+
+// recordKeys records the public keys set for the account by the tx.
+func (v *validator) recordKeys(id int, tx transaction.ZionTx) {
+	txs := []transaction.ZionTx{tx}
+	if batch, ok := tx.(transaction.BatchTx); ok {
+		txs = batch.Txs
+	}
+	for _, inner := range txs {
+		if t, ok := inner.(transaction.PubkeyUpdateTx); ok && t.AccountId == id {
+			v.keys[id] = append(v.keys[id], keyUpdate{nonce: t.Nonce, key: t.PubKey})
+		}
+	}
+}
+
+// publicKey returns the public key of the account for its tx of the nonce, which
+// is set by the last pubkey update before it.
+func (v *validator) publicKey(id int, nonce int) (babyjub.PublicKey, bool) {
+	acc := v.account(id)
+	key, last := acc.PublicKey, -1
+	for _, u := range v.keys[id] {
+		if u.nonce < nonce && u.nonce > last {
+			key, last = u.key, u.nonce
+		}
+	}
+	return key, key.X != nil && key.Y != nil
+}
+
+// checkInitiator checks the account that initiates a tx of the nonce.
+func (v *validator) checkInitiator(id int, nonce int) (*account.Account, error) {
+	acc := v.account(id)
+	if acc == nil {
+		return nil, state.ErrAccountNotFound
+	}
+	if nonce < acc.Nonce {
+		return nil, ErrNonceTooLow
+	}
+	return acc, nil
+}
+
+// checkSignature checks the signature sig of the tx or order of the nonce by the
+// account.
+func (v *validator) checkSignature(id int, nonce int, signed signedMsg, sig *babyjub.Signature) error {
+	key, ok := v.publicKey(id, nonce)
+	if !ok {
+		return state.ErrFromAccountLocked
+	}
+	return v.verify(sigCheck{key: key, msg: signed.EncodeBi(v.domain.ChainId), sig: sig})
+}
+
+// verify runs the check of a signature, or only records it when the checks are
+// collected. The result of the collected check is used if it was made with the
+// same key.
+func (v *validator) verify(c sigCheck) error {
+	i := v.nextSig
+	v.nextSig++
+	if v.collect {
+		v.sigs = append(v.sigs, c)
+		return nil
+	}
+	if i < len(v.sigs) && sameKey(v.sigs[i].key, c.key) {
+		return v.sigs[i].err
+	}
+	return c.run()
+}
+
+func sameKey(a babyjub.PublicKey, b babyjub.PublicKey) bool {
+	if a.X == nil || b.X == nil {
+		return a.X == nil && b.X == nil
+	}
+	return a.X.Cmp(b.X) == 0 && a.Y.Cmp(b.Y) == 0
+}
+
+// checkL2Tx checks the initiator of a tx signed on L2, its address and signature.
+func (v *validator) checkL2Tx(
+	id int,
+	addr common.Address,
+	nonce int,
+	signed signedMsg,
+	sig *babyjub.Signature,
+) error {
+	acc, err := v.checkInitiator(id, nonce)
+	if err != nil {
+		return err
+	}
+	if acc.Address != addr {
+		return state.ErrAccountIncorrect
+	}
+	return v.checkSignature(id, nonce, signed, sig)
+}
+
+// checkNFT checks that the NFT exists and that the amount moved is exactly 1, for
+// a NFT token id.
+func (v *validator) checkNFT(tokenId int, amount *big.Int) error {
+	if !account.IsNFT(tokenId) {
+		return nil
+	}
+	if amount == nil || amount.Cmp(big.NewInt(1)) != 0 {
+		return state.ErrInvalidNFTAmount
+	}
+	if _, ok := v.ms.State.GetNFT(tokenId); !ok {
+		return state.ErrNFTNotFound
+	}
+	return nil
+}
+
+// check checks the tx, which is not a batch, and takes what it spends from the
+// balances.
+func (v *validator) check(tx transaction.ZionTx) error {
+	if validUntil, ok := txValidUntil(tx); ok && validUntil < v.now {
+		return ErrTxExpired
+	}
+	var err error
+	switch t := tx.(type) {
+	case transaction.TransferTx:
+		if err = v.checkL2Tx(t.AccountId, t.From, t.Nonce, t, &t.Signature); err == nil {
+			err = v.checkNFT(t.Token, t.Amount)
+		}
+	case transaction.WithdrawTx:
+		if err = v.checkL2Tx(t.AccountId, t.From, t.Nonce, t, &t.Signature); err == nil {
+			err = v.checkNFT(t.Token, t.Amount)
+		}
+	case transaction.ForcedExitTx:
+		if _, err = v.checkInitiator(t.AccountId, t.Nonce); err == nil {
+			err = v.checkSignature(t.AccountId, t.Nonce, t, &t.Signature)
+		}
+	case transaction.MintNFTTx:
+		err = v.checkL2Tx(t.CreatorId, t.CreatorAddress, t.Nonce, t, &t.Signature)
+	case transaction.PubkeyUpdateTx:
+		err = v.checkPubkeyUpdate(t)
+	case transaction.SwapTx:
+		err = v.checkSwap(t)
+	default:
+		err = state.ErrInvalidTxType
+	}
+	if err != nil {
+		return err
+	}
+	return v.checkBalances(tx)
+}
+
+func (v *validator) checkPubkeyUpdate(tx transaction.PubkeyUpdateTx) error {
+	acc, err := v.checkInitiator(tx.AccountId, tx.Nonce)
+	if err != nil {
+		return err
+	}
+	if acc.Address != tx.Account {
+		return state.ErrAccountIncorrect
+	}
+	if _, err := tx.Encode(); err != nil {
+		return state.ErrInvalidPubKey
+	}
+	domain := v.domain
+	err = v.verify(sigCheck{check: func() error {
+		if tx.VerifyAuthData(domain) != nil {
+			return state.ErrInvalidAuthData
+		}
+		return nil
+	}})
+	if err != nil {
+		return err
+	}
+	v.recordKeys(tx.AccountId, tx)
+	return nil
+}
+
+func (v *validator) checkSwap(tx transaction.SwapTx) error {
+	if err := v.checkL2Tx(tx.SubmitterId, tx.SubmitterAddress, tx.Nonce, tx, &tx.Signature); err != nil {
+		return err
+	}
+	for i := range tx.Orders {
+		order := &tx.Orders[i]
+		if order.ValidUntil < v.now {
+			return state.ErrOrderExpired
+		}
+		// the order is executed on the nonce of the account, like in the state.
+		acc := v.account(order.AccountId)
+		if acc == nil {
+			return state.ErrAccountNotFound
+		}
+		if order.Nonce != acc.Nonce {
+			return state.ErrNonceMismatch
+		}
+		if err := v.checkSignature(order.AccountId, order.Nonce, order, &order.Signature); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBalances takes what the tx spends from the balances, which must stay
+// positive.
+func (v *validator) checkBalances(tx transaction.ZionTx) error {
+	var err error
+	txSpending(tx, func(accountId int, tokenId int, amount *big.Int) {
+		acc := v.account(accountId)
+		if acc == nil || amount == nil {
+			return
+		}
+		balance := new(big.Int).Sub(acc.GetBalance(tokenId), amount)
+		acc.Balances[tokenId] = balance
+		if balance.Sign() < 0 {
+			err = state.ErrInsufficientBalance
+		}
+	})
+	return err
+}
+
+// txValidUntil returns the time until which the tx is valid, a swap is only
+// limited by its orders.
+func txValidUntil(tx transaction.ZionTx) (int, bool) {
+	switch t := tx.(type) {
+	case transaction.TransferTx:
+		return t.ValidUntil, true
+	case transaction.WithdrawTx:
+		return t.ValidUntil, true
+	case transaction.PubkeyUpdateTx:
+		return t.ValidUntil, true
+	case transaction.ForcedExitTx:
+		return t.ValidUntil, true
+	case transaction.MintNFTTx:
+		return t.ValidUntil, true
+	}
+	return 0, false
+}
+
+// txSpending calls spend with every amount spent by an account in the tx.
+func txSpending(tx transaction.ZionTx, spend func(accountId int, tokenId int, amount *big.Int)) {
+	switch t := tx.(type) {
+	case transaction.TransferTx:
+		spend(t.AccountId, t.Token, t.Amount)
+		spend(t.AccountId, t.FeeToken, t.Fee)
+	case transaction.WithdrawTx:
+		spend(t.AccountId, t.Token, t.Amount)
+		spend(t.AccountId, t.FeeToken, t.Fee)
+	case transaction.PubkeyUpdateTx:
+		spend(t.AccountId, t.FeeToken, t.Fee)
+	case transaction.ForcedExitTx:
+		spend(t.AccountId, t.FeeToken, t.Fee)
+	case transaction.MintNFTTx:
+		spend(t.CreatorId, t.FeeToken, t.Fee)
+	case transaction.SwapTx:
+		for i, order := range t.Orders {
+			spend(order.AccountId, order.TokenSell, t.Amounts[i])
+		}
+		spend(t.SubmitterId, t.FeeToken, t.Fee)
+	case transaction.BatchTx:
+		for _, inner := range t.Txs {
+			txSpending(inner, spend)
+		}
+	}
+}
+
+// validate checks the tx. The signature of a batch is checked first, then its txs
+// in order.
+func (v *validator) validate(tx transaction.ZionTx) error {
+	batch, ok := tx.(transaction.BatchTx)
+	if !ok {
+		if err := v.check(tx); err != nil {
+			return &TxError{Index: -1, Err: err}
+		}
+		return nil
+	}
+	if len(batch.Signature) != 0 {
+		chainId := v.domain.ChainId
+		// the addresses of the initiators of the forced exits are resolved here,
+		// as the check may run without the lock.
+		addrs := make(map[int]common.Address)
+		for _, inner := range batch.Txs {
+			if t, ok := inner.(transaction.ForcedExitTx); ok {
+				if acc := v.account(t.AccountId); acc != nil {
+					addrs[t.AccountId] = acc.Address
+				}
+			}
+		}
+		accountAddr := func(id int) (common.Address, bool) {
+			addr, ok := addrs[id]
+			return addr, ok
+		}
+		err := v.verify(sigCheck{check: func() error {
+			if batch.VerifySignature(chainId, accountAddr) != nil {
+				return state.ErrInvalidBatchSignature
+			}
+			return nil
+		}})
+		if err != nil {
+			return &TxError{Index: -1, Err: err}
+		}
+	}
+	for i, inner := range batch.Txs {
+		if err := v.check(inner); err != nil {
+			return &TxError{Index: i, Err: err}
+		}
+	}
+	return nil
+}
+
+// collectSigChecks returns the signature checks of the tx qt, to be run without
+// the lock of the mempool and given to validateTx.
+func (ms *MempoolState) collectSigChecks(qt queuedTx) []sigCheck {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	v := newValidator(ms, ms.replacedBy(qt))
+	v.collect = true
+	// the errors are only known once the signatures are checked.
+	_ = v.validate(qt.tx)
+	return v.sigs
+}
+
+// runSigChecks runs the signature checks, the EdDSA ones in a single batch which
+// finds out the invalid ones.
+func runSigChecks(sigs []sigCheck) {
+	var batch []int
+	var pks []*babyjub.PublicKey
+	var msgs []*big.Int
+	var eddsaSigs []*babyjub.Signature
+	for i := range sigs {
+		if sigs[i].sig == nil {
+			sigs[i].err = sigs[i].check()
+			continue
+		}
+		sigs[i].err = nil
+		batch = append(batch, i)
+		pks = append(pks, &sigs[i].key)
+		msgs = append(msgs, sigs[i].msg)
+		eddsaSigs = append(eddsaSigs, sigs[i].sig)
+	}
+	_, invalid := babyjub.VerifyPoseidonStrictBatch(pks, msgs, eddsaSigs)
+	for _, j := range invalid {
+		sigs[batch[j]].err = state.ErrInvalidSignature
+	}
+}
+
+// validateTx checks the tx against the committed state and the queued and
+// proposed txs, but the replaced one. The signatures are checked by sigs when
+// they have the same keys, otherwise they are checked here.
+func (ms *MempoolState) validateTx(tx transaction.ZionTx, replaced *queuedTx, sigs []sigCheck) error {
+	v := newValidator(ms, replaced)
+	v.sigs = sigs
+	return v.validate(tx)
+}
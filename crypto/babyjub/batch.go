@@ -0,0 +1,213 @@
+package babyjub
+
+import (
+	"crypto/rand"
+	"math/big"
+	"math/bits"
+
+	"github.com/vivijj/ziongo/crypto/constants"
+	"github.com/vivijj/ziongo/crypto/ffsub"
+	"github.com/vivijj/ziongo/crypto/poseidon"
+)
+
+// batchScalarBits is the bit length of the random coefficients used to combine
+// the signatures of a batch.  A forged signature passes the combined check with
+// probability at most 2^-batchScalarBits.
+const batchScalarBits = 128
+
+// VerifyPoseidonBatch verifies many signatures at once.  It checks the random
+// linear combination
+//
+//	(sum z_i*S_i) * B8 == sum z_i*R8_i + sum (z_i*hm_i) * A_i
+//
+// with a multi-scalar multiplication, and only when that fails it falls back
+// to VerifyPoseidon on each signature to find out which ones are bad.
+//
+// It returns true and nil when every signature is valid, otherwise false and
+// the indexes of the invalid signatures, including the ones with a nil public
+// key, message or signature, or a nil coordinate or S. If the three slices
+// don't have the same length, it returns false and nil.
+//
+// The combined check is cofactorless, so a small order component of R8 or of a
+// public key could cancel out in the combination.  It's only used when every R8
+// and public key is in the prime order subgroup, otherwise each signature is
+// checked on its own, so the result is always the one of VerifyPoseidon.
+func VerifyPoseidonBatch(pks []*PublicKey, msgs []*big.Int, sigs []*Signature) (bool, []int) {
+	n := len(sigs)
+	if len(pks) != n || len(msgs) != n {
+		return false, nil
+	}
+	if n == 0 {
+		return true, nil
+	}
+	wellFormed := true
+	for i := range sigs {
+		if !batchItemWellFormed(pks[i], msgs[i], sigs[i]) {
+			wellFormed = false
+			break
+		}
+	}
+	if wellFormed && n > 1 && verifyPoseidonCombined(pks, msgs, sigs) {
+		return true, nil
+	}
+
+	var invalid []int
+	for i := range sigs {
+		if !batchItemWellFormed(pks[i], msgs[i], sigs[i]) || !pks[i].VerifyPoseidon(msgs[i], sigs[i]) {
+			invalid = append(invalid, i)
+		}
+	}
+	return len(invalid) == 0, invalid
+}
+
+// VerifyPoseidonStrictBatch verifies many signatures at once like
+// VerifyPoseidonBatch, but in the strict mode of VerifyPoseidonStrict.  The
+// combined check is only used when every S, R8 and public key is canonical,
+// otherwise each signature is checked on its own by VerifyPoseidonStrict, so
+// the result is always the one of VerifyPoseidonStrict.
+func VerifyPoseidonStrictBatch(pks []*PublicKey, msgs []*big.Int, sigs []*Signature) (bool, []int) {
+	n := len(sigs)
+	if len(pks) != n || len(msgs) != n {
+		return false, nil
+	}
+	if n == 0 {
+		return true, nil
+	}
+	canonical := true
+	for i := range sigs {
+		if !batchItemWellFormed(pks[i], msgs[i], sigs[i]) || !batchItemCanonical(pks[i], sigs[i]) {
+			canonical = false
+			break
+		}
+	}
+	// the combined check also rejects the points out of the prime order subgroup.
+	if canonical && n > 1 && verifyPoseidonCombined(pks, msgs, sigs) {
+		return true, nil
+	}
+
+	var invalid []int
+	for i := range sigs {
+		if msgs[i] == nil || pks[i].VerifyPoseidonStrict(msgs[i], sigs[i]) != nil {
+			invalid = append(invalid, i)
+		}
+	}
+	return len(invalid) == 0, invalid
+}
+
+// batchItemCanonical reports whether the well formed signature passes the checks
+// of VerifyPoseidonStrict but the subgroup ones: S is lower than SubOrder, R8 and
+// the public key are canonical points, and the key is not the identity.
+func batchItemCanonical(pk *PublicKey, sig *Signature) bool {
+	return sig.S.Sign() >= 0 && sig.S.Cmp(SubOrder) < 0 && isCanonicalPoint(sig.R8) &&
+		isCanonicalPoint(pk.Point()) && !(pk.X.Sign() == 0 && pk.Y.Cmp(constants.One) == 0)
+}
+
+// batchItemWellFormed reports whether the signature can be checked at all: none
+// of its values is nil.
+func batchItemWellFormed(pk *PublicKey, msg *big.Int, sig *Signature) bool {
+	return pk != nil && pk.X != nil && pk.Y != nil && msg != nil &&
+		sig != nil && sig.R8 != nil && sig.R8.X != nil && sig.R8.Y != nil && sig.S != nil
+}
+
+// verifyPoseidonCombined checks the random linear combination of all the
+// verification equations of the batch.  It fails when a S is negative, or a R8
+// or a public key is not in the prime order subgroup.
+func verifyPoseidonCombined(pks []*PublicKey, msgs []*big.Int, sigs []*Signature) bool {
+	inSubGroup := make(map[[2]string]bool)
+	for i, sig := range sigs {
+		if sig.S.Sign() < 0 || !sig.R8.InSubGroup() {
+			return false
+		}
+		key := [2]string{pks[i].X.String(), pks[i].Y.String()}
+		if !inSubGroup[key] {
+			if !pks[i].Point().InSubGroup() {
+				return false
+			}
+			inSubGroup[key] = true
+		}
+	}
+
+	poseidonParam := poseidon.NewParams(6, 6, 52)
+	zMax := new(big.Int).Lsh(big.NewInt(1), batchScalarBits)
+
+	var sumS, zS ffsub.Element
+	scalars := make([]*big.Int, 0, 2*len(sigs))
+	points := make([]*Point, 0, 2*len(sigs))
+	for i, sig := range sigs {
+		z, err := rand.Int(rand.Reader, zMax)
+		if err != nil {
+			return false
+		}
+		// hm = H1(R8.x, R8.y, A.x, A.y, msg)
+		hm := poseidon.Hash([]*big.Int{sig.R8.X, sig.R8.Y, pks[i].X, pks[i].Y, msgs[i]}, poseidonParam)
+
+		zS.SetBigInt(sig.S)
+		sumS.Add(&sumS, zS.Mul(&zS, new(ffsub.Element).SetBigInt(z)))
+		scalars = append(scalars, z, hm.Mul(hm, z))
+		points = append(points, sig.R8, pks[i].Point())
+	}
+	left := mulB8Projective(&sumS).Affine()
+	right := multiScalarMul(scalars, points).Affine()
+	return (left.X.Cmp(right.X) == 0) && (left.Y.Cmp(right.Y) == 0)
+}
+
+// multiScalarMul computes sum scalars[i] * points[i] with the bucket method of
+// Pippenger.  The scalars must be non negative.
+func multiScalarMul(scalars []*big.Int, points []*Point) *PointProjective {
+	maxBits := 0
+	for _, s := range scalars {
+		if s.BitLen() > maxBits {
+			maxBits = s.BitLen()
+		}
+	}
+	// window of roughly log2(n) bits, which balances bucket additions against
+	// the additions needed to sum the buckets up.
+	c := bits.Len(uint(len(points))) - 1
+	if c < 2 {
+		c = 2
+	}
+	if c > 16 {
+		c = 16
+	}
+
+	projs := make([]*PointProjective, len(points))
+	for i, p := range points {
+		projs[i] = p.Projective()
+	}
+
+	res := NewPointProjective()
+	buckets := make([]*PointProjective, (1<<c)-1)
+	for w := (maxBits + c - 1) / c; w > 0; w-- {
+		for i := 0; i < c; i++ {
+			res.Add(res, res)
+		}
+
+		for i := range buckets {
+			buckets[i] = nil
+		}
+		lo := (w - 1) * c
+		for i, s := range scalars {
+			idx := scalarWindow(s, lo, c)
+			if idx == 0 {
+				continue
+			}
+			if buckets[idx-1] == nil {
+				buckets[idx-1] = NewPointProjective().Add(NewPointProjective(), projs[i])
+			} else {
+				buckets[idx-1].Add(buckets[idx-1], projs[i])
+			}
+		}
+
+		// sum_k k*bucket[k] computed as a running sum from the highest bucket.
+		running := NewPointProjective()
+		windowSum := NewPointProjective()
+		for k := len(buckets) - 1; k >= 0; k-- {
+			if buckets[k] != nil {
+				running.Add(running, buckets[k])
+			}
+			windowSum.Add(windowSum, running)
+		}
+		res.Add(res, windowSum)
+	}
+	return res
+}
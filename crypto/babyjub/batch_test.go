@@ -0,0 +1,162 @@
+package babyjub
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vivijj/ziongo/crypto/constants"
+	"github.com/vivijj/ziongo/crypto/poseidon"
+)
+
+func batchFixture(n int) ([]*PublicKey, []*big.Int, []*Signature) {
+	pks := make([]*PublicKey, n)
+	msgs := make([]*big.Int, n)
+	sigs := make([]*Signature, n)
+	for i := 0; i < n; i++ {
+		var k PrivateKey
+		k[0] = byte(i + 1)
+		k[31] = 0x42
+		pks[i] = k.Public()
+		msgs[i] = big.NewInt(int64(1000 + i))
+		sigs[i] = k.SignPoseidon(msgs[i])
+	}
+	return pks, msgs, sigs
+}
+
+func TestVerifyPoseidonBatch(t *testing.T) {
+	pks, msgs, sigs := batchFixture(8)
+
+	ok, invalid := VerifyPoseidonBatch(pks, msgs, sigs)
+	assert.True(t, ok)
+	assert.Empty(t, invalid)
+
+	// a message signed by another key and a tampered S.
+	msgs[2] = big.NewInt(7)
+	sigs[5] = &Signature{R8: sigs[5].R8, S: new(big.Int).Add(sigs[5].S, big.NewInt(1))}
+	ok, invalid = VerifyPoseidonBatch(pks, msgs, sigs)
+	assert.False(t, ok)
+	assert.Equal(t, []int{2, 5}, invalid)
+
+	ok, invalid = VerifyPoseidonBatch(pks[:1], msgs, sigs)
+	assert.False(t, ok)
+	assert.Nil(t, invalid)
+}
+
+// torsionSig returns a signature of msg by the key k whose R8 has a component of
+// order 2: it satisfies the verification equation up to that component only.
+func torsionSig(k PrivateKey, msg *big.Int) *Signature {
+	pk := k.Public()
+	r := big.NewInt(12345)
+	order2 := &Point{X: big.NewInt(0), Y: new(big.Int).Sub(constants.Q, big.NewInt(1))}
+	r8 := NewPoint().Mul(r, B8).Projective()
+	r8 = r8.Add(r8, order2.Projective())
+	R8 := r8.Affine()
+
+	hm := poseidon.Hash([]*big.Int{R8.X, R8.Y, pk.X, pk.Y, msg}, poseidon.NewParams(6, 6, 52))
+	S := new(big.Int).Mul(hm, new(big.Int).SetBytes(k[:]))
+	S.Add(S, r).Mod(S, SubOrder)
+	return &Signature{R8: R8, S: S}
+}
+
+func TestVerifyPoseidonBatchTorsion(t *testing.T) {
+	pks, msgs, sigs := batchFixture(8)
+	var k PrivateKey
+	k[0] = 4
+	k[31] = 0x42
+	sigs[3] = torsionSig(k, msgs[3])
+	require.False(t, pks[3].VerifyPoseidon(msgs[3], sigs[3]))
+
+	// the small order component would cancel out in half of the combinations.
+	for i := 0; i < 16; i++ {
+		ok, invalid := VerifyPoseidonBatch(pks, msgs, sigs)
+		assert.False(t, ok)
+		assert.Equal(t, []int{3}, invalid)
+	}
+}
+
+func TestVerifyPoseidonBatchNil(t *testing.T) {
+	pks, msgs, sigs := batchFixture(6)
+	pks[1] = &PublicKey{X: pks[1].X}
+	sigs[2] = &Signature{R8: sigs[2].R8}
+	sigs[3] = &Signature{R8: &Point{X: sigs[3].R8.X}, S: sigs[3].S}
+	msgs[4] = nil
+	sigs[5] = nil
+	ok, invalid := VerifyPoseidonBatch(pks, msgs, sigs)
+	assert.False(t, ok)
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, invalid)
+
+	pks, msgs, sigs = batchFixture(2)
+	pks[0] = nil
+	ok, invalid = VerifyPoseidonBatch(pks, msgs, sigs)
+	assert.False(t, ok)
+	assert.Equal(t, []int{0}, invalid)
+}
+
+func TestVerifyPoseidonStrictBatch(t *testing.T) {
+	pks, msgs, sigs := batchFixture(8)
+	ok, invalid := VerifyPoseidonStrictBatch(pks, msgs, sigs)
+	assert.True(t, ok)
+	assert.Empty(t, invalid)
+
+	// a malleable S, which only the strict mode rejects, a small order component
+	// of R8 and a message signed by another key.
+	sigs[1] = &Signature{R8: sigs[1].R8, S: new(big.Int).Add(sigs[1].S, SubOrder)}
+	var k PrivateKey
+	k[0] = 4
+	k[31] = 0x42
+	sigs[3] = torsionSig(k, msgs[3])
+	msgs[5] = big.NewInt(7)
+	ok, invalid = VerifyPoseidonBatch(pks, msgs, sigs)
+	assert.False(t, ok)
+	assert.Equal(t, []int{3, 5}, invalid)
+	ok, invalid = VerifyPoseidonStrictBatch(pks, msgs, sigs)
+	assert.False(t, ok)
+	assert.Equal(t, []int{1, 3, 5}, invalid)
+
+	pks, msgs, sigs = batchFixture(4)
+	pks[0] = &PublicKey{X: big.NewInt(0), Y: big.NewInt(1)}
+	msgs[2] = nil
+	sigs[3] = nil
+	ok, invalid = VerifyPoseidonStrictBatch(pks, msgs, sigs)
+	assert.False(t, ok)
+	assert.Equal(t, []int{0, 2, 3}, invalid)
+
+	ok, invalid = VerifyPoseidonStrictBatch(pks[:1], msgs, sigs)
+	assert.False(t, ok)
+	assert.Nil(t, invalid)
+}
+
+func TestMultiScalarMul(t *testing.T) {
+	_, _, sigs := batchFixture(5)
+	scalars := make([]*big.Int, len(sigs))
+	points := make([]*Point, len(sigs))
+	expected := NewPointProjective()
+	for i, sig := range sigs {
+		scalars[i] = new(big.Int).Lsh(big.NewInt(int64(i*37+1)), uint(i*50))
+		points[i] = sig.R8
+		expected.Add(expected, NewPoint().Mul(scalars[i], points[i]).Projective())
+	}
+	res := multiScalarMul(scalars, points).Affine()
+	exp := expected.Affine()
+	assert.Equal(t, exp.X.String(), res.X.String())
+	assert.Equal(t, exp.Y.String(), res.Y.String())
+}
+
+func BenchmarkVerifyPoseidonBatch(b *testing.B) {
+	pks, msgs, sigs := batchFixture(64)
+	b.Run("Batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			VerifyPoseidonBatch(pks, msgs, sigs)
+		}
+	})
+	b.Run("OneByOne", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := range sigs {
+				pks[j].VerifyPoseidon(msgs[j], sigs[j])
+			}
+		}
+	})
+}
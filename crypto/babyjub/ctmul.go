@@ -0,0 +1,100 @@
+package babyjub
+
+import (
+	"crypto/subtle"
+	"math/big"
+
+	"github.com/vivijj/ziongo/crypto/constants"
+	"github.com/vivijj/ziongo/crypto/ff"
+	"github.com/vivijj/ziongo/crypto/ffsub"
+)
+
+// The functions of this file run in time independent of the secret scalar:
+// there is no branch nor memory access that depends on its bits. They rely on
+// the field operations of ff and ffsub, which are constant time in their
+// amd64 assembly implementation.
+
+// qMinusTwo is the exponent of the Fermat inversion in the base field.
+var qMinusTwo = new(big.Int).Sub(constants.Q, big.NewInt(2))
+
+// twoPow128 is 2^128 as a scalar, used to load a scalar from its bytes.
+var twoPow128 = new(ffsub.Element).SetBigInt(new(big.Int).Lsh(big.NewInt(1), 128))
+
+// MulB8ConstantTime returns s * B8 like MulB8, but in constant time, so it is
+// the one to use on secret scalars.  s is taken modulo SubOrder, so it may be
+// negative or larger than 256 bits.
+func MulB8ConstantTime(s *big.Int) *Point {
+	var buf [32]byte
+	k := scalarFromBytesConstantTime(new(big.Int).Mod(s, SubOrder).FillBytes(buf[:]))
+	return mulB8ConstantTime(&k).affineConstantTime()
+}
+
+// scalarFromBytesConstantTime returns the big-endian be modulo SubOrder.  The
+// length of be must be a multiple of 16 bytes.  The value is loaded by chunks
+// of 128 bits, which are lower than SubOrder, with the Horner scheme
+//
+//	k = ((c_n * 2^128 + c_{n-1}) * 2^128 + ...) + c_0
+func scalarFromBytesConstantTime(be []byte) ffsub.Element {
+	var k, c ffsub.Element
+	for i := 0; i < len(be); i += 16 {
+		c = ffsub.Element{beUint64(be[i+8 : i+16]), beUint64(be[i : i+8]), 0, 0}
+		c.ToMont()
+		k.Mul(&k, twoPow128)
+		k.Add(&k, &c)
+	}
+	return k
+}
+
+func beUint64(b []byte) uint64 {
+	var v uint64
+	for _, x := range b {
+		v = v<<8 | uint64(x)
+	}
+	return v
+}
+
+// mulB8ConstantTime returns k * B8 with the fixed window table of MulB8, where
+// every window adds a point selected from the whole table in constant time,
+// the identity for a zero window.
+func mulB8ConstantTime(k *ffsub.Element) *PointProjective {
+	b8TableOnce.Do(initB8Table)
+	kReg := k.ToRegular()
+
+	res := NewPointProjective()
+	for i := 0; i < fixedBaseWindows; i++ {
+		w := elementWindow(&kReg, i*fixedBaseWindow, fixedBaseWindow)
+		q := NewPointProjective()
+		for j := range b8Table[i] {
+			q.cmov(b8Table[i][j], subtle.ConstantTimeEq(int32(w), int32(j+1)))
+		}
+		res.Add(res, q)
+	}
+	return res
+}
+
+// cmov sets p to q when cond is 1 and leaves it unchanged when cond is 0.
+func (p *PointProjective) cmov(q *PointProjective, cond int) {
+	cmovElement(p.X, q.X, cond)
+	cmovElement(p.Y, q.Y, cond)
+	cmovElement(p.Z, q.Z, cond)
+}
+
+func cmovElement(z, x *ff.Element, cond int) {
+	mask := -uint64(cond)
+	for i := range z {
+		z[i] ^= mask & (z[i] ^ x[i])
+	}
+}
+
+// affineConstantTime returns the Point from the projective representation like
+// Affine, but inverting Z with the Fermat little theorem, which unlike the
+// binary inversion doesn't depend on the value of Z.
+func (p *PointProjective) affineConstantTime() *Point {
+	zinv := new(ff.Element).Exp(*p.Z, qMinusTwo)
+	x := new(ff.Element).Mul(p.X, zinv)
+	y := new(ff.Element).Mul(p.Y, zinv)
+	return &Point{
+		X: x.ToBigIntRegular(new(big.Int)),
+		Y: y.ToBigIntRegular(new(big.Int)),
+	}
+}
@@ -0,0 +1,92 @@
+package babyjub
+
+import (
+	"crypto/rand"
+	"flag"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var timingTest = flag.Bool("timing", false, "run the timing variance test of the constant time multiplication")
+
+func TestMulB8ConstantTime(t *testing.T) {
+	for _, s := range []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		benchScalar,
+		new(big.Int).Sub(SubOrder, big.NewInt(1)),
+		new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1)),
+		new(big.Int).Lsh(big.NewInt(1), 300),
+		big.NewInt(-1),
+		new(big.Int).Neg(benchScalar),
+	} {
+		exp := NewPoint().Mul(new(big.Int).Mod(s, SubOrder), B8)
+		res := MulB8ConstantTime(s)
+		assert.Equal(t, exp.X.String(), res.X.String())
+		assert.Equal(t, exp.Y.String(), res.Y.String())
+	}
+}
+
+func TestScalarFromBytesConstantTime(t *testing.T) {
+	for _, n := range []int{32, 64} {
+		buf := make([]byte, n)
+		_, err := rand.Read(buf)
+		require.Nil(t, err)
+
+		k := scalarFromBytesConstantTime(buf)
+		exp := new(big.Int).Mod(new(big.Int).SetBytes(buf), SubOrder)
+		assert.Equal(t, exp.String(), k.ToBigIntRegular(new(big.Int)).String())
+	}
+}
+
+// TestMulB8TimingVariance is a dudect style test: it measures the time of the
+// multiplication for a fixed low weight scalar and for random scalars, and
+// computes the Welch t statistic between the two classes.  A |t| well above
+// 4.5 means the time depends on the scalar.  It's noisy, so it only runs with
+// the -timing flag, e.g.
+//
+//	go test ./crypto/babyjub -run TimingVariance -timing -v
+func TestMulB8TimingVariance(t *testing.T) {
+	if !*timingTest {
+		t.Skip("timing variance test is only run with -timing")
+	}
+	const samples = 20000
+
+	ct := timingStatistic(samples, func(s *big.Int) { MulB8ConstantTime(s) })
+	vt := timingStatistic(samples, func(s *big.Int) { NewPoint().Mul(s, B8) })
+	t.Logf("t statistic: MulB8ConstantTime %.2f, Point.Mul %.2f", ct, vt)
+	assert.Less(t, math.Abs(ct), 10.0)
+}
+
+// timingStatistic returns the Welch t statistic of the running time of f
+// between a fixed scalar and random scalars, picked in a random order.
+func timingStatistic(samples int, f func(s *big.Int)) float64 {
+	fixed := big.NewInt(1)
+	var n, mean, m2 [2]float64
+	class := make([]byte, samples)
+	_, _ = rand.Read(class)
+	for i := 0; i < samples; i++ {
+		c := class[i] & 1
+		s := fixed
+		if c == 1 {
+			s, _ = rand.Int(rand.Reader, SubOrder)
+		}
+		start := time.Now()
+		f(s)
+		d := float64(time.Since(start).Nanoseconds())
+
+		// Welford online mean and variance
+		n[c]++
+		delta := d - mean[c]
+		mean[c] += delta / n[c]
+		m2[c] += delta * (d - mean[c])
+	}
+	v0 := m2[0] / (n[0] - 1)
+	v1 := m2[1] / (n[1] - 1)
+	return (mean[0] - mean[1]) / math.Sqrt(v0/n[0]+v1/n[1])
+}
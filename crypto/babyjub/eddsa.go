@@ -4,6 +4,8 @@ package babyjub
 import (
 	"math/big"
 
+	"github.com/vivijj/ziongo/crypto/constants"
+	"github.com/vivijj/ziongo/crypto/ffsub"
 	"github.com/vivijj/ziongo/crypto/poseidon"
 	"github.com/vivijj/ziongo/crypto/utils"
 )
@@ -34,7 +36,7 @@ func NewPrivKeyScalar(s *big.Int) *PrivKeyScalar {
 // Public returns the public key corresponding to the scalar value s of a
 // private key.
 func (s *PrivKeyScalar) Public() *PublicKey {
-	p := NewPoint().Mul((*big.Int)(s), B8)
+	p := MulB8ConstantTime((*big.Int)(s))
 	pk := PublicKey(*p)
 	return &pk
 }
@@ -180,30 +182,28 @@ func (sComp *SignatureComp) Decompress() (*Signature, error) {
 
 // SignPoseidon signs a message encoded as a big.Int in Zq
 func (k *PrivateKey) SignPoseidon(msg *big.Int) *Signature {
-	A := k.Public().Point() // A = kG
+	var hm, S ffsub.Element
+	kE := scalarFromBytesConstantTime(k[:])
+	A := mulB8ConstantTime(&kE).affineConstantTime() // A = kG
 
-	kBuf := utils.BigIntLEBytes(k.Scalar().BigInt())
-	h1 := Blake512(kBuf[:])
+	h1 := Blake512(utils.SwapEndianness(k[:]))
 
 	msgBuf := utils.BigIntLEBytes(msg)
 	msgBuf32 := [32]byte{}
 	copy(msgBuf32[:], msgBuf[:])
 
 	rBuf := Blake512(append(h1[32:], msgBuf32[:]...))
-	r := utils.SetBigIntFromLEBytes(new(big.Int), rBuf) // r = H(H_{32..63}(k), msg)
-	r.Mod(r, SubOrder)
-	R8 := NewPoint().Mul(r, B8) // R8 = r * B8
+	r := scalarFromBytesConstantTime(utils.SwapEndianness(rBuf)) // r = H(H_{32..63}(k), msg) mod SubOrder
+	R8 := mulB8ConstantTime(&r).affineConstantTime()             // R8 = r * B8
 
 	hmInput := []*big.Int{R8.X, R8.Y, A.X, A.Y, msg}
 	poseidonParam := poseidon.NewParams(6, 6, 52)
-	hm := poseidon.Hash(hmInput, poseidonParam) // hm = H1(8*R.x, 8*R.y, A.x, A.y, msg)
+	hm.SetBigInt(poseidon.Hash(hmInput, poseidonParam)) // hm = H1(8*R.x, 8*R.y, A.x, A.y, msg)
 
-	S := k.Scalar().BigInt()
-	S = S.Mul(hm, S)
-	S.Add(r, S)
-	S.Mod(S, SubOrder) // S = r + hm * k
+	S.Mul(&hm, &kE)
+	S.Add(&r, &S) // S = r + hm * k
 
-	return &Signature{R8: R8, S: S}
+	return &Signature{R8: R8, S: S.ToBigIntRegular(new(big.Int))}
 }
 
 // VerifyPoseidon verifies the signature of a message encoded as a big.Int in Fq
@@ -213,11 +213,60 @@ func (pk *PublicKey) VerifyPoseidon(msg *big.Int, sig *Signature) bool {
 
 	hm := poseidon.Hash(hmInput, poseidonParam) // hm = H1(R8.x, R8.y, A.x, A.y, msg)
 
-	left := NewPoint().Mul(sig.S, B8)       // left = s * B8
-	right := NewPoint().Mul(hm, pk.Point()) // hm *
-	rightProj := right.Projective()
-	rightProj.Add(sig.R8.Projective(), rightProj) // right = R8 + hm * A
-	right = rightProj.Affine()
+	// s * B8 == R8 + hm * A  <=>  s * B8 - hm * A == R8
+	left := MulDouble(sig.S, hm, pk.Point().neg())
 
-	return (left.X.Cmp(right.X) == 0) && (left.Y.Cmp(right.Y) == 0)
+	return (left.X.Cmp(sig.R8.X) == 0) && (left.Y.Cmp(sig.R8.Y) == 0)
+}
+
+// SignBytes signs an arbitrary byte message, which is mapped to the field with
+// HashBytes.
+func (k *PrivateKey) SignBytes(msg []byte) *Signature {
+	return k.SignPoseidon(HashBytes(msg))
+}
+
+// VerifyBytes verifies the signature of a byte message made by SignBytes. The
+// signature is checked in the strict mode of VerifyPoseidonStrict.
+func (pk *PublicKey) VerifyBytes(msg []byte, sig *Signature) bool {
+	return pk.VerifyPoseidonStrict(HashBytes(msg), sig) == nil
+}
+
+// VerifyPoseidonStrict verifies the signature of a message like VerifyPoseidon,
+// but it also rejects the malleable and small subgroup forms of a signature:
+// S must be lower than SubOrder, and both R8 and the public key must be
+// canonical points of the prime order subgroup. It returns nil when the
+// signature is valid, or a *SignatureError explaining why it was rejected.
+func (pk *PublicKey) VerifyPoseidonStrict(msg *big.Int, sig *Signature) error {
+	if sig == nil || sig.R8 == nil || sig.R8.X == nil || sig.R8.Y == nil || sig.S == nil {
+		return ErrSigMalformed
+	}
+	if sig.S.Sign() < 0 || sig.S.Cmp(SubOrder) >= 0 {
+		return ErrSigSNotCanonical
+	}
+	if !isCanonicalPoint(sig.R8) {
+		return ErrSigR8NotOnCurve
+	}
+	if !sig.R8.InSubGroup() {
+		return ErrSigR8NotInSubGroup
+	}
+	if pk == nil || pk.X == nil || pk.Y == nil || !isCanonicalPoint(pk.Point()) {
+		return ErrPubKeyNotOnCurve
+	}
+	if pk.X.Sign() == 0 && pk.Y.Cmp(constants.One) == 0 {
+		return ErrPubKeyIdentity
+	}
+	if !pk.Point().InSubGroup() {
+		return ErrPubKeyNotInSubGroup
+	}
+	if !pk.VerifyPoseidon(msg, sig) {
+		return ErrSigMismatch
+	}
+	return nil
+}
+
+// isCanonicalPoint returns true when the coordinates of p are reduced modulo Q
+// and p is in the babyjub curve.
+func isCanonicalPoint(p *Point) bool {
+	return p.X.Sign() >= 0 && p.Y.Sign() >= 0 &&
+		utils.CheckBigIntInField(p.X) && utils.CheckBigIntInField(p.Y) && p.InCurve()
 }
@@ -2,11 +2,15 @@ package babyjub
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"math/big"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/vivijj/ziongo/crypto/constants"
+	"github.com/vivijj/ziongo/crypto/utils"
 )
 
 func TestSignVerifyPoseidon(t *testing.T) {
@@ -41,3 +45,96 @@ func TestSignVerifyPoseidon(t *testing.T) {
 	ok := pk.VerifyPoseidon(msg, sig)
 	assert.Equal(t, true, ok)
 }
+
+func TestVerifyPoseidonStrict(t *testing.T) {
+	var k PrivateKey
+	_, err := hex.Decode(k[:],
+		[]byte("0001020304050607080900010203040506070809000102030405060708090001"))
+	require.Nil(t, err)
+	msg := big.NewInt(123456789)
+	pk := k.Public()
+	sig := k.SignPoseidon(msg)
+	require.Nil(t, pk.VerifyPoseidonStrict(msg, sig))
+
+	// point of order 2
+	torsion := &Point{X: big.NewInt(0), Y: new(big.Int).Sub(constants.Q, big.NewInt(1))}
+
+	// S + SubOrder is accepted by VerifyPoseidon, but it is malleable.
+	sigMalleable := &Signature{R8: sig.R8, S: new(big.Int).Add(sig.S, SubOrder)}
+	assert.True(t, pk.VerifyPoseidon(msg, sigMalleable))
+	assert.Equal(t, ErrSigSNotCanonical, pk.VerifyPoseidonStrict(msg, sigMalleable))
+
+	// the identity as public key verifies any R8 = S * B8.
+	identity := PublicKey(*NewPoint())
+	s := big.NewInt(42)
+	forged := &Signature{R8: MulB8(s), S: s}
+	assert.True(t, identity.VerifyPoseidon(msg, forged))
+	assert.Equal(t, ErrPubKeyIdentity, identity.VerifyPoseidonStrict(msg, forged))
+
+	// public key with a small order component.
+	pkTorsion := PublicKey(*addPoints(pk.Point(), torsion))
+	assert.Equal(t, ErrPubKeyNotInSubGroup, pkTorsion.VerifyPoseidonStrict(msg, sig))
+
+	sigR8Torsion := &Signature{R8: addPoints(sig.R8, torsion), S: sig.S}
+	assert.Equal(t, ErrSigR8NotInSubGroup, pk.VerifyPoseidonStrict(msg, sigR8Torsion))
+
+	sigOffCurve := &Signature{
+		R8: &Point{X: sig.R8.X, Y: new(big.Int).Add(sig.R8.Y, big.NewInt(1))},
+		S:  sig.S,
+	}
+	assert.Equal(t, ErrSigR8NotOnCurve, pk.VerifyPoseidonStrict(msg, sigOffCurve))
+
+	sigNonCanonical := &Signature{
+		R8: &Point{X: sig.R8.X, Y: new(big.Int).Add(sig.R8.Y, constants.Q)},
+		S:  sig.S,
+	}
+	assert.Equal(t, ErrSigR8NotOnCurve, pk.VerifyPoseidonStrict(msg, sigNonCanonical))
+
+	pkOffCurve := PublicKey(Point{X: pk.X, Y: big.NewInt(5)})
+	assert.Equal(t, ErrPubKeyNotOnCurve, pkOffCurve.VerifyPoseidonStrict(msg, sig))
+
+	assert.Equal(t, ErrSigMalformed, pk.VerifyPoseidonStrict(msg, &Signature{R8: sig.R8}))
+	assert.Equal(t, ErrSigMismatch, pk.VerifyPoseidonStrict(big.NewInt(1), sig))
+}
+
+func addPoints(p, q *Point) *Point {
+	res := p.Projective()
+	return res.Add(res, q.Projective()).Affine()
+}
+
+func TestSignVerifyBytes(t *testing.T) {
+	k := PrivateKey{7, 7, 7}
+	pk := k.Public()
+	msg := []byte("login challenge: 0x5f2a9c, expires at 1700000000")
+
+	sig := k.SignBytes(msg)
+	assert.True(t, pk.VerifyBytes(msg, sig))
+	assert.False(t, pk.VerifyBytes(msg[1:], sig))
+	assert.False(t, pk.VerifyBytes(append(msg, 0), sig))
+
+	// compressed signature JSON round trip
+	sigJSON, err := json.Marshal(sig.Compress())
+	require.Nil(t, err)
+	var sigComp SignatureComp
+	require.Nil(t, json.Unmarshal(sigJSON, &sigComp))
+	sig2, err := sigComp.Decompress()
+	require.Nil(t, err)
+	assert.True(t, pk.VerifyBytes(msg, sig2))
+}
+
+func TestHashBytes(t *testing.T) {
+	assert.NotEqual(t, HashBytes(nil), HashBytes([]byte{0}))
+	assert.NotEqual(t, HashBytes([]byte{1}), HashBytes([]byte{0, 1}))
+
+	long := make([]byte, 5*31+1)
+	assert.NotEqual(t, HashBytes(long), HashBytes(long[:5*31]))
+	assert.True(t, utils.CheckBigIntInField(HashBytes(long)))
+}
+
+func BenchmarkSignPoseidon(b *testing.B) {
+	k := PrivateKey{7, 7, 7}
+	msg := big.NewInt(123456789)
+	for i := 0; i < b.N; i++ {
+		k.SignPoseidon(msg)
+	}
+}
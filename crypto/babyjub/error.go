@@ -0,0 +1,20 @@
+package babyjub
+
+// SignatureError is returned by the strict verification to explain why a
+// signature was rejected.
+type SignatureError struct{ msg string }
+
+func (err SignatureError) Error() string {
+	return err.msg
+}
+
+var (
+	ErrSigMalformed        = &SignatureError{"signature is missing R8 or S"}
+	ErrSigSNotCanonical    = &SignatureError{"signature S is not lower than the subgroup order"}
+	ErrSigR8NotOnCurve     = &SignatureError{"signature R8 is not a canonical curve point"}
+	ErrSigR8NotInSubGroup  = &SignatureError{"signature R8 is not in the prime order subgroup"}
+	ErrPubKeyNotOnCurve    = &SignatureError{"public key is not a canonical curve point"}
+	ErrPubKeyNotInSubGroup = &SignatureError{"public key is not in the prime order subgroup"}
+	ErrPubKeyIdentity      = &SignatureError{"public key is the identity point"}
+	ErrSigMismatch         = &SignatureError{"signature does not match the message and public key"}
+)
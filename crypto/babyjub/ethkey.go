@@ -0,0 +1,79 @@
+package babyjub
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// secp256k1N and secp256k1HalfN are the order of secp256k1 and its half, used
+// to bring an ECDSA signature to its low-s form.
+var (
+	secp256k1N     = crypto.S256().Params().N
+	secp256k1HalfN = new(big.Int).Rsh(secp256k1N, 1)
+)
+
+// EthKeyMessage returns the message an Ethereum account signs (as an EIP-191
+// personal message) to derive its L2 key on the chain chainId.
+func EthKeyMessage(chainId int) string {
+	return fmt.Sprintf(
+		"Access zion account.\n\nChain ID: %d.\n\nOnly sign this message for a trusted client!",
+		chainId,
+	)
+}
+
+// EthKeyMessageHash returns the hash signed by the Ethereum account to derive
+// its L2 key on the chain chainId.
+func EthKeyMessageHash(chainId int) []byte {
+	return accounts.TextHash([]byte(EthKeyMessage(chainId)))
+}
+
+// DerivePrivateKey derives deterministically the L2 PrivateKey of the Ethereum
+// account addr from its 65 bytes signature of EthKeyMessage(chainId).  The
+// recovery id of the signature can be either 0/1 or 27/28, and the signature
+// is checked to be made by addr, so a wrong signature can't silently give
+// another key.
+func DerivePrivateKey(chainId int, addr common.Address, ethSig []byte) (*PrivateKey, error) {
+	if len(ethSig) != crypto.SignatureLength {
+		return nil, fmt.Errorf("expected %v bytes of signature, got %v", crypto.SignatureLength, len(ethSig))
+	}
+	sig := make([]byte, crypto.SignatureLength)
+	copy(sig, ethSig)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+
+	pub, err := crypto.SigToPub(EthKeyMessageHash(chainId), sig)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.PubkeyToAddress(*pub) != addr {
+		return nil, fmt.Errorf("signature is not made by %v", addr)
+	}
+
+	// both s and N - s are valid for the same message, only the low-s form is
+	// used so that the derived key doesn't depend on the signer implementation.
+	s := new(big.Int).SetBytes(sig[32:64])
+	if s.Cmp(secp256k1HalfN) > 0 {
+		s.Sub(secp256k1N, s)
+		s.FillBytes(sig[32:64])
+	}
+
+	var k PrivateKey
+	copy(k[:], crypto.Keccak256(sig[:64]))
+	return &k, nil
+}
+
+// DerivePrivateKeyFromEthKey signs EthKeyMessage(chainId) with the Ethereum key
+// and derives the L2 PrivateKey from the signature, see DerivePrivateKey.
+func DerivePrivateKeyFromEthKey(ethKey *ecdsa.PrivateKey, chainId int) (*PrivateKey, error) {
+	sig, err := crypto.Sign(EthKeyMessageHash(chainId), ethKey)
+	if err != nil {
+		return nil, err
+	}
+	return DerivePrivateKey(chainId, crypto.PubkeyToAddress(ethKey.PublicKey), sig)
+}
@@ -0,0 +1,54 @@
+package babyjub
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDerivePrivateKey(t *testing.T) {
+	ethKey, err := crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	require.Nil(t, err)
+	addr := crypto.PubkeyToAddress(ethKey.PublicKey)
+
+	k, err := DerivePrivateKeyFromEthKey(ethKey, 1)
+	require.Nil(t, err)
+	k2, err := DerivePrivateKeyFromEthKey(ethKey, 1)
+	require.Nil(t, err)
+	assert.Equal(t, *k, *k2)
+
+	kTestnet, err := DerivePrivateKeyFromEthKey(ethKey, 5)
+	require.Nil(t, err)
+	assert.NotEqual(t, *k, *kTestnet)
+
+	sig, err := crypto.Sign(EthKeyMessageHash(1), ethKey)
+	require.Nil(t, err)
+
+	// wallets return the recovery id as 27/28.
+	sig27 := append([]byte{}, sig...)
+	sig27[64] += 27
+	k27, err := DerivePrivateKey(1, addr, sig27)
+	require.Nil(t, err)
+	assert.Equal(t, *k, *k27)
+	assert.Equal(t, sig[64]+27, sig27[64], "signature must not be mutated")
+
+	// the high-s form of the same signature gives the same key.
+	sigHigh := append([]byte{}, sig...)
+	s := new(big.Int).SetBytes(sig[32:64])
+	new(big.Int).Sub(secp256k1N, s).FillBytes(sigHigh[32:64])
+	sigHigh[64] ^= 1
+	kHigh, err := DerivePrivateKey(1, addr, sigHigh)
+	require.Nil(t, err)
+	assert.Equal(t, *k, *kHigh)
+
+	_, err = DerivePrivateKey(1, common.HexToAddress("0x01"), sig)
+	assert.NotNil(t, err)
+	_, err = DerivePrivateKey(5, addr, sig)
+	assert.NotNil(t, err)
+	_, err = DerivePrivateKey(1, addr, sig[:64])
+	assert.NotNil(t, err)
+}
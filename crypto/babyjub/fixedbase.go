@@ -0,0 +1,232 @@
+package babyjub
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/vivijj/ziongo/crypto/constants"
+	"github.com/vivijj/ziongo/crypto/ffsub"
+	"github.com/vivijj/ziongo/crypto/utils"
+)
+
+// fixedBaseWindow is the window size in bits of the precomputed B8 table.
+const fixedBaseWindow = 4
+
+// fixedBaseWindows is the number of windows needed to cover a scalar reduced
+// modulo SubOrder.
+const fixedBaseWindows = (ffsub.Bits + fixedBaseWindow - 1) / fixedBaseWindow
+
+var (
+	b8TableOnce sync.Once
+	// b8Table[i][j-1] = j * 2^(fixedBaseWindow*i) * B8
+	b8Table [fixedBaseWindows][(1 << fixedBaseWindow) - 1]*PointProjective
+)
+
+// initB8Table computes the table of the multiples of B8 used by MulB8.
+func initB8Table() {
+	base := B8.Projective()
+	for i := 0; i < fixedBaseWindows; i++ {
+		b8Table[i][0] = base
+		for j := 1; j < len(b8Table[i]); j++ {
+			b8Table[i][j] = NewPointProjective().Add(b8Table[i][j-1], base)
+		}
+		next := NewPointProjective().Add(base, base)
+		for k := 1; k < fixedBaseWindow; k++ {
+			next.Add(next, next)
+		}
+		base = next
+	}
+}
+
+// scalarWindow returns the c bits of s starting at the bit lo.
+func scalarWindow(s *big.Int, lo int, c int) int {
+	w := 0
+	for b := c - 1; b >= 0; b-- {
+		w = w<<1 | int(s.Bit(lo+b))
+	}
+	return w
+}
+
+// elementWindow returns the c bits of the scalar k (in regular form) starting
+// at the bit lo.
+func elementWindow(k *ffsub.Element, lo int, c int) int {
+	w := 0
+	for b := lo + c - 1; b >= lo; b-- {
+		w = w<<1 | int((k[b/64]>>(b%64))&1)
+	}
+	return w
+}
+
+// MulB8 returns s * B8 computed with a precomputed table of the multiples of
+// B8, so it only needs one point addition per 4 bits of the scalar.
+func MulB8(s *big.Int) *Point {
+	// B8 generates the subgroup, so the scalar can be taken modulo its order.
+	k := new(ffsub.Element).SetBigInt(s)
+	return mulB8Projective(k).Affine()
+}
+
+// mulB8Projective returns k * B8 for a scalar k of the subgroup.
+func mulB8Projective(k *ffsub.Element) *PointProjective {
+	b8TableOnce.Do(initB8Table)
+	kReg := k.ToRegular()
+
+	res := NewPointProjective()
+	for i := 0; i < fixedBaseWindows; i++ {
+		if w := elementWindow(&kReg, i*fixedBaseWindow, fixedBaseWindow); w != 0 {
+			res.Add(res, b8Table[i][w-1])
+		}
+	}
+	return res
+}
+
+// MulDouble returns a * B8 + b * p with the interleaved method of Straus: both
+// scalars are written in width-w NAF, and a single chain of doublings adds the
+// odd multiples of B8 and p of their digits.  The multiples of B8 are
+// precomputed once, with a wider window since they are shared by every call.
+func MulDouble(a *big.Int, b *big.Int, p *Point) *Point {
+	b8OddOnce.Do(initB8Odd)
+	// B8 generates the subgroup, so its scalar can be taken modulo its order.
+	aReg := new(ffsub.Element).SetBigInt(a).ToBigIntRegular(new(big.Int))
+	pProj := p.Projective()
+	if b.Sign() < 0 {
+		b = new(big.Int).Neg(b)
+		pProj = pProj.neg()
+	}
+	var pOdd [1 << (mulDoubleWindowP - 2)]*PointProjective
+	oddMultiples(pProj, pOdd[:])
+
+	nafA := wnaf(aReg, mulDoubleWindowB8)
+	nafB := wnaf(b, mulDoubleWindowP)
+	n := len(nafA)
+	if len(nafB) > n {
+		n = len(nafB)
+	}
+	res := NewPointProjective()
+	for i := n - 1; i >= 0; i-- {
+		res.double()
+		if i < len(nafA) {
+			res.addDigit(b8Odd[:], nafA[i])
+		}
+		if i < len(nafB) {
+			res.addDigit(pOdd[:], nafB[i])
+		}
+	}
+	return res.Affine()
+}
+
+// The wNAF widths of the scalars of MulDouble: 2^(w-2) odd multiples of the
+// point are needed for a width w.
+const (
+	mulDoubleWindowB8 = 7
+	mulDoubleWindowP  = 5
+)
+
+var (
+	b8OddOnce sync.Once
+	// b8Odd[i] = (2i+1) * B8
+	b8Odd [1 << (mulDoubleWindowB8 - 2)]*PointProjective
+)
+
+func initB8Odd() {
+	oddMultiples(B8.Projective(), b8Odd[:])
+}
+
+// oddMultiples sets table[i] to (2i+1) * p.
+func oddMultiples(p *PointProjective, table []*PointProjective) {
+	p2 := NewPointProjective().Add(p, p)
+	table[0] = p
+	for i := 1; i < len(table); i++ {
+		table[i] = NewPointProjective().Add(table[i-1], p2)
+	}
+}
+
+// wnaf returns the width-w NAF of the non negative k, least significant digit
+// first: every non zero digit is odd and lower than 2^(w-1) in absolute value,
+// and it's followed by at least w-1 zero digits.
+func wnaf(k *big.Int, w int) []int {
+	k = new(big.Int).Set(k)
+	mask := big.Word(1)<<w - 1
+	naf := make([]int, 0, k.BitLen()+1)
+	for k.Sign() > 0 {
+		d := 0
+		if k.Bit(0) == 1 {
+			d = int(k.Bits()[0] & mask)
+			if d >= 1<<(w-1) {
+				d -= 1 << w
+			}
+			k.Sub(k, big.NewInt(int64(d)))
+		}
+		naf = append(naf, d)
+		k.Rsh(k, 1)
+	}
+	return naf
+}
+
+// addDigit adds d * P to p, where table holds the odd multiples of P and d is a
+// digit of a wNAF.
+func (p *PointProjective) addDigit(table []*PointProjective, d int) {
+	switch {
+	case d > 0:
+		p.Add(p, table[d/2])
+	case d < 0:
+		p.Add(p, table[-d/2].neg())
+	}
+}
+
+// double sets p to 2 * p, which is cheaper than adding p to itself.
+func (p *PointProjective) double() {
+	// dbl-2008-bbjlp
+	// https://hyperelliptic.org/EFD/g1p/auto-twisted-projective.html#doubling-dbl-2008-bbjlp
+	b := utils.NewElement().Add(p.X, p.Y)
+	b.Square(b)
+	c := utils.NewElement().Square(p.X)
+	d := utils.NewElement().Square(p.Y)
+	e := utils.NewElement().Mul(Aff, c)
+	f := utils.NewElement().Add(e, d)
+	h := utils.NewElement().Square(p.Z)
+	j := utils.NewElement().Double(h)
+	j.Sub(f, j)
+	x3 := utils.NewElement().Sub(b, c)
+	x3.Sub(x3, d)
+	x3.Mul(x3, j)
+	y3 := utils.NewElement().Sub(e, d)
+	y3.Mul(y3, f)
+	z3 := utils.NewElement().Mul(f, j)
+
+	p.X = x3
+	p.Y = y3
+	p.Z = z3
+}
+
+// neg returns the opposite of the point p: -(X, Y, Z) = (-X, Y, Z).
+func (p *PointProjective) neg() *PointProjective {
+	return &PointProjective{X: utils.NewElement().Neg(p.X), Y: p.Y, Z: p.Z}
+}
+
+// mulWindowProjective returns s * p using a fixed window of fixedBaseWindow
+// bits.  The scalar must be non negative.
+func mulWindowProjective(s *big.Int, p *Point) *PointProjective {
+	var table [(1 << fixedBaseWindow) - 1]*PointProjective
+	table[0] = p.Projective()
+	for j := 1; j < len(table); j++ {
+		table[j] = NewPointProjective().Add(table[j-1], table[0])
+	}
+
+	res := NewPointProjective()
+	for i := (s.BitLen() + fixedBaseWindow - 1) / fixedBaseWindow; i > 0; i-- {
+		for k := 0; k < fixedBaseWindow; k++ {
+			res.double()
+		}
+		if w := scalarWindow(s, (i-1)*fixedBaseWindow, fixedBaseWindow); w != 0 {
+			res.Add(res, table[w-1])
+		}
+	}
+	return res
+}
+
+// neg returns the opposite of the Point p: -(x, y) = (-x, y).
+func (p *Point) neg() *Point {
+	x := new(big.Int).Neg(p.X)
+	x.Mod(x, constants.Q)
+	return &Point{X: x, Y: new(big.Int).Set(p.Y)}
+}
@@ -0,0 +1,113 @@
+package babyjub
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vivijj/ziongo/crypto/ffsub"
+	"github.com/vivijj/ziongo/crypto/utils"
+)
+
+var benchScalar = utils.NewIntFromString(
+	"2736030358979909402780800718157159386076813972158567259200215660948447373041",
+)
+
+func TestMulB8(t *testing.T) {
+	for _, s := range []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		big.NewInt(15),
+		benchScalar,
+		new(big.Int).Sub(SubOrder, big.NewInt(1)),
+		new(big.Int).Lsh(big.NewInt(1), 255),
+	} {
+		exp := NewPoint().Mul(s, B8)
+		res := MulB8(s)
+		assert.Equal(t, exp.X.String(), res.X.String())
+		assert.Equal(t, exp.Y.String(), res.Y.String())
+	}
+}
+
+func TestMulDouble(t *testing.T) {
+	p := NewPoint().Mul(big.NewInt(1234567), B8)
+	a := big.NewInt(987654321)
+	b := benchScalar
+
+	expProj := NewPoint().Mul(a, B8).Projective()
+	expProj.Add(expProj, NewPoint().Mul(b, p).Projective())
+	exp := expProj.Affine()
+
+	res := MulDouble(a, b, p)
+	assert.Equal(t, exp.X.String(), res.X.String())
+	assert.Equal(t, exp.Y.String(), res.Y.String())
+
+	// a negative b and a scalar a above the order of B8.
+	negB := new(big.Int).Neg(b)
+	aOver := new(big.Int).Add(a, SubOrder)
+	expProj = NewPoint().Mul(a, B8).Projective()
+	expProj.Add(expProj, NewPoint().Mul(b, p.neg()).Projective())
+	exp = expProj.Affine()
+	res = MulDouble(aOver, negB, p)
+	assert.Equal(t, exp.X.String(), res.X.String())
+	assert.Equal(t, exp.Y.String(), res.Y.String())
+
+	// a * B8 + b * (-(a/b) * B8) is the identity
+	zero := MulDouble(big.NewInt(6), big.NewInt(3), MulB8(big.NewInt(2)).neg())
+	assert.Equal(t, "0", zero.X.String())
+	assert.Equal(t, "1", zero.Y.String())
+}
+
+func TestWnaf(t *testing.T) {
+	for _, k := range []*big.Int{big.NewInt(0), big.NewInt(1), big.NewInt(0xffff), benchScalar, SubOrder} {
+		naf := wnaf(k, 5)
+		v := new(big.Int)
+		for i := len(naf) - 1; i >= 0; i-- {
+			v.Lsh(v, 1).Add(v, big.NewInt(int64(naf[i])))
+			if naf[i] != 0 {
+				assert.Equal(t, 1, naf[i]&1)
+				assert.Less(t, naf[i], 16)
+				assert.Greater(t, naf[i], -16)
+			}
+		}
+		assert.Equal(t, k.String(), v.String())
+	}
+}
+
+func BenchmarkMulB8(b *testing.B) {
+	MulB8(benchScalar)
+	b.Run("Mul", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			NewPoint().Mul(benchScalar, B8)
+		}
+	})
+	b.Run("MulB8", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			MulB8(benchScalar)
+		}
+	})
+}
+
+func BenchmarkMulDouble(b *testing.B) {
+	p := MulB8(big.NewInt(1234567))
+	b.Run("TwoMul", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			left := NewPoint().Mul(benchScalar, B8).Projective()
+			left.Add(left, NewPoint().Mul(benchScalar, p).Projective())
+			left.Affine()
+		}
+	})
+	b.Run("Separate", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			res := mulWindowProjective(benchScalar, p)
+			res.Add(res, mulB8Projective(new(ffsub.Element).SetBigInt(benchScalar)))
+			res.Affine()
+		}
+	})
+	b.Run("MulDouble", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			MulDouble(benchScalar, benchScalar, p)
+		}
+	})
+}
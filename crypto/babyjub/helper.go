@@ -1,9 +1,25 @@
 package babyjub
 
 import (
+	"math/big"
+
 	"github.com/dchest/blake512"
+
+	"github.com/vivijj/ziongo/crypto/poseidon"
 )
 
+// bytesDomainTag separates the messages hashed by HashBytes from any other
+// field element signed by the same key.
+const bytesDomainTag = "zion.babyjub.bytes.v1"
+
+// bytesChunkSize is the number of message bytes packed in a field element, it's
+// lower than 32 so that every chunk is lower than Q.
+const bytesChunkSize = 31
+
+// bytesHashParam is the poseidon param of HashBytes, every permutation absorbs
+// the previous state and 5 chunks of the message.
+var bytesHashParam = poseidon.NewParams(6, 6, 52)
+
 // Note on dchest/blake512: This specific blake512 module is compatible with
 // the version of Blake512 used at circomlib, and this module has been reviewed
 // to don't be doing do anything suspicious.
@@ -18,3 +34,31 @@ func Blake512(m []byte) []byte {
 	}
 	return h.Sum(nil)
 }
+
+// HashBytes maps an arbitrary byte message to a field element with chained
+// poseidon hashes.  The message is split in chunks of 31 bytes, and the state
+// is seeded with a domain tag and the message length, so messages of different
+// length never collide through the zero padding.
+func HashBytes(msg []byte) *big.Int {
+	tag := new(big.Int).SetBytes([]byte(bytesDomainTag))
+	state := poseidon.Hash([]*big.Int{tag, big.NewInt(int64(len(msg)))}, bytesHashParam)
+
+	rate := 5
+	for i := 0; i == 0 || i < len(msg); i += rate * bytesChunkSize {
+		input := make([]*big.Int, 0, rate+1)
+		input = append(input, state)
+		for j := 0; j < rate; j++ {
+			lo := i + j*bytesChunkSize
+			hi := lo + bytesChunkSize
+			if lo > len(msg) {
+				lo = len(msg)
+			}
+			if hi > len(msg) {
+				hi = len(msg)
+			}
+			input = append(input, new(big.Int).SetBytes(msg[lo:hi]))
+		}
+		state = poseidon.Hash(input, bytesHashParam)
+	}
+	return state
+}
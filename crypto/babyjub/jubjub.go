@@ -198,7 +198,7 @@ func (p *Point) InSubGroup() bool {
 	if !p.InCurve() {
 		return false
 	}
-	res := NewPoint().Mul(SubOrder, p)
+	res := mulWindowProjective(SubOrder, p).Affine()
 	return (res.X.Cmp(constants.Zero) == 0) && (res.Y.Cmp(constants.One) == 0)
 }
 
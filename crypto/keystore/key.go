@@ -0,0 +1,199 @@
+// Package keystore encrypts babyjub private keys into JSON files in the style of
+// the Ethereum V3 keystore: the key is derived from the password with scrypt,
+// the private key is encrypted with AES-128-CTR and authenticated with a
+// keccak256 MAC.
+package keystore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+)
+
+const (
+	// StandardScryptN is the N parameter of scrypt for keys kept on disk.
+	StandardScryptN = 1 << 18
+	// StandardScryptP is the P parameter of scrypt for keys kept on disk.
+	StandardScryptP = 1
+
+	// LightScryptN is the N parameter of scrypt for a faster, weaker encryption.
+	LightScryptN = 1 << 12
+	// LightScryptP is the P parameter of scrypt for a faster, weaker encryption.
+	LightScryptP = 6
+
+	version     = 3
+	scryptR     = 8
+	scryptDKLen = 32
+	keyCipher   = "aes-128-ctr"
+	keyKdf      = "scrypt"
+)
+
+var (
+	ErrDecrypt     = errors.New("could not decrypt key with given password")
+	ErrNoMatch     = errors.New("no key for given public key")
+	ErrKeyExists   = errors.New("key already exists in the keystore")
+	ErrUnsupported = errors.New("unsupported keystore format")
+)
+
+// encryptedKeyJSON is the JSON representation of an encrypted key.
+type encryptedKeyJSON struct {
+	PublicKey string     `json:"publickey"`
+	Crypto    cryptoJSON `json:"crypto"`
+	Id        string     `json:"id"`
+	Version   int        `json:"version"`
+}
+
+type cryptoJSON struct {
+	Cipher       string       `json:"cipher"`
+	CipherText   string       `json:"ciphertext"`
+	CipherParams cipherParams `json:"cipherparams"`
+	KDF          string       `json:"kdf"`
+	KDFParams    scryptParams `json:"kdfparams"`
+	MAC          string       `json:"mac"`
+}
+
+type cipherParams struct {
+	IV string `json:"iv"`
+}
+
+type scryptParams struct {
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	DKLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+}
+
+// EncryptKey encrypts the key with the password into its keystore JSON, using
+// scryptN and scryptP as the scrypt parameters.
+func EncryptKey(key *babyjub.PrivateKey, password string, scryptN, scryptP int) ([]byte, error) {
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	derivedKey, err := scrypt.Key([]byte(password), salt, scryptN, scryptR, scryptP, scryptDKLen)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	cipherText, err := aesCTRXOR(derivedKey[:16], key[:], iv)
+	if err != nil {
+		return nil, err
+	}
+	mac := crypto.Keccak256(derivedKey[16:32], cipherText)
+
+	id, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encryptedKeyJSON{
+		PublicKey: key.Public().String(),
+		Crypto: cryptoJSON{
+			Cipher:       keyCipher,
+			CipherText:   hex.EncodeToString(cipherText),
+			CipherParams: cipherParams{IV: hex.EncodeToString(iv)},
+			KDF:          keyKdf,
+			KDFParams: scryptParams{
+				N:     scryptN,
+				R:     scryptR,
+				P:     scryptP,
+				DKLen: scryptDKLen,
+				Salt:  hex.EncodeToString(salt),
+			},
+			MAC: hex.EncodeToString(mac),
+		},
+		Id:      id,
+		Version: version,
+	})
+}
+
+// DecryptKey decrypts the keystore JSON with the password and returns the key.
+func DecryptKey(keyJSON []byte, password string) (*babyjub.PrivateKey, error) {
+	var k encryptedKeyJSON
+	if err := json.Unmarshal(keyJSON, &k); err != nil {
+		return nil, err
+	}
+	if k.Version != version || k.Crypto.Cipher != keyCipher || k.Crypto.KDF != keyKdf {
+		return nil, ErrUnsupported
+	}
+	params := k.Crypto.KDFParams
+	if params.DKLen != scryptDKLen {
+		return nil, ErrUnsupported
+	}
+
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := hex.DecodeString(k.Crypto.CipherParams.IV)
+	if err != nil {
+		return nil, err
+	}
+	cipherText, err := hex.DecodeString(k.Crypto.CipherText)
+	if err != nil {
+		return nil, err
+	}
+	mac, err := hex.DecodeString(k.Crypto.MAC)
+	if err != nil {
+		return nil, err
+	}
+
+	derivedKey, err := scrypt.Key([]byte(password), salt, params.N, params.R, params.P, params.DKLen)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(crypto.Keccak256(derivedKey[16:32], cipherText), mac) {
+		return nil, ErrDecrypt
+	}
+	plainText, err := aesCTRXOR(derivedKey[:16], cipherText, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	var key babyjub.PrivateKey
+	if len(plainText) != len(key) {
+		return nil, ErrUnsupported
+	}
+	copy(key[:], plainText)
+	if k.PublicKey != "" && key.Public().String() != k.PublicKey {
+		return nil, fmt.Errorf("decrypted key does not match public key %v", k.PublicKey)
+	}
+	return &key, nil
+}
+
+func aesCTRXOR(key, inText, iv []byte) ([]byte, error) {
+	aesBlock, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	stream := cipher.NewCTR(aesBlock, iv)
+	outText := make([]byte, len(inText))
+	stream.XORKeyStream(outText, inText)
+	return outText, nil
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	var u [16]byte
+	if _, err := io.ReadFull(rand.Reader, u[:]); err != nil {
+		return "", err
+	}
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
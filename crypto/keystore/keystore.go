@@ -0,0 +1,150 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+)
+
+// KeyStore manages the encrypted keys of a directory, each one in a file named
+// after its compressed public key.
+type KeyStore struct {
+	dir     string
+	scryptN int
+	scryptP int
+}
+
+// NewKeyStore creates a KeyStore over the directory dir, new keys are encrypted
+// with the scrypt parameters scryptN and scryptP.
+func NewKeyStore(dir string, scryptN, scryptP int) *KeyStore {
+	return &KeyStore{dir: dir, scryptN: scryptN, scryptP: scryptP}
+}
+
+// NewKey generates a random key, stores it encrypted with the password and
+// returns its public key.
+func (ks *KeyStore) NewKey(password string) (babyjub.PublicKeyComp, error) {
+	var key babyjub.PrivateKey
+	if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+		return babyjub.PublicKeyComp{}, err
+	}
+	return ks.Import(&key, password)
+}
+
+// Import stores the key encrypted with the password and returns its public
+// key. It fails with ErrKeyExists if the key is already in the keystore.
+func (ks *KeyStore) Import(key *babyjub.PrivateKey, password string) (babyjub.PublicKeyComp, error) {
+	pkComp := key.Public().Compress()
+	if _, err := os.Stat(ks.keyFile(pkComp)); err == nil {
+		return pkComp, ErrKeyExists
+	}
+	keyJSON, err := EncryptKey(key, password, ks.scryptN, ks.scryptP)
+	if err != nil {
+		return pkComp, err
+	}
+	return pkComp, ks.writeKeyFile(pkComp, keyJSON)
+}
+
+// ImportJSON stores a key exported from another keystore. The key is decrypted
+// with password and stored encrypted with newPassword.
+func (ks *KeyStore) ImportJSON(keyJSON []byte, password, newPassword string) (babyjub.PublicKeyComp, error) {
+	key, err := DecryptKey(keyJSON, password)
+	if err != nil {
+		return babyjub.PublicKeyComp{}, err
+	}
+	return ks.Import(key, newPassword)
+}
+
+// Export returns the keystore JSON of the key of pkComp, encrypted with
+// newPassword instead of its current password.
+func (ks *KeyStore) Export(pkComp babyjub.PublicKeyComp, password, newPassword string) ([]byte, error) {
+	key, err := ks.Unlock(pkComp, password)
+	if err != nil {
+		return nil, err
+	}
+	return EncryptKey(key, newPassword, ks.scryptN, ks.scryptP)
+}
+
+// Unlock decrypts the key of pkComp with the password.
+func (ks *KeyStore) Unlock(pkComp babyjub.PublicKeyComp, password string) (*babyjub.PrivateKey, error) {
+	keyJSON, err := os.ReadFile(ks.keyFile(pkComp))
+	if os.IsNotExist(err) {
+		return nil, ErrNoMatch
+	} else if err != nil {
+		return nil, err
+	}
+	return DecryptKey(keyJSON, password)
+}
+
+// Update changes the password of the key of pkComp.
+func (ks *KeyStore) Update(pkComp babyjub.PublicKeyComp, password, newPassword string) error {
+	key, err := ks.Unlock(pkComp, password)
+	if err != nil {
+		return err
+	}
+	keyJSON, err := EncryptKey(key, newPassword, ks.scryptN, ks.scryptP)
+	if err != nil {
+		return err
+	}
+	return ks.writeKeyFile(pkComp, keyJSON)
+}
+
+// Delete removes the key of pkComp, once the password is checked.
+func (ks *KeyStore) Delete(pkComp babyjub.PublicKeyComp, password string) error {
+	if _, err := ks.Unlock(pkComp, password); err != nil {
+		return err
+	}
+	return os.Remove(ks.keyFile(pkComp))
+}
+
+// Keys returns the public keys of all the keys of the keystore.
+func (ks *KeyStore) Keys() ([]babyjub.PublicKeyComp, error) {
+	entries, err := os.ReadDir(ks.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var pks []babyjub.PublicKeyComp
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		var pkComp babyjub.PublicKeyComp
+		if err := pkComp.UnmarshalText([]byte(strings.TrimSuffix(name, ".json"))); err != nil {
+			continue
+		}
+		pks = append(pks, pkComp)
+	}
+	return pks, nil
+}
+
+func (ks *KeyStore) keyFile(pkComp babyjub.PublicKeyComp) string {
+	return filepath.Join(ks.dir, pkComp.String()+".json")
+}
+
+// writeKeyFile writes the key file through a temporary file, so a crash never
+// leaves a truncated key behind.
+func (ks *KeyStore) writeKeyFile(pkComp babyjub.PublicKeyComp, keyJSON []byte) error {
+	if err := os.MkdirAll(ks.dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(ks.dir, ".tmp-"+pkComp.String())
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(keyJSON); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), ks.keyFile(pkComp))
+}
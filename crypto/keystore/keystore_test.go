@@ -0,0 +1,69 @@
+package keystore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+)
+
+func TestEncryptDecryptKey(t *testing.T) {
+	key := babyjub.PrivateKey{1, 2, 3, 4, 5}
+	keyJSON, err := EncryptKey(&key, "foo", LightScryptN, LightScryptP)
+	require.Nil(t, err)
+
+	dec, err := DecryptKey(keyJSON, "foo")
+	require.Nil(t, err)
+	assert.Equal(t, key, *dec)
+
+	_, err = DecryptKey(keyJSON, "bar")
+	assert.Equal(t, ErrDecrypt, err)
+}
+
+func TestKeyStore(t *testing.T) {
+	ks := NewKeyStore(t.TempDir(), LightScryptN, LightScryptP)
+
+	pk, err := ks.NewKey("foo")
+	require.Nil(t, err)
+	key := babyjub.PrivateKey{9, 8, 7}
+	pkImported, err := ks.Import(&key, "bar")
+	require.Nil(t, err)
+	assert.Equal(t, key.Public().Compress(), pkImported)
+	_, err = ks.Import(&key, "bar")
+	assert.Equal(t, ErrKeyExists, err)
+
+	pks, err := ks.Keys()
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []babyjub.PublicKeyComp{pk, pkImported}, pks)
+
+	unlocked, err := ks.Unlock(pkImported, "bar")
+	require.Nil(t, err)
+	assert.Equal(t, key, *unlocked)
+	_, err = ks.Unlock(pkImported, "foo")
+	assert.Equal(t, ErrDecrypt, err)
+	_, err = ks.Unlock(babyjub.PublicKeyComp{}, "foo")
+	assert.Equal(t, ErrNoMatch, err)
+
+	require.Nil(t, ks.Update(pkImported, "bar", "baz"))
+	_, err = ks.Unlock(pkImported, "bar")
+	assert.Equal(t, ErrDecrypt, err)
+	_, err = ks.Unlock(pkImported, "baz")
+	assert.Nil(t, err)
+
+	exported, err := ks.Export(pkImported, "baz", "qux")
+	require.Nil(t, err)
+	other := NewKeyStore(t.TempDir(), LightScryptN, LightScryptP)
+	pkOther, err := other.ImportJSON(exported, "qux", "quux")
+	require.Nil(t, err)
+	assert.Equal(t, pkImported, pkOther)
+	unlocked, err = other.Unlock(pkOther, "quux")
+	require.Nil(t, err)
+	assert.Equal(t, key, *unlocked)
+
+	require.Nil(t, ks.Delete(pk, "foo"))
+	pks, err = ks.Keys()
+	require.Nil(t, err)
+	assert.Equal(t, []babyjub.PublicKeyComp{pkImported}, pks)
+}
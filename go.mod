@@ -4,6 +4,8 @@ go 1.18
 
 require (
 	github.com/dchest/blake512 v1.0.0
+	github.com/ethereum/go-ethereum v1.10.16
+	github.com/gin-gonic/gin v1.7.7
 	github.com/leanovate/gopter v0.2.9
 	github.com/stretchr/testify v1.7.0
 	go.mongodb.org/mongo-driver v1.8.4
@@ -14,9 +16,7 @@ require (
 require (
 	github.com/btcsuite/btcd v0.22.0-beta // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/ethereum/go-ethereum v1.10.16 // indirect
 	github.com/gin-contrib/sse v0.1.0 // indirect
-	github.com/gin-gonic/gin v1.7.7 // indirect
 	github.com/go-playground/locales v0.14.0 // indirect
 	github.com/go-playground/universal-translator v0.18.0 // indirect
 	github.com/go-playground/validator/v10 v10.10.1 // indirect
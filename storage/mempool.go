@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/vivijj/ziongo/storage/record"
+	"github.com/vivijj/ziongo/types/token"
+	"github.com/vivijj/ziongo/types/transaction"
+)
+
+const (
+	mempoolTxsCollection         = "mempool_txs"
+	mempoolPriorityOpsCollection = "mempool_priority_ops"
+)
+
+// The types of the stored priority txs.
+const (
+	priorityDeposit  = "Deposit"
+	priorityFullExit = "FullExit"
+	priorityNewToken = "NewToken"
+)
+
+// priorityOpsOrder sorts the stored priority txs by L1 block and index.
+var priorityOpsOrder = bson.D{{Key: "l1_block", Value: 1}, {Key: "l1_block_index", Value: 1}}
+
+// MempoolSchema is the storage of the txs of the mempool, which are restored after
+// a restart.
+type MempoolSchema struct {
+	p *Processor
+}
+
+func (p *Processor) MempoolSchema() *MempoolSchema {
+	return &MempoolSchema{p: p}
+}
+
+// StoreTx stores the tx of the hash, a tx already stored keeps its place.
+func (s *MempoolSchema) StoreTx(ctx context.Context, hash common.Hash, tx transaction.ZionTx) error {
+	rec, err := mempoolTxRecord(hash, tx)
+	if err != nil {
+		return err
+	}
+	_, err = s.p.AccessCollection(mempoolTxsCollection).ReplaceOne(
+		ctx,
+		bson.M{"tx_hash": rec.TxHash},
+		rec,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// RemoveTxs removes the stored txs of the hashes.
+func (s *MempoolSchema) RemoveTxs(ctx context.Context, hashes []common.Hash) error {
+	hexes := make([]string, len(hashes))
+	for i, hash := range hashes {
+		hexes[i] = hash.Hex()
+	}
+	_, err := s.p.AccessCollection(mempoolTxsCollection).DeleteMany(
+		ctx,
+		bson.M{"tx_hash": bson.M{"$in": hexes}},
+	)
+	return err
+}
+
+// LoadTxs returns the stored txs in the order they were stored, which is the order
+// of their object ids.
+func (s *MempoolSchema) LoadTxs(ctx context.Context) ([]transaction.ZionTx, error) {
+	cursor, err := s.p.AccessCollection(mempoolTxsCollection).Find(
+		ctx,
+		bson.M{},
+		options.Find().SetSort(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var recs []record.StorageMempoolTx
+	if err := cursor.All(ctx, &recs); err != nil {
+		return nil, err
+	}
+	txs := make([]transaction.ZionTx, 0, len(recs))
+	for _, rec := range recs {
+		tx, err := mempoolTxFromRecord(rec)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// StorePriorityTx stores the priority tx, replacing the stored priority tx of the
+// same L1 block and index.
+func (s *MempoolSchema) StorePriorityTx(ctx context.Context, tx transaction.PriorityTx) error {
+	rec, err := priorityOpRecord(tx)
+	if err != nil {
+		return err
+	}
+	_, err = s.p.AccessCollection(mempoolPriorityOpsCollection).ReplaceOne(
+		ctx,
+		bson.M{"l1_block": rec.L1Block, "l1_block_index": rec.L1BlockIndex},
+		rec,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// RemovePriorityTxs removes the stored priority txs of the same L1 blocks and
+// indexes as the txs.
+func (s *MempoolSchema) RemovePriorityTxs(ctx context.Context, txs []transaction.PriorityTx) error {
+	if len(txs) == 0 {
+		return nil
+	}
+	keys := make(bson.A, len(txs))
+	for i, tx := range txs {
+		keys[i] = bson.M{"l1_block": tx.L1Block, "l1_block_index": tx.L1BlockIndex}
+	}
+	_, err := s.p.AccessCollection(mempoolPriorityOpsCollection).DeleteMany(
+		ctx,
+		bson.M{"$or": keys},
+	)
+	return err
+}
+
+// LoadPriorityTxs returns the stored priority txs ordered by L1 block and index.
+func (s *MempoolSchema) LoadPriorityTxs(ctx context.Context) ([]transaction.PriorityTx, error) {
+	cursor, err := s.p.AccessCollection(mempoolPriorityOpsCollection).Find(
+		ctx,
+		bson.M{},
+		options.Find().SetSort(priorityOpsOrder),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var recs []record.StoragePriorityOp
+	if err := cursor.All(ctx, &recs); err != nil {
+		return nil, err
+	}
+	txs := make([]transaction.PriorityTx, 0, len(recs))
+	for _, rec := range recs {
+		tx, err := priorityTxFromRecord(rec)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// StoreToken stores the token registered by an executed NewToken priority tx, see
+// TokensSchema.StoreToken.
+func (s *MempoolSchema) StoreToken(ctx context.Context, t token.Token) error {
+	return s.p.TokensSchema().StoreToken(ctx, t)
+}
+
+func mempoolTxRecord(hash common.Hash, tx transaction.ZionTx) (record.StorageMempoolTx, error) {
+	data, err := json.Marshal(transaction.TypedZionTx{Value: tx})
+	if err != nil {
+		return record.StorageMempoolTx{}, err
+	}
+	return record.StorageMempoolTx{TxHash: hash.Hex(), Tx: string(data)}, nil
+}
+
+func mempoolTxFromRecord(rec record.StorageMempoolTx) (transaction.ZionTx, error) {
+	var tx transaction.TypedZionTx
+	if err := json.Unmarshal([]byte(rec.Tx), &tx); err != nil {
+		return nil, fmt.Errorf("mempool tx %s: %w", rec.TxHash, err)
+	}
+	return tx.Value, nil
+}
+
+func priorityOpRecord(tx transaction.PriorityTx) (record.StoragePriorityOp, error) {
+	var typ string
+	switch tx.Data.(type) {
+	case transaction.DepositTx:
+		typ = priorityDeposit
+	case transaction.FullExitTx:
+		typ = priorityFullExit
+	case transaction.NewTokenTx:
+		typ = priorityNewToken
+	default:
+		return record.StoragePriorityOp{}, fmt.Errorf("unknown priority tx type %T", tx.Data)
+	}
+	data, err := json.Marshal(tx.Data)
+	if err != nil {
+		return record.StoragePriorityOp{}, err
+	}
+	return record.StoragePriorityOp{
+		L1Hash:       tx.L1Hash.Hex(),
+		L1Block:      tx.L1Block,
+		L1BlockIndex: tx.L1BlockIndex,
+		Type:         typ,
+		Data:         string(data),
+	}, nil
+}
+
+func priorityTxFromRecord(rec record.StoragePriorityOp) (transaction.PriorityTx, error) {
+	var data transaction.ZionPriTx
+	var err error
+	switch rec.Type {
+	case priorityDeposit:
+		var deposit transaction.DepositTx
+		err = json.Unmarshal([]byte(rec.Data), &deposit)
+		data = deposit
+	case priorityFullExit:
+		var fullExit transaction.FullExitTx
+		err = json.Unmarshal([]byte(rec.Data), &fullExit)
+		data = fullExit
+	case priorityNewToken:
+		var newToken transaction.NewTokenTx
+		err = json.Unmarshal([]byte(rec.Data), &newToken)
+		data = newToken
+	default:
+		err = fmt.Errorf("unknown type %q", rec.Type)
+	}
+	if err != nil {
+		return transaction.PriorityTx{}, fmt.Errorf("priority tx of L1 block %d index %d: %w", rec.L1Block, rec.L1BlockIndex, err)
+	}
+	return transaction.PriorityTx{
+		L1Hash:       common.HexToHash(rec.L1Hash),
+		L1Block:      rec.L1Block,
+		L1BlockIndex: rec.L1BlockIndex,
+		Data:         data,
+	}, nil
+}
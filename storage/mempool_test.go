@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/vivijj/ziongo/storage/record"
+	"github.com/vivijj/ziongo/types/transaction"
+)
+
+// bsonRoundTrip encodes the record like the collection does and decodes it back.
+func bsonRoundTrip[T any](t *testing.T, rec T) T {
+	data, err := bson.Marshal(rec)
+	require.NoError(t, err)
+	var decoded T
+	require.NoError(t, bson.Unmarshal(data, &decoded))
+	return decoded
+}
+
+func TestMempoolTxRecord(t *testing.T) {
+	addr := common.HexToAddress("0x2a500A5e1950aea40C22d8885C8DC3c02e99b3E2")
+	transfer := transaction.TransferTx{
+		AccountId:  1,
+		Nonce:      12,
+		ValidUntil: 1700000000,
+		Fee:        big.NewInt(1000),
+		From:       addr,
+		To:         common.HexToAddress("0xabc"),
+		Token:      2,
+		Amount:     new(big.Int).Lsh(big.NewInt(1), 200),
+	}
+	withdraw := transaction.WithdrawTx{
+		AccountId:  7,
+		Nonce:      3,
+		ValidUntil: 1700000000,
+		FeeToken:   1,
+		Fee:        big.NewInt(5),
+		From:       addr,
+		To:         addr,
+		Token:      1,
+		Amount:     big.NewInt(123456789),
+		MinGas:     big.NewInt(21000),
+	}
+	for _, tx := range []transaction.ZionTx{transfer, withdraw, transaction.BatchTx{Txs: []transaction.ZionTx{transfer, withdraw}}} {
+		hash := transaction.ZionTxHash(tx)
+		rec, err := mempoolTxRecord(hash, tx)
+		require.NoError(t, err)
+
+		decoded := bsonRoundTrip(t, rec)
+		assert.Equal(t, hash.Hex(), decoded.TxHash)
+		loaded, err := mempoolTxFromRecord(decoded)
+		require.NoError(t, err)
+		assert.IsType(t, tx, loaded)
+		assert.Equal(t, hash, transaction.ZionTxHash(loaded))
+	}
+
+	_, err := mempoolTxFromRecord(record.StorageMempoolTx{TxHash: "0x01", Tx: `{"Type":"Teleport","Value":{}}`})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mempool tx 0x01")
+}
+
+func TestPriorityOpRecord(t *testing.T) {
+	addr := common.HexToAddress("0x2a500A5e1950aea40C22d8885C8DC3c02e99b3E2")
+	for typ, data := range map[string]transaction.ZionPriTx{
+		priorityDeposit:  transaction.DepositTx{From: addr, To: addr, Amount: big.NewInt(1e18), Token: 1},
+		priorityFullExit: transaction.FullExitTx{AccountId: 7, EthAddress: addr, Token: 1},
+		priorityNewToken: transaction.NewTokenTx{Id: 2, Address: common.HexToAddress("0x02"), Symbol: "DAI", Decimals: 18},
+	} {
+		tx := transaction.PriorityTx{L1Hash: common.HexToHash("0x1234"), L1Block: 10, L1BlockIndex: 3, Data: data}
+		rec, err := priorityOpRecord(tx)
+		require.NoError(t, err)
+		assert.Equal(t, typ, rec.Type)
+
+		loaded, err := priorityTxFromRecord(bsonRoundTrip(t, rec))
+		require.NoError(t, err)
+		assert.Equal(t, tx, loaded)
+	}
+
+	_, err := priorityOpRecord(transaction.PriorityTx{})
+	assert.Error(t, err)
+	_, err = priorityTxFromRecord(record.StoragePriorityOp{L1Block: 10, L1BlockIndex: 3, Type: "Teleport", Data: "{}"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "L1 block 10 index 3")
+	_, err = priorityTxFromRecord(record.StoragePriorityOp{Type: priorityDeposit, Data: `{"Amount":`})
+	assert.Error(t, err)
+}
+
+// TestPriorityOpsOrder checks that the priority txs are loaded sorted by the
+// fields their records are stored with, the L1 block first.
+func TestPriorityOpsOrder(t *testing.T) {
+	rec, err := priorityOpRecord(transaction.PriorityTx{L1Block: 10, L1BlockIndex: 3, Data: transaction.FullExitTx{}})
+	require.NoError(t, err)
+	data, err := bson.Marshal(rec)
+	require.NoError(t, err)
+	var fields bson.M
+	require.NoError(t, bson.Unmarshal(data, &fields))
+
+	require.Len(t, priorityOpsOrder, 2)
+	assert.Equal(t, bson.E{Key: "l1_block", Value: 1}, priorityOpsOrder[0])
+	assert.Equal(t, bson.E{Key: "l1_block_index", Value: 1}, priorityOpsOrder[1])
+	assert.EqualValues(t, 10, fields[priorityOpsOrder[0].Key])
+	assert.EqualValues(t, 3, fields[priorityOpsOrder[1].Key])
+}
@@ -0,0 +1,18 @@
+package record
+
+// StorageMempoolTx is a tx of the mempool, Tx is its JSON form with its type,
+// see transaction.TypedZionTx.
+type StorageMempoolTx struct {
+	TxHash string `json:"tx_hash" bson:"tx_hash"`
+	Tx     string `json:"tx" bson:"tx"`
+}
+
+// StoragePriorityOp is a priority tx of the mempool, Data is the JSON form of the
+// tx of the Type.
+type StoragePriorityOp struct {
+	L1Hash       string `json:"l1_hash" bson:"l1_hash"`
+	L1Block      int    `json:"l1_block" bson:"l1_block"`
+	L1BlockIndex int    `json:"l1_block_index" bson:"l1_block_index"`
+	Type         string `json:"type" bson:"type"`
+	Data         string `json:"data" bson:"data"`
+}
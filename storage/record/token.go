@@ -0,0 +1,10 @@
+package record
+
+// StorageToken is a registered token, see token.Token.
+type StorageToken struct {
+	Id          int    `json:"id" bson:"id"`
+	Address     string `json:"address" bson:"address"`
+	Symbol      string `json:"symbol" bson:"symbol"`
+	Decimals    uint8  `json:"decimals" bson:"decimals"`
+	FeeEligible bool   `json:"fee_eligible" bson:"fee_eligible"`
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/vivijj/ziongo/storage/record"
+	"github.com/vivijj/ziongo/types/token"
+)
+
+const tokensCollection = "tokens"
+
+// TokensSchema is the storage of the token registry.
+type TokensSchema struct {
+	p *Processor
+}
+
+func (p *Processor) TokensSchema() *TokensSchema {
+	return &TokensSchema{p: p}
+}
+
+// StoreToken stores the token, replacing the stored token of the same id.
+func (s *TokensSchema) StoreToken(ctx context.Context, t token.Token) error {
+	_, err := s.p.AccessCollection(tokensCollection).ReplaceOne(
+		ctx,
+		bson.M{"id": t.Id},
+		tokenRecord(t),
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// LoadTokens returns the stored tokens ordered by id.
+func (s *TokensSchema) LoadTokens(ctx context.Context) ([]token.Token, error) {
+	cursor, err := s.p.AccessCollection(tokensCollection).Find(
+		ctx,
+		bson.M{},
+		options.Find().SetSort(bson.M{"id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var recs []record.StorageToken
+	if err := cursor.All(ctx, &recs); err != nil {
+		return nil, err
+	}
+	tokens := make([]token.Token, 0, len(recs))
+	for _, rec := range recs {
+		tokens = append(tokens, tokenFromRecord(rec))
+	}
+	return tokens, nil
+}
+
+// LoadRegistry returns the registry of the stored tokens.
+func (s *TokensSchema) LoadRegistry(ctx context.Context) (*token.Registry, error) {
+	tokens, err := s.LoadTokens(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return token.NewRegistry(tokens...)
+}
+
+func tokenRecord(t token.Token) record.StorageToken {
+	return record.StorageToken{
+		Id:          t.Id,
+		Address:     t.Address.Hex(),
+		Symbol:      t.Symbol,
+		Decimals:    t.Decimals,
+		FeeEligible: t.FeeEligible,
+	}
+}
+
+func tokenFromRecord(rec record.StorageToken) token.Token {
+	return token.Token{
+		Id:          rec.Id,
+		Address:     common.HexToAddress(rec.Address),
+		Symbol:      rec.Symbol,
+		Decimals:    rec.Decimals,
+		FeeEligible: rec.FeeEligible,
+	}
+}
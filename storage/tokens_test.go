@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/vivijj/ziongo/storage/record"
+	"github.com/vivijj/ziongo/types/token"
+)
+
+func TestTokenRecord(t *testing.T) {
+	tokens := []token.Token{
+		{Id: 0, Symbol: "ETH", Decimals: 18, FeeEligible: true},
+		{Id: 2, Address: common.HexToAddress("0x6b175474e89094c44da98b954eedeac495271d0f"), Symbol: "DAI", Decimals: 18},
+	}
+	loaded := make([]token.Token, 0, len(tokens))
+	for _, tok := range tokens {
+		data, err := bson.Marshal(tokenRecord(tok))
+		require.NoError(t, err)
+		var rec record.StorageToken
+		require.NoError(t, bson.Unmarshal(data, &rec))
+		loaded = append(loaded, tokenFromRecord(rec))
+	}
+	assert.Equal(t, tokens, loaded)
+
+	registry, err := token.NewRegistry(loaded...)
+	require.NoError(t, err)
+	assert.Equal(t, tokens, registry.Tokens())
+}
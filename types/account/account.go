@@ -14,8 +14,14 @@ import (
 
 var (
 	AccountHasher = hasher.NewPoseidonHasher(6)
+	// BalanceTreeHasher hashes the 4 children of a node of the balance tree.
+	BalanceTreeHasher = hasher.NewPoseidonHasher(5)
 )
 
+// BalanceTreeDepth is the depth of the balance tree, so token ids are lower than
+// 4^BalanceTreeDepth.
+const BalanceTreeDepth = 16
+
 // Account is zion network account
 type Account struct {
 	Address     common.Address
@@ -25,6 +31,35 @@ type Account struct {
 	BalanceTree smt.SparseQuadMerkleTree
 }
 
+// New returns the account of the address, with no public key and an empty balance
+// tree.
+func New(address common.Address) *Account {
+	emptyLeaf := witness.BalanceLeaf{Balance: big.NewInt(0)}
+	return &Account{
+		Address:     address,
+		Balances:    make(map[int]*big.Int),
+		BalanceTree: *smt.New(BalanceTreeDepth, fr.FromBigInt(emptyLeaf.Hash()), *BalanceTreeHasher),
+	}
+}
+
+// Copy returns a copy of the account which is not changed by the updates of a.
+func (a *Account) Copy() *Account {
+	cpy := *a
+	cpy.Balances = make(map[int]*big.Int, len(a.Balances))
+	for tokenId, balance := range a.Balances {
+		cpy.Balances[tokenId] = new(big.Int).Set(balance)
+	}
+	// the nodes of the tree are cached by their hash and never removed, so the
+	// copy only needs its own root.
+	return &cpy
+}
+
+// HasPublicKey tells whether a public key is set, an account without it is locked
+// for the L2 transactions.
+func (a *Account) HasPublicKey() bool {
+	return a.PublicKey.X != nil && a.PublicKey.Y != nil
+}
+
 func (a *Account) IsEmpty() bool {
 	return a.Address == common.Address{}
 }
@@ -33,14 +68,20 @@ func (a *Account) BalanceRoot() fr.Repr {
 	return a.BalanceTree.RootHash()
 }
 
-func (a *Account) VerifySignature(sig *babyjub.Signature, msg *big.Int) bool {
-	return a.PublicKey.VerifyPoseidon(msg, sig)
+// VerifySignature verifies a L2 signature made by this account in the strict mode,
+// which is the one used for transaction processing.
+func (a *Account) VerifySignature(sig *babyjub.Signature, msg *big.Int) error {
+	return a.PublicKey.VerifyPoseidonStrict(msg, sig)
 }
 
+// Hash returns the leaf of the account in the account tree, the coordinates of a
+// missing public key are 0.
 func (a *Account) Hash() fr.Repr {
 	address := fr.FromAddress(a.Address)
-	publicKeyX := fr.FromBigInt(a.PublicKey.X)
-	publicKeyY := fr.FromBigInt(a.PublicKey.Y)
+	publicKeyX, publicKeyY := fr.FromInt(0), fr.FromInt(0)
+	if a.HasPublicKey() {
+		publicKeyX, publicKeyY = fr.FromBigInt(a.PublicKey.X), fr.FromBigInt(a.PublicKey.Y)
+	}
 	nonce := fr.FromInt(a.Nonce)
 	root := a.BalanceRoot()
 
@@ -69,5 +110,18 @@ func (a *Account) UpdateBalance(tokenId int, deltaBalance *big.Int) witness.Bala
 	if _, ok := a.Balances[tokenId]; !ok {
 		a.Balances[tokenId] = big.NewInt(0)
 	}
+	before := a.Balances[tokenId]
+	after := new(big.Int).Add(before, deltaBalance)
+	rootBefore := a.BalanceRoot()
+
+	a.Balances[tokenId] = after
+	a.BalanceTree.Update(tokenId, fr.FromBigInt(witness.BalanceLeaf{Balance: after}.Hash()))
 
+	return witness.BalanceUpdateWitness{
+		TokenId:    tokenId,
+		RootBefore: string(rootBefore),
+		RootAfter:  string(a.BalanceRoot()),
+		Before:     witness.BalanceLeaf{Balance: before},
+		After:      witness.BalanceLeaf{Balance: after},
+	}
 }
@@ -2,9 +2,11 @@ package account
 
 import (
 	"fmt"
+	"math/big"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestAddress(t *testing.T) {
@@ -14,3 +16,19 @@ func TestAddress(t *testing.T) {
 
 	fmt.Println(a == b)
 }
+
+func TestUpdateBalance(t *testing.T) {
+	a := New(common.HexToAddress("0x2a500A5e1950aea40C22d8885C8DC3c02e99b3E2"))
+	emptyRoot := a.BalanceRoot()
+
+	w := a.UpdateBalance(3, big.NewInt(100))
+	assert.Equal(t, int64(100), a.GetBalance(3).Int64())
+	assert.Equal(t, string(emptyRoot), w.RootBefore)
+	assert.NotEqual(t, emptyRoot, a.BalanceRoot())
+
+	cpy := a.Copy()
+	a.UpdateBalance(3, big.NewInt(-100))
+	assert.Equal(t, int64(0), a.GetBalance(3).Int64())
+	assert.Equal(t, int64(100), cpy.GetBalance(3).Int64())
+	assert.Equal(t, w.RootAfter, string(cpy.BalanceRoot()))
+}
@@ -0,0 +1,52 @@
+package account
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vivijj/ziongo/types/fr"
+	"github.com/vivijj/ziongo/utils/hasher"
+)
+
+// MinNFTTokenId is the first token id reserved for the NFTs, the fungible tokens
+// have lower ids.
+const MinNFTTokenId = 1 << 16
+
+// NFTTreeDepth is the depth of the NFT tree, the NFT of token id MinNFTTokenId+i
+// is its leaf i.
+const NFTTreeDepth = 16
+
+var (
+	NFTHasher = hasher.NewPoseidonHasher(6)
+	// NFTTreeHasher hashes the 4 children of a node of the NFT tree.
+	NFTTreeHasher = hasher.NewPoseidonHasher(5)
+)
+
+// NFT is the record of a minted non-fungible token, whose balance is 1 for its
+// owner.
+type NFT struct {
+	Id             int
+	CreatorId      int
+	CreatorAddress common.Address
+	// Serial is the number of NFTs minted by the creator before this one.
+	Serial      int
+	ContentHash common.Hash
+}
+
+// IsNFT tells whether the token id is the one of a NFT.
+func IsNFT(tokenId int) bool {
+	return tokenId >= MinNFTTokenId
+}
+
+// Hash returns the leaf of the NFT in the NFT tree, the content hash is split in
+// two 128 bits halves to fit in field elements.
+func (n NFT) Hash() fr.Repr {
+	return fr.FromBigInt(NFTHasher.HashBi([]*big.Int{
+		big.NewInt(int64(n.CreatorId)),
+		new(big.Int).SetBytes(n.CreatorAddress.Bytes()),
+		big.NewInt(int64(n.Serial)),
+		new(big.Int).SetBytes(n.ContentHash[:16]),
+		new(big.Int).SetBytes(n.ContentHash[16:]),
+	}))
+}
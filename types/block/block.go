@@ -7,6 +7,8 @@ import (
 	"github.com/vivijj/ziongo/types/witness"
 )
 
+// ProposedBlock is the txs proposed by the mempool for the next block, a
+// transaction.BatchTx is a single element of Txs, to be executed atomically.
 type ProposedBlock struct {
 	Txs    []transaction.ZionTx
 	PriTxs []transaction.ZionPriTx
@@ -73,6 +75,10 @@ type ExecutedTx struct {
 	FailReason string
 	BlockIndex int
 	CreatedAt  int64
+	// BatchId is the id of the batch of the tx, numbered from 1 in the block, the
+	// txs of a batch are contiguous in the block. It's 0 when the tx is not part
+	// of a batch.
+	BatchId int64
 }
 
 func (_ ExecutedTx) isExecutedOperation() {}
@@ -83,6 +89,31 @@ type ExecutedPriorityTx struct {
 	Op         operation.ZionOp
 	BlockIndex int
 	CreatedAt  int64
+	// Conflict is why a new token was not registered, as it conflicts with the
+	// token registry. The priority tx is then a noop.
+	Conflict string
 }
 
 func (_ ExecutedPriorityTx) isExecutedOperation() {}
+
+// Pubdata returns the pubdata of the block: the pubdata of every successful
+// operation in execution order, padded with noop chunks up to BlockSize chunks.
+func (b *Block) Pubdata() []byte {
+	var pubdata []byte
+	for _, exeOp := range b.BlockTransactions {
+		switch exe := exeOp.(type) {
+		case ExecutedTx:
+			if exe.Success && exe.Op != nil {
+				pubdata = append(pubdata, exe.Op.Pubdata()...)
+			}
+		case ExecutedPriorityTx:
+			if exe.Op != nil {
+				pubdata = append(pubdata, exe.Op.Pubdata()...)
+			}
+		}
+	}
+	for len(pubdata) < b.BlockSize*operation.ChunkBytes {
+		pubdata = append(pubdata, operation.NoopOp{}.Pubdata()...)
+	}
+	return pubdata
+}
@@ -0,0 +1,35 @@
+package block
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vivijj/ziongo/types/operation"
+	"github.com/vivijj/ziongo/types/transaction"
+)
+
+func TestBlockPubdata(t *testing.T) {
+	deposit := operation.DepositOp{
+		Tx:        transaction.DepositTx{Amount: big.NewInt(10), Token: 1},
+		AccountId: 3,
+	}
+	b := Block{
+		BlockTransactions: []ExecutedOperation{
+			ExecutedPriorityTx{Op: deposit},
+			ExecutedTx{Success: false, FailReason: "nonce mismatch"},
+			ExecutedPriorityTx{Op: deposit},
+		},
+		BlockSize: 2*operation.DepositOpChunks + 3,
+	}
+
+	pubdata := b.Pubdata()
+	assert.Equal(t, b.BlockSize*operation.ChunkBytes, len(pubdata))
+	depositData := deposit.Pubdata()
+	assert.Equal(t, depositData, pubdata[:len(depositData)])
+	assert.Equal(t, depositData, pubdata[len(depositData):2*len(depositData)])
+	for _, v := range pubdata[2*len(depositData):] {
+		assert.Zero(t, v)
+	}
+}
@@ -4,16 +4,22 @@ package operation
 import (
 	"math/big"
 
+	"github.com/ethereum/go-ethereum/common"
+
 	"github.com/vivijj/ziongo/types/transaction"
 )
 
 type ZionOp interface {
 	isZionOp()
+
+	// Pubdata returns the data published on L1 for the operation, a whole number of
+	// chunks.
+	Pubdata() []byte
 }
 
 type NoopOp struct{}
 
-func (op NoopOp) IsZionOp() {}
+func (op NoopOp) isZionOp() {}
 
 type DepositOp struct {
 	Tx        transaction.DepositTx
@@ -47,3 +53,70 @@ type WithdrawOp struct {
 }
 
 func (op WithdrawOp) isZionOp() {}
+
+// ForcedExitOp withdraws the whole balance WithdrawAmount of the target account.
+type ForcedExitOp struct {
+	Tx              transaction.ForcedExitTx
+	TargetAccountId int
+	WithdrawAmount  *big.Int
+}
+
+func (op ForcedExitOp) isZionOp() {}
+
+// FullExitOp withdraws the whole balance WithdrawAmount of the account, which is 0
+// when the L1 sender of the request doesn't own the account.
+type FullExitOp struct {
+	Tx             transaction.FullExitTx
+	WithdrawAmount *big.Int
+}
+
+func (op FullExitOp) isZionOp() {}
+
+// SwapOp moves the four balances of a matched swap. NonceMask has the bit i set
+// when Orders[i] is completely filled, so the nonce of its account is incremented.
+type SwapOp struct {
+	Tx        transaction.SwapTx
+	NonceMask byte
+}
+
+func (op SwapOp) isZionOp() {}
+
+// MintNFTOp mints the NFT of TokenId to the account RecipientId, Serial is the
+// number of NFTs minted by the creator before it.
+type MintNFTOp struct {
+	Tx          transaction.MintNFTTx
+	TokenId     int
+	Serial      int
+	RecipientId int
+}
+
+func (op MintNFTOp) isZionOp() {}
+
+// TransferNFTOp moves the NFT Tx.Token to the account ToId, which is created by
+// the transfer when the recipient is new.
+type TransferNFTOp struct {
+	Tx   transaction.TransferTx
+	ToId int
+}
+
+func (op TransferNFTOp) isZionOp() {}
+
+// WithdrawNFTOp withdraws the NFT Tx.Token to L1, along with its record so the
+// contract can mint it there.
+type WithdrawNFTOp struct {
+	Tx             transaction.WithdrawTx
+	CreatorId      int
+	CreatorAddress common.Address
+	Serial         int
+	ContentHash    common.Hash
+}
+
+func (op WithdrawNFTOp) isZionOp() {}
+
+// BatchOp is the operations of the txs of a batch, in order.  It has no pubdata
+// of its own, the operations of the batch are published one after another.
+type BatchOp struct {
+	Ops []ZionOp
+}
+
+func (op BatchOp) isZionOp() {}
@@ -0,0 +1,601 @@
+package operation
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+	"github.com/vivijj/ziongo/utils/floatencode"
+)
+
+// The pubdata of an operation is what the rollup contract receives for data
+// availability. It starts with the op type byte, followed by fixed width big
+// endian fields, and is padded with zeros to a whole number of chunks.
+// L2 amounts and fees are packed with floatencode, so they must be packable,
+// while amounts that go from/to L1 are kept in full as 16 bytes.
+
+// ChunkBytes is the size of a pubdata chunk.
+const ChunkBytes = 10
+
+const (
+	opTypeBytes       = 1
+	accountIdBytes    = 4
+	tokenBytes        = 4
+	nonceBytes        = 4
+	fullAmountBytes   = 16
+	packedAmountBytes = 3
+	packedFeeBytes    = 2
+	addressBytes      = common.AddressLength
+	pubkeyBytes       = 32
+	serialBytes       = 4
+	hashBytes         = common.HashLength
+)
+
+// FitsFullAmount tells whether the amount fits in the full amount field of the
+// pubdata, the state checks it when the operation is executed.
+func FitsFullAmount(v *big.Int) bool {
+	return v != nil && v.Sign() >= 0 && v.BitLen() <= 8*fullAmountBytes
+}
+
+var (
+	// AmountFloatEncoding is the encoding of the L2 amounts in the pubdata.
+	AmountFloatEncoding = floatencode.Float24Encoding
+	// FeeFloatEncoding is the encoding of the fees in the pubdata.
+	FeeFloatEncoding = floatencode.Float16Encoding
+)
+
+// OpType is the first byte of the pubdata of an operation.
+type OpType byte
+
+const (
+	NoopOpType          OpType = 0
+	DepositOpType       OpType = 1
+	TransferToNewOpType OpType = 2
+	WithdrawOpType      OpType = 3
+	TransferOpType      OpType = 5
+	FullExitOpType      OpType = 6
+	PubkeyUpdateOpType  OpType = 7
+	ForcedExitOpType    OpType = 8
+	SwapOpType          OpType = 9
+	MintNFTOpType       OpType = 10
+	TransferNFTOpType   OpType = 11
+	WithdrawNFTOpType   OpType = 12
+)
+
+// number of chunks of each operation.
+const (
+	NoopOpChunks          = 1
+	DepositOpChunks       = 5
+	TransferToNewOpChunks = 5
+	WithdrawOpChunks      = 6
+	TransferOpChunks      = 3
+	FullExitOpChunks      = 5
+	PubkeyUpdateOpChunks  = 7
+	ForcedExitOpChunks    = 6
+	SwapOpChunks          = 4
+	MintNFTOpChunks       = 8
+	TransferNFTOpChunks   = 4
+	WithdrawNFTOpChunks   = 10
+)
+
+var opChunks = map[OpType]int{
+	NoopOpType:          NoopOpChunks,
+	DepositOpType:       DepositOpChunks,
+	TransferToNewOpType: TransferToNewOpChunks,
+	WithdrawOpType:      WithdrawOpChunks,
+	TransferOpType:      TransferOpChunks,
+	FullExitOpType:      FullExitOpChunks,
+	PubkeyUpdateOpType:  PubkeyUpdateOpChunks,
+	ForcedExitOpType:    ForcedExitOpChunks,
+	SwapOpType:          SwapOpChunks,
+	MintNFTOpType:       MintNFTOpChunks,
+	TransferNFTOpType:   TransferNFTOpChunks,
+	WithdrawNFTOpType:   WithdrawNFTOpChunks,
+}
+
+// pubdataWriter writes the fields of an operation in a buffer of its chunks.
+type pubdataWriter struct {
+	buf []byte
+	pos int
+}
+
+func newPubdataWriter(opType OpType) *pubdataWriter {
+	w := &pubdataWriter{buf: make([]byte, opChunks[opType]*ChunkBytes)}
+	w.buf[0] = byte(opType)
+	w.pos = opTypeBytes
+	return w
+}
+
+func (w *pubdataWriter) uint(v int, n int) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	w.pos += copy(w.buf[w.pos:w.pos+n], b[8-n:])
+}
+
+// fullAmount writes the amount, which must fit, see FitsFullAmount.  An amount
+// that doesn't fit is never executed, it would be cut to its low 16 bytes.
+func (w *pubdataWriter) fullAmount(v *big.Int) {
+	b := v.Bytes()
+	if len(b) > fullAmountBytes {
+		b = b[len(b)-fullAmountBytes:]
+	}
+	copy(w.buf[w.pos+fullAmountBytes-len(b):], b)
+	w.pos += fullAmountBytes
+}
+
+func (w *pubdataWriter) packed(v *big.Int, encoding floatencode.FloatEncoding, n int) {
+	w.uint(int(floatencode.ToFloat(v, encoding)), n)
+}
+
+func (w *pubdataWriter) bytes(b []byte) {
+	w.pos += copy(w.buf[w.pos:], b)
+}
+
+// pubdataReader reads the fields of an operation from its pubdata.
+type pubdataReader struct {
+	buf []byte
+	pos int
+}
+
+func newPubdataReader(opType OpType, b []byte) (*pubdataReader, error) {
+	if len(b) != opChunks[opType]*ChunkBytes {
+		return nil, fmt.Errorf(
+			"expected %d bytes of pubdata for op type %d, got %d",
+			opChunks[opType]*ChunkBytes, opType, len(b),
+		)
+	}
+	if OpType(b[0]) != opType {
+		return nil, fmt.Errorf("op type %d is not %d", b[0], opType)
+	}
+	return &pubdataReader{buf: b, pos: opTypeBytes}, nil
+}
+
+func (r *pubdataReader) next(n int) []byte {
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *pubdataReader) uint(n int) int {
+	var b [8]byte
+	copy(b[8-n:], r.next(n))
+	return int(binary.BigEndian.Uint64(b[:]))
+}
+
+func (r *pubdataReader) fullAmount() *big.Int {
+	return new(big.Int).SetBytes(r.next(fullAmountBytes))
+}
+
+func (r *pubdataReader) packed(encoding floatencode.FloatEncoding, n int) *big.Int {
+	return floatencode.FromFloat(int64(r.uint(n)), encoding)
+}
+
+func (r *pubdataReader) address() common.Address {
+	return common.BytesToAddress(r.next(addressBytes))
+}
+
+func (r *pubdataReader) hash() common.Hash {
+	return common.BytesToHash(r.next(hashBytes))
+}
+
+// Pubdata returns the pubdata of the noop: a single zero chunk.
+func (op NoopOp) Pubdata() []byte {
+	return newPubdataWriter(NoopOpType).buf
+}
+
+// FromPubdata checks that b is the pubdata of a noop.
+func (op *NoopOp) FromPubdata(b []byte) error {
+	_, err := newPubdataReader(NoopOpType, b)
+	return err
+}
+
+// Pubdata returns the pubdata of the deposit:
+//
+//	op type | account id | token | full amount | address
+func (op DepositOp) Pubdata() []byte {
+	w := newPubdataWriter(DepositOpType)
+	w.uint(op.AccountId, accountIdBytes)
+	w.uint(int(op.Tx.Token), tokenBytes)
+	w.fullAmount(op.Tx.Amount)
+	w.bytes(op.Tx.To.Bytes())
+	return w.buf
+}
+
+// FromPubdata sets op from its pubdata.
+func (op *DepositOp) FromPubdata(b []byte) error {
+	r, err := newPubdataReader(DepositOpType, b)
+	if err != nil {
+		return err
+	}
+	op.AccountId = r.uint(accountIdBytes)
+	op.Tx.Token = uint16(r.uint(tokenBytes))
+	op.Tx.Amount = r.fullAmount()
+	op.Tx.To = r.address()
+	return nil
+}
+
+// Pubdata returns the pubdata of the transfer:
+//
+//	op type | from id | token | to id | packed amount | fee token | packed fee
+//
+// and when the recipient account is new, its address after the packed fee.
+func (op TransferOp) Pubdata() []byte {
+	opType := TransferOpType
+	if op.PutAddressInDa {
+		opType = TransferToNewOpType
+	}
+	w := newPubdataWriter(opType)
+	w.uint(op.Tx.AccountId, accountIdBytes)
+	w.uint(op.Tx.Token, tokenBytes)
+	w.uint(op.ToId, accountIdBytes)
+	w.packed(op.Tx.Amount, AmountFloatEncoding, packedAmountBytes)
+	w.uint(op.Tx.FeeToken, tokenBytes)
+	w.packed(op.Tx.Fee, FeeFloatEncoding, packedFeeBytes)
+	if op.PutAddressInDa {
+		w.bytes(op.Tx.To.Bytes())
+	}
+	return w.buf
+}
+
+// FromPubdata sets op from its pubdata, of a transfer or a transfer to a new
+// account.
+func (op *TransferOp) FromPubdata(b []byte) error {
+	opType := TransferOpType
+	if len(b) > 0 && OpType(b[0]) == TransferToNewOpType {
+		opType = TransferToNewOpType
+	}
+	r, err := newPubdataReader(opType, b)
+	if err != nil {
+		return err
+	}
+	op.Tx.AccountId = r.uint(accountIdBytes)
+	op.Tx.Token = r.uint(tokenBytes)
+	op.ToId = r.uint(accountIdBytes)
+	op.Tx.Amount = r.packed(AmountFloatEncoding, packedAmountBytes)
+	op.Tx.FeeToken = r.uint(tokenBytes)
+	op.Tx.Fee = r.packed(FeeFloatEncoding, packedFeeBytes)
+	op.PutAddressInDa = opType == TransferToNewOpType
+	if op.PutAddressInDa {
+		op.Tx.To = r.address()
+	}
+	return nil
+}
+
+// Pubdata returns the pubdata of the withdrawal:
+//
+//	op type | account id | token | full amount | fee token | packed fee | to address
+func (op WithdrawOp) Pubdata() []byte {
+	w := newPubdataWriter(WithdrawOpType)
+	w.uint(op.Tx.AccountId, accountIdBytes)
+	w.uint(op.Tx.Token, tokenBytes)
+	w.fullAmount(op.Tx.Amount)
+	w.uint(op.Tx.FeeToken, tokenBytes)
+	w.packed(op.Tx.Fee, FeeFloatEncoding, packedFeeBytes)
+	w.bytes(op.Tx.To.Bytes())
+	return w.buf
+}
+
+// FromPubdata sets op from its pubdata.
+func (op *WithdrawOp) FromPubdata(b []byte) error {
+	r, err := newPubdataReader(WithdrawOpType, b)
+	if err != nil {
+		return err
+	}
+	op.Tx.AccountId = r.uint(accountIdBytes)
+	op.Tx.Token = r.uint(tokenBytes)
+	op.Tx.Amount = r.fullAmount()
+	op.Tx.FeeToken = r.uint(tokenBytes)
+	op.Tx.Fee = r.packed(FeeFloatEncoding, packedFeeBytes)
+	op.Tx.To = r.address()
+	return nil
+}
+
+// Pubdata returns the pubdata of the pubkey update:
+//
+//	op type | account id | compressed pubkey | address | nonce | fee token | packed fee
+func (op PubkeyUpdateOp) Pubdata() []byte {
+	w := newPubdataWriter(PubkeyUpdateOpType)
+	w.uint(op.Tx.AccountId, accountIdBytes)
+	pkComp := op.Tx.PubKey.Compress()
+	w.bytes(pkComp[:])
+	w.bytes(op.Tx.Account.Bytes())
+	w.uint(op.Tx.Nonce, nonceBytes)
+	w.uint(op.Tx.FeeToken, tokenBytes)
+	w.packed(op.Tx.Fee, FeeFloatEncoding, packedFeeBytes)
+	return w.buf
+}
+
+// FromPubdata sets op from its pubdata.
+func (op *PubkeyUpdateOp) FromPubdata(b []byte) error {
+	r, err := newPubdataReader(PubkeyUpdateOpType, b)
+	if err != nil {
+		return err
+	}
+	op.Tx.AccountId = r.uint(accountIdBytes)
+	var pkComp babyjub.PublicKeyComp
+	copy(pkComp[:], r.next(pubkeyBytes))
+	pk, err := pkComp.Decompress()
+	if err != nil {
+		return err
+	}
+	op.Tx.PubKey = *pk
+	op.Tx.Account = r.address()
+	op.Tx.Nonce = r.uint(nonceBytes)
+	op.Tx.FeeToken = r.uint(tokenBytes)
+	op.Tx.Fee = r.packed(FeeFloatEncoding, packedFeeBytes)
+	return nil
+}
+
+// Pubdata returns the pubdata of the forced exit:
+//
+//	op type | initiator id | target id | token | full amount | fee token | packed fee | target address
+func (op ForcedExitOp) Pubdata() []byte {
+	w := newPubdataWriter(ForcedExitOpType)
+	w.uint(op.Tx.AccountId, accountIdBytes)
+	w.uint(op.TargetAccountId, accountIdBytes)
+	w.uint(op.Tx.Token, tokenBytes)
+	w.fullAmount(op.WithdrawAmount)
+	w.uint(op.Tx.FeeToken, tokenBytes)
+	w.packed(op.Tx.Fee, FeeFloatEncoding, packedFeeBytes)
+	w.bytes(op.Tx.Target.Bytes())
+	return w.buf
+}
+
+// FromPubdata sets op from its pubdata.
+func (op *ForcedExitOp) FromPubdata(b []byte) error {
+	r, err := newPubdataReader(ForcedExitOpType, b)
+	if err != nil {
+		return err
+	}
+	op.Tx.AccountId = r.uint(accountIdBytes)
+	op.TargetAccountId = r.uint(accountIdBytes)
+	op.Tx.Token = r.uint(tokenBytes)
+	op.WithdrawAmount = r.fullAmount()
+	op.Tx.FeeToken = r.uint(tokenBytes)
+	op.Tx.Fee = r.packed(FeeFloatEncoding, packedFeeBytes)
+	op.Tx.Target = r.address()
+	return nil
+}
+
+// Pubdata returns the pubdata of the full exit:
+//
+//	op type | account id | eth address | token | full amount
+func (op FullExitOp) Pubdata() []byte {
+	w := newPubdataWriter(FullExitOpType)
+	w.uint(op.Tx.AccountId, accountIdBytes)
+	w.bytes(op.Tx.EthAddress.Bytes())
+	w.uint(op.Tx.Token, tokenBytes)
+	w.fullAmount(op.WithdrawAmount)
+	return w.buf
+}
+
+// FromPubdata sets op from its pubdata.
+func (op *FullExitOp) FromPubdata(b []byte) error {
+	r, err := newPubdataReader(FullExitOpType, b)
+	if err != nil {
+		return err
+	}
+	op.Tx.AccountId = r.uint(accountIdBytes)
+	op.Tx.EthAddress = r.address()
+	op.Tx.Token = r.uint(tokenBytes)
+	op.WithdrawAmount = r.fullAmount()
+	return nil
+}
+
+// Pubdata returns the pubdata of the swap:
+//
+//	op type | submitter id | account id 0 | account id 1 | token sold 0 | token sold 1 |
+//	packed amount 0 | packed amount 1 | fee token | packed fee | nonce mask
+func (op SwapOp) Pubdata() []byte {
+	w := newPubdataWriter(SwapOpType)
+	w.uint(op.Tx.SubmitterId, accountIdBytes)
+	w.uint(op.Tx.Orders[0].AccountId, accountIdBytes)
+	w.uint(op.Tx.Orders[1].AccountId, accountIdBytes)
+	w.uint(op.Tx.Orders[0].TokenSell, tokenBytes)
+	w.uint(op.Tx.Orders[1].TokenSell, tokenBytes)
+	w.packed(op.Tx.Amounts[0], AmountFloatEncoding, packedAmountBytes)
+	w.packed(op.Tx.Amounts[1], AmountFloatEncoding, packedAmountBytes)
+	w.uint(op.Tx.FeeToken, tokenBytes)
+	w.packed(op.Tx.Fee, FeeFloatEncoding, packedFeeBytes)
+	w.uint(int(op.NonceMask), 1)
+	return w.buf
+}
+
+// FromPubdata sets op from its pubdata, the tokens bought by the orders are the
+// ones sold by the other order.
+func (op *SwapOp) FromPubdata(b []byte) error {
+	r, err := newPubdataReader(SwapOpType, b)
+	if err != nil {
+		return err
+	}
+	op.Tx.SubmitterId = r.uint(accountIdBytes)
+	op.Tx.Orders[0].AccountId = r.uint(accountIdBytes)
+	op.Tx.Orders[1].AccountId = r.uint(accountIdBytes)
+	op.Tx.Orders[0].TokenSell = r.uint(tokenBytes)
+	op.Tx.Orders[1].TokenSell = r.uint(tokenBytes)
+	op.Tx.Orders[0].TokenBuy = op.Tx.Orders[1].TokenSell
+	op.Tx.Orders[1].TokenBuy = op.Tx.Orders[0].TokenSell
+	op.Tx.Amounts[0] = r.packed(AmountFloatEncoding, packedAmountBytes)
+	op.Tx.Amounts[1] = r.packed(AmountFloatEncoding, packedAmountBytes)
+	op.Tx.FeeToken = r.uint(tokenBytes)
+	op.Tx.Fee = r.packed(FeeFloatEncoding, packedFeeBytes)
+	op.NonceMask = byte(r.uint(1))
+	return nil
+}
+
+// Pubdata returns the pubdata of the NFT mint:
+//
+//	op type | creator id | creator address | content hash | recipient id | token |
+//	serial | fee token | packed fee
+func (op MintNFTOp) Pubdata() []byte {
+	w := newPubdataWriter(MintNFTOpType)
+	w.uint(op.Tx.CreatorId, accountIdBytes)
+	w.bytes(op.Tx.CreatorAddress.Bytes())
+	w.bytes(op.Tx.ContentHash.Bytes())
+	w.uint(op.RecipientId, accountIdBytes)
+	w.uint(op.TokenId, tokenBytes)
+	w.uint(op.Serial, serialBytes)
+	w.uint(op.Tx.FeeToken, tokenBytes)
+	w.packed(op.Tx.Fee, FeeFloatEncoding, packedFeeBytes)
+	return w.buf
+}
+
+// FromPubdata sets op from its pubdata, the recipient address is not part of it.
+func (op *MintNFTOp) FromPubdata(b []byte) error {
+	r, err := newPubdataReader(MintNFTOpType, b)
+	if err != nil {
+		return err
+	}
+	op.Tx.CreatorId = r.uint(accountIdBytes)
+	op.Tx.CreatorAddress = r.address()
+	op.Tx.ContentHash = r.hash()
+	op.RecipientId = r.uint(accountIdBytes)
+	op.TokenId = r.uint(tokenBytes)
+	op.Serial = r.uint(serialBytes)
+	op.Tx.FeeToken = r.uint(tokenBytes)
+	op.Tx.Fee = r.packed(FeeFloatEncoding, packedFeeBytes)
+	return nil
+}
+
+// Pubdata returns the pubdata of the NFT transfer, whose amount is always 1:
+//
+//	op type | from id | to id | token | fee token | packed fee | to address
+func (op TransferNFTOp) Pubdata() []byte {
+	w := newPubdataWriter(TransferNFTOpType)
+	w.uint(op.Tx.AccountId, accountIdBytes)
+	w.uint(op.ToId, accountIdBytes)
+	w.uint(op.Tx.Token, tokenBytes)
+	w.uint(op.Tx.FeeToken, tokenBytes)
+	w.packed(op.Tx.Fee, FeeFloatEncoding, packedFeeBytes)
+	w.bytes(op.Tx.To.Bytes())
+	return w.buf
+}
+
+// FromPubdata sets op from its pubdata.
+func (op *TransferNFTOp) FromPubdata(b []byte) error {
+	r, err := newPubdataReader(TransferNFTOpType, b)
+	if err != nil {
+		return err
+	}
+	op.Tx.AccountId = r.uint(accountIdBytes)
+	op.ToId = r.uint(accountIdBytes)
+	op.Tx.Token = r.uint(tokenBytes)
+	op.Tx.Amount = big.NewInt(1)
+	op.Tx.FeeToken = r.uint(tokenBytes)
+	op.Tx.Fee = r.packed(FeeFloatEncoding, packedFeeBytes)
+	op.Tx.To = r.address()
+	return nil
+}
+
+// Pubdata returns the pubdata of the NFT withdrawal, whose amount is always 1:
+//
+//	op type | account id | creator id | creator address | serial | content hash |
+//	token | fee token | packed fee | to address
+func (op WithdrawNFTOp) Pubdata() []byte {
+	w := newPubdataWriter(WithdrawNFTOpType)
+	w.uint(op.Tx.AccountId, accountIdBytes)
+	w.uint(op.CreatorId, accountIdBytes)
+	w.bytes(op.CreatorAddress.Bytes())
+	w.uint(op.Serial, serialBytes)
+	w.bytes(op.ContentHash.Bytes())
+	w.uint(op.Tx.Token, tokenBytes)
+	w.uint(op.Tx.FeeToken, tokenBytes)
+	w.packed(op.Tx.Fee, FeeFloatEncoding, packedFeeBytes)
+	w.bytes(op.Tx.To.Bytes())
+	return w.buf
+}
+
+// FromPubdata sets op from its pubdata.
+func (op *WithdrawNFTOp) FromPubdata(b []byte) error {
+	r, err := newPubdataReader(WithdrawNFTOpType, b)
+	if err != nil {
+		return err
+	}
+	op.Tx.AccountId = r.uint(accountIdBytes)
+	op.CreatorId = r.uint(accountIdBytes)
+	op.CreatorAddress = r.address()
+	op.Serial = r.uint(serialBytes)
+	op.ContentHash = r.hash()
+	op.Tx.Token = r.uint(tokenBytes)
+	op.Tx.Amount = big.NewInt(1)
+	op.Tx.FeeToken = r.uint(tokenBytes)
+	op.Tx.Fee = r.packed(FeeFloatEncoding, packedFeeBytes)
+	op.Tx.To = r.address()
+	return nil
+}
+
+// PubdataChunks returns the number of chunks of the pubdata that starts with
+// the op type byte opType.
+func PubdataChunks(opType OpType) (int, error) {
+	chunks, ok := opChunks[opType]
+	if !ok {
+		return 0, fmt.Errorf("unknown op type %d", opType)
+	}
+	return chunks, nil
+}
+
+// FromPubdata decodes the operation of the pubdata b, according to its op type
+// byte.
+func FromPubdata(b []byte) (ZionOp, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty pubdata")
+	}
+	switch OpType(b[0]) {
+	case NoopOpType:
+		var op NoopOp
+		return op, op.FromPubdata(b)
+	case DepositOpType:
+		var op DepositOp
+		err := op.FromPubdata(b)
+		return op, err
+	case TransferOpType, TransferToNewOpType:
+		var op TransferOp
+		err := op.FromPubdata(b)
+		return op, err
+	case WithdrawOpType:
+		var op WithdrawOp
+		err := op.FromPubdata(b)
+		return op, err
+	case PubkeyUpdateOpType:
+		var op PubkeyUpdateOp
+		err := op.FromPubdata(b)
+		return op, err
+	case ForcedExitOpType:
+		var op ForcedExitOp
+		err := op.FromPubdata(b)
+		return op, err
+	case FullExitOpType:
+		var op FullExitOp
+		err := op.FromPubdata(b)
+		return op, err
+	case SwapOpType:
+		var op SwapOp
+		err := op.FromPubdata(b)
+		return op, err
+	case MintNFTOpType:
+		var op MintNFTOp
+		err := op.FromPubdata(b)
+		return op, err
+	case TransferNFTOpType:
+		var op TransferNFTOp
+		err := op.FromPubdata(b)
+		return op, err
+	case WithdrawNFTOpType:
+		var op WithdrawNFTOp
+		err := op.FromPubdata(b)
+		return op, err
+	}
+	return nil, fmt.Errorf("unknown op type %d", b[0])
+}
+
+// Pubdata returns the pubdata of the operations of the batch, one after another.
+func (op BatchOp) Pubdata() []byte {
+	var pubdata []byte
+	for _, inner := range op.Ops {
+		pubdata = append(pubdata, inner.Pubdata()...)
+	}
+	return pubdata
+}
@@ -0,0 +1,183 @@
+package operation
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+	"github.com/vivijj/ziongo/types/transaction"
+)
+
+func testOps() []ZionOp {
+	addr := common.HexToAddress("0x2a500A5e1950aea40C22d8885C8DC3c02e99b3E2")
+	k := babyjub.PrivateKey{1, 2, 3}
+	transfer := TransferOp{
+		Tx: transaction.TransferTx{
+			AccountId: 1,
+			FeeToken:  3,
+			Fee:       big.NewInt(1000),
+			To:        addr,
+			Token:     2,
+			Amount:    big.NewInt(123456000),
+		},
+		ToId: 9,
+	}
+	transferToNew := transfer
+	transferToNew.PutAddressInDa = true
+	return []ZionOp{
+		NoopOp{},
+		DepositOp{
+			Tx:        transaction.DepositTx{To: addr, Amount: big.NewInt(123456789), Token: 1},
+			AccountId: 7,
+		},
+		transfer,
+		transferToNew,
+		WithdrawOp{
+			Tx: transaction.WithdrawTx{
+				AccountId: 7,
+				FeeToken:  1,
+				Fee:       big.NewInt(5),
+				To:        addr,
+				Token:     1,
+				Amount:    big.NewInt(123456789),
+			},
+		},
+		PubkeyUpdateOp{
+			Tx: transaction.PubkeyUpdateTx{
+				AccountId: 7,
+				Nonce:     4,
+				FeeToken:  0,
+				Fee:       big.NewInt(0),
+				Account:   addr,
+				PubKey:    *k.Public(),
+			},
+		},
+		ForcedExitOp{
+			Tx: transaction.ForcedExitTx{
+				AccountId: 3,
+				FeeToken:  1,
+				Fee:       big.NewInt(5),
+				Target:    addr,
+				Token:     2,
+			},
+			TargetAccountId: 9,
+			WithdrawAmount:  big.NewInt(123456789),
+		},
+		FullExitOp{
+			Tx:             transaction.FullExitTx{AccountId: 9, EthAddress: addr, Token: 2},
+			WithdrawAmount: big.NewInt(0),
+		},
+		SwapOp{
+			Tx: transaction.SwapTx{
+				SubmitterId: 1,
+				Orders: [2]transaction.Order{
+					{AccountId: 2, TokenSell: 3, TokenBuy: 4},
+					{AccountId: 5, TokenSell: 4, TokenBuy: 3},
+				},
+				Amounts:  [2]*big.Int{big.NewInt(1000), big.NewInt(25000)},
+				FeeToken: 0,
+				Fee:      big.NewInt(10),
+			},
+			NonceMask: 2,
+		},
+		MintNFTOp{
+			Tx: transaction.MintNFTTx{
+				CreatorId:      3,
+				CreatorAddress: addr,
+				ContentHash:    common.HexToHash("0xc0ffee"),
+				FeeToken:       1,
+				Fee:            big.NewInt(5),
+			},
+			TokenId:     1 << 16,
+			Serial:      2,
+			RecipientId: 9,
+		},
+		TransferNFTOp{
+			Tx: transaction.TransferTx{
+				AccountId: 1,
+				FeeToken:  3,
+				Fee:       big.NewInt(1000),
+				To:        addr,
+				Token:     1<<16 + 1,
+				Amount:    big.NewInt(1),
+			},
+			ToId: 9,
+		},
+		WithdrawNFTOp{
+			Tx: transaction.WithdrawTx{
+				AccountId: 7,
+				FeeToken:  1,
+				Fee:       big.NewInt(5),
+				To:        addr,
+				Token:     1<<16 + 1,
+				Amount:    big.NewInt(1),
+			},
+			CreatorId:      3,
+			CreatorAddress: addr,
+			Serial:         2,
+			ContentHash:    common.HexToHash("0xc0ffee"),
+		},
+	}
+}
+
+func TestPubdataRoundTrip(t *testing.T) {
+	for _, op := range testOps() {
+		pubdata := op.Pubdata()
+		require.Zero(t, len(pubdata)%ChunkBytes)
+		chunks, err := PubdataChunks(OpType(pubdata[0]))
+		require.NoError(t, err)
+		assert.Equal(t, chunks*ChunkBytes, len(pubdata))
+
+		decoded, err := FromPubdata(pubdata)
+		require.NoError(t, err)
+		assert.IsType(t, op, decoded)
+		assert.Equal(t, pubdata, decoded.Pubdata())
+	}
+}
+
+func TestPubdataPackedAmount(t *testing.T) {
+	op := testOps()[2].(TransferOp)
+	var decoded TransferOp
+	require.NoError(t, decoded.FromPubdata(op.Pubdata()))
+	assert.Equal(t, 0, op.Tx.Amount.Cmp(decoded.Tx.Amount))
+	assert.Equal(t, 0, op.Tx.Fee.Cmp(decoded.Tx.Fee))
+	assert.Equal(t, op.ToId, decoded.ToId)
+	assert.False(t, decoded.PutAddressInDa)
+}
+
+func TestPubdataFullAmount(t *testing.T) {
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+	assert.True(t, FitsFullAmount(big.NewInt(0)))
+	assert.True(t, FitsFullAmount(max))
+	assert.False(t, FitsFullAmount(new(big.Int).Add(max, big.NewInt(1))))
+	assert.False(t, FitsFullAmount(big.NewInt(-1)))
+	assert.False(t, FitsFullAmount(nil))
+
+	op := testOps()[7].(FullExitOp)
+	op.WithdrawAmount = max
+	var decoded FullExitOp
+	require.NoError(t, decoded.FromPubdata(op.Pubdata()))
+	assert.Equal(t, 0, max.Cmp(decoded.WithdrawAmount))
+
+	// an amount that doesn't fit is never executed, but its pubdata doesn't panic.
+	op.WithdrawAmount = new(big.Int).Lsh(big.NewInt(1), 200)
+	assert.NotPanics(t, func() { op.Pubdata() })
+}
+
+func TestFromPubdataInvalid(t *testing.T) {
+	_, err := FromPubdata(nil)
+	assert.Error(t, err)
+	_, err = FromPubdata([]byte{0xff})
+	assert.Error(t, err)
+
+	pubdata := testOps()[1].Pubdata()
+	_, err = FromPubdata(pubdata[:len(pubdata)-1])
+	assert.Error(t, err)
+
+	var op WithdrawOp
+	assert.Error(t, op.FromPubdata(pubdata))
+}
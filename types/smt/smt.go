@@ -59,7 +59,7 @@ func (s *SparseQuadMerkleTree) Update(index int, itemHash fr.Repr) {
 	for i := 0; i < s.Depth; i++ {
 		children := s.Cache[v]
 		sideNodes = append(sideNodes, children)
-		childIndex := (lookupRef >> 2 * (s.Depth - 1)) % Nary
+		childIndex := (lookupRef >> (2 * (s.Depth - 1))) % Nary
 		v = children[childIndex]
 		lookupRef <<= 2
 	}
@@ -3,6 +3,7 @@ package smt
 import (
 	"testing"
 
+	"github.com/vivijj/ziongo/types/fr"
 	"github.com/vivijj/ziongo/utils/hasher"
 )
 
@@ -25,3 +26,19 @@ func BenchmarkSmt(b *testing.B) {
 		}
 	}
 }
+
+func TestSmtGetHash(t *testing.T) {
+	hashdd := hasher.NewPoseidonHasher(5)
+	tr := New(4, "12314", *hashdd)
+	for _, i := range []int{0, 1, 6, 37, 255} {
+		tr.Update(i, fr.FromInt(1000+i))
+	}
+	for _, i := range []int{0, 1, 6, 37, 255} {
+		if tr.GetHash(i) != fr.FromInt(1000+i) {
+			t.Fatalf("leaf %d is %s", i, tr.GetHash(i))
+		}
+	}
+	if tr.GetHash(2) != "12314" {
+		t.Fatalf("leaf 2 is %s", tr.GetHash(2))
+	}
+}
@@ -0,0 +1,145 @@
+package token
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vivijj/ziongo/types/account"
+)
+
+// MaxTokenId is the biggest id of a fungible token, the bigger ids are reserved
+// for the NFTs.
+const MaxTokenId = account.MinNFTTokenId - 1
+
+type RegistryError struct{ msg string }
+
+func (err RegistryError) Error() string {
+	return err.msg
+}
+
+var (
+	ErrInvalidTokenId = &RegistryError{"token id is out of the fungible token range"}
+	ErrTokenIdExists  = &RegistryError{"token id is already registered"}
+	ErrAddressExists  = &RegistryError{"token address is already registered"}
+	ErrTokenNotFound  = &RegistryError{"token is not registered"}
+)
+
+// Registry is the set of registered tokens, it's safe for concurrent use since
+// both the state and the mempool consult it.
+type Registry struct {
+	mu        sync.RWMutex
+	byId      map[int]Token
+	byAddress map[common.Address]int
+}
+
+// NewRegistry returns the registry of the tokens.
+func NewRegistry(tokens ...Token) (*Registry, error) {
+	r := &Registry{
+		byId:      make(map[int]Token),
+		byAddress: make(map[common.Address]int),
+	}
+	for _, t := range tokens {
+		if err := r.Add(t); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Add registers the token. Adding again a registered token is a no-op whatever its
+// fee eligibility, since the tokens of the genesis may be replayed from the L1
+// events.
+func (r *Registry) Add(t Token) error {
+	if t.Id < 0 || t.Id > MaxTokenId {
+		return ErrInvalidTokenId
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if registered, ok := r.byId[t.Id]; ok {
+		if registered.Address == t.Address && registered.Symbol == t.Symbol && registered.Decimals == t.Decimals {
+			return nil
+		}
+		return ErrTokenIdExists
+	}
+	if _, ok := r.byAddress[t.Address]; ok {
+		return ErrAddressExists
+	}
+	r.byId[t.Id] = t
+	r.byAddress[t.Address] = t.Id
+	return nil
+}
+
+// SetFeeEligible sets whether the fees may be paid in the token.
+func (r *Registry) SetFeeEligible(id int, eligible bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.byId[id]
+	if !ok {
+		return ErrTokenNotFound
+	}
+	t.FeeEligible = eligible
+	r.byId[id] = t
+	return nil
+}
+
+// Get returns the token of the id, and whether it's registered.
+func (r *Registry) Get(id int) (Token, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.byId[id]
+	return t, ok
+}
+
+// GetByAddress returns the token of the L1 address, and whether it's registered.
+func (r *Registry) GetByAddress(addr common.Address) (Token, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.byAddress[addr]
+	if !ok {
+		return Token{}, false
+	}
+	return r.byId[id], true
+}
+
+// IsFeeEligible tells whether the token is registered and fees may be paid in it.
+func (r *Registry) IsFeeEligible(id int) bool {
+	t, ok := r.Get(id)
+	return ok && t.FeeEligible
+}
+
+// Tokens returns the registered tokens ordered by id.
+func (r *Registry) Tokens() []Token {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tokens := make([]Token, 0, len(r.byId))
+	for _, t := range r.byId {
+		tokens = append(tokens, t)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Id < tokens[j].Id })
+	return tokens
+}
+
+// Genesis is the content of the genesis file of the tokens.
+type Genesis struct {
+	Tokens []Token `json:"tokens"`
+}
+
+// LoadGenesis returns the registry of the tokens of the genesis file.
+func LoadGenesis(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var genesis Genesis
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&genesis); err != nil {
+		return nil, err
+	}
+	return NewRegistry(genesis.Tokens...)
+}
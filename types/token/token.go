@@ -0,0 +1,43 @@
+// Package token define the fungible tokens supported by the zion network.
+package token
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Token is a fungible token registered in the zion network, the NFTs are not
+// registered.
+type Token struct {
+	Id int `json:"id"`
+	// Address is the address of the token contract on L1, zero for ETH.
+	Address  common.Address `json:"address"`
+	Symbol   string         `json:"symbol"`
+	Decimals uint8          `json:"decimals"`
+	// FeeEligible tells whether the fees of the txs may be paid in the token.
+	FeeEligible bool `json:"fee_eligible"`
+}
+
+// FormatAmount returns the amount of the token in its human-readable decimal form,
+// e.g. "1.5" for 1500000000000000000 of a token with 18 decimals.
+func (t Token) FormatAmount(amount *big.Int) string {
+	digits := new(big.Int).Abs(amount).String()
+	sign := ""
+	if amount.Sign() < 0 {
+		sign = "-"
+	}
+	if t.Decimals == 0 {
+		return sign + digits
+	}
+	decimals := int(t.Decimals)
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	integer, fraction := digits[:len(digits)-decimals], strings.TrimRight(digits[len(digits)-decimals:], "0")
+	if fraction == "" {
+		return sign + integer
+	}
+	return sign + integer + "." + fraction
+}
@@ -0,0 +1,73 @@
+package token
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatAmount(t *testing.T) {
+	eth := Token{Symbol: "ETH", Decimals: 18}
+	amount, _ := new(big.Int).SetString("1500000000000000000", 10)
+	assert.Equal(t, "1.5", eth.FormatAmount(amount))
+	assert.Equal(t, "0.000000000000000001", eth.FormatAmount(big.NewInt(1)))
+	assert.Equal(t, "0", eth.FormatAmount(big.NewInt(0)))
+	assert.Equal(t, "-3", eth.FormatAmount(new(big.Int).Mul(amount, big.NewInt(-2))))
+	assert.Equal(t, "123", Token{Decimals: 0}.FormatAmount(big.NewInt(123)))
+	assert.Equal(t, "1.23", Token{Decimals: 2}.FormatAmount(big.NewInt(123)))
+}
+
+func TestRegistry(t *testing.T) {
+	usdc := Token{Id: 1, Address: common.HexToAddress("0x01"), Symbol: "USDC", Decimals: 6}
+	r, err := NewRegistry(Token{Id: 0, Symbol: "ETH", Decimals: 18, FeeEligible: true}, usdc)
+	require.NoError(t, err)
+
+	got, ok := r.GetByAddress(usdc.Address)
+	require.True(t, ok)
+	assert.Equal(t, usdc, got)
+	assert.True(t, r.IsFeeEligible(0))
+	assert.False(t, r.IsFeeEligible(1))
+	assert.False(t, r.IsFeeEligible(2))
+
+	require.NoError(t, r.SetFeeEligible(1, true))
+	assert.True(t, r.IsFeeEligible(1))
+	assert.Equal(t, ErrTokenNotFound, r.SetFeeEligible(2, true))
+
+	// the replayed registration keeps the fee eligibility.
+	assert.NoError(t, r.Add(usdc))
+	assert.True(t, r.IsFeeEligible(1))
+
+	assert.Equal(t, ErrTokenIdExists, r.Add(Token{Id: 1, Address: common.HexToAddress("0x02")}))
+	assert.Equal(t, ErrAddressExists, r.Add(Token{Id: 2, Address: usdc.Address}))
+	assert.Equal(t, ErrInvalidTokenId, r.Add(Token{Id: MaxTokenId + 1, Address: common.HexToAddress("0x03")}))
+	assert.Equal(t, ErrInvalidTokenId, r.Add(Token{Id: -1, Address: common.HexToAddress("0x03")}))
+
+	tokens := r.Tokens()
+	require.Len(t, tokens, 2)
+	assert.Equal(t, 0, tokens[0].Id)
+	assert.Equal(t, 1, tokens[1].Id)
+}
+
+func TestLoadGenesis(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"tokens": [
+		{"id": 0, "address": "0x0000000000000000000000000000000000000000", "symbol": "ETH", "decimals": 18, "fee_eligible": true},
+		{"id": 1, "address": "0x0000000000000000000000000000000000000001", "symbol": "USDC", "decimals": 6, "fee_eligible": false}
+	]}`), 0o600))
+	r, err := LoadGenesis(path)
+	require.NoError(t, err)
+	usdc, ok := r.Get(1)
+	require.True(t, ok)
+	assert.Equal(t, "USDC", usdc.Symbol)
+	assert.Equal(t, uint8(6), usdc.Decimals)
+	assert.True(t, r.IsFeeEligible(0))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"tokens": [{"id": 0, "symbol": "ETH", "fees": true}]}`), 0o600))
+	_, err = LoadGenesis(path)
+	assert.Error(t, err)
+}
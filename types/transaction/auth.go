@@ -0,0 +1,78 @@
+package transaction
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// PubkeyAuthType is the scheme of the AuthData of a PubkeyUpdateTx.
+type PubkeyAuthType int
+
+const (
+	// EIP712Auth signs the EIP-712 typed data of the tx, which wallets display
+	// field by field.
+	EIP712Auth PubkeyAuthType = iota
+	// LegacyAuth signs the keccak hash of the canonical encoding of the tx,
+	// see HashEncodeData.
+	LegacyAuth
+)
+
+type AuthError struct{ msg string }
+
+func (err AuthError) Error() string {
+	return err.msg
+}
+
+var (
+	ErrAuthTypeUnknown   = &AuthError{"unknown auth type"}
+	ErrAuthDataMalformed = &AuthError{"auth data is malformed"}
+	ErrAuthDataSigner    = &AuthError{"auth data is not signed by the account"}
+)
+
+const (
+	authDomainName    = "Zion"
+	authDomainVersion = "1"
+
+	pubkeyUpdateTypeName = "PubkeyUpdate"
+)
+
+// AuthDomain is the EIP-712 domain of the L1 authorizations, the legacy auth
+// type only uses its ChainId.
+type AuthDomain struct {
+	ChainId           int
+	VerifyingContract common.Address
+}
+
+func (d AuthDomain) typedDataDomain() apitypes.TypedDataDomain {
+	return apitypes.TypedDataDomain{
+		Name:              authDomainName,
+		Version:           authDomainVersion,
+		ChainId:           intValue(d.ChainId),
+		VerifyingContract: d.VerifyingContract.Hex(),
+	}
+}
+
+var pubkeyUpdateTypes = apitypes.Types{
+	"EIP712Domain": {
+		{Name: "name", Type: "string"},
+		{Name: "version", Type: "string"},
+		{Name: "chainId", Type: "uint256"},
+		{Name: "verifyingContract", Type: "address"},
+	},
+	pubkeyUpdateTypeName: {
+		{Name: "accountId", Type: "uint32"},
+		{Name: "nonce", Type: "uint32"},
+		{Name: "validUntil", Type: "uint64"},
+		{Name: "feeToken", Type: "uint32"},
+		{Name: "fee", Type: "uint256"},
+		{Name: "account", Type: "address"},
+		{Name: "pubKey", Type: "bytes32"},
+	},
+}
+
+func intValue(v int) *math.HexOrDecimal256 {
+	return (*math.HexOrDecimal256)(big.NewInt(int64(v)))
+}
@@ -0,0 +1,86 @@
+package transaction
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+)
+
+var testAuthDomain = AuthDomain{
+	ChainId:           testChainId,
+	VerifyingContract: common.HexToAddress("0x5FbDB2315678afecb367f032d93F642f64180aa3"),
+}
+
+func newTestPubkeyUpdateTx(t *testing.T, authType PubkeyAuthType) PubkeyUpdateTx {
+	ethKey, err := crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	require.NoError(t, err)
+	k := babyjub.PrivateKey{7, 8, 9}
+	tx, err := NewPubkeyUpdateTx(ethKey, testAuthDomain, authType, *k.Public(), 3, 0, 1700000000, 0, big.NewInt(1000))
+	require.NoError(t, err)
+	return tx
+}
+
+func TestEIP712DomainSeparator(t *testing.T) {
+	typedData := newTestPubkeyUpdateTx(t, EIP712Auth).TypedData(testAuthDomain)
+	domainSeparator, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+	require.NoError(t, err)
+
+	expected := crypto.Keccak256(
+		crypto.Keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)")),
+		crypto.Keccak256([]byte("Zion")),
+		crypto.Keccak256([]byte("1")),
+		common.LeftPadBytes(big.NewInt(testChainId).Bytes(), 32),
+		common.LeftPadBytes(testAuthDomain.VerifyingContract.Bytes(), 32),
+	)
+	assert.Equal(t, expected, []byte(domainSeparator))
+}
+
+func TestVerifyAuthData(t *testing.T) {
+	for _, authType := range []PubkeyAuthType{EIP712Auth, LegacyAuth} {
+		tx := newTestPubkeyUpdateTx(t, authType)
+		authData := append([]byte(nil), tx.AuthData...)
+
+		// verification has no side effect, so it can be repeated.
+		assert.NoError(t, tx.VerifyAuthData(testAuthDomain))
+		assert.NoError(t, tx.VerifyAuthData(testAuthDomain))
+		assert.Equal(t, authData, tx.AuthData)
+
+		otherChain := testAuthDomain
+		otherChain.ChainId = otherChainId
+		assert.Error(t, tx.VerifyAuthData(otherChain))
+
+		tampered := tx
+		tampered.Nonce++
+		assert.Equal(t, ErrAuthDataSigner, tampered.VerifyAuthData(testAuthDomain))
+
+		otherType := tx
+		otherType.AuthType = 1 - authType
+		assert.Error(t, otherType.VerifyAuthData(testAuthDomain))
+	}
+
+	tx := newTestPubkeyUpdateTx(t, EIP712Auth)
+	otherContract := testAuthDomain
+	otherContract.VerifyingContract = common.Address{1}
+	assert.Equal(t, ErrAuthDataSigner, tx.VerifyAuthData(otherContract))
+
+	unknown := tx
+	unknown.AuthType = 7
+	assert.Equal(t, ErrAuthTypeUnknown, unknown.VerifyAuthData(testAuthDomain))
+
+	malformed := tx
+	malformed.AuthData = append([]byte(nil), tx.AuthData...)
+	malformed.AuthData[crypto.RecoveryIDOffset] = 1
+	assert.Equal(t, ErrAuthDataMalformed, malformed.VerifyAuthData(testAuthDomain))
+	malformed.AuthData = tx.AuthData[:64]
+	assert.Equal(t, ErrAuthDataMalformed, malformed.VerifyAuthData(testAuthDomain))
+
+	negative := tx
+	negative.Nonce = -1
+	assert.Error(t, negative.VerifyAuthData(testAuthDomain))
+}
@@ -0,0 +1,213 @@
+package transaction
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// MaxBatchSize is the max number of txs in a BatchTx.
+const MaxBatchSize = 50
+
+// BatchTx is an ordered list of txs executed atomically: either every tx of the
+// batch succeeds, or none of them is applied to the state. It's useful when a tx
+// relies on another one, e.g. a transfer in a token whose fee is paid by another
+// transfer in a different token.
+type BatchTx struct {
+	Txs []ZionTx
+	// Signature is an optional ECDSA signature of the batch, made by the L1
+	// account that initiates every tx of the batch.
+	Signature []byte
+}
+
+func (tx BatchTx) isZionTx() {}
+
+// Validate checks that the batch is not empty, not too big and doesn't contain
+// another batch.
+func (tx BatchTx) Validate() error {
+	if len(tx.Txs) == 0 {
+		return fmt.Errorf("batch is empty")
+	}
+	if len(tx.Txs) > MaxBatchSize {
+		return fmt.Errorf("batch has %d txs, more than %d", len(tx.Txs), MaxBatchSize)
+	}
+	for i, inner := range tx.Txs {
+		switch inner.(type) {
+		case nil:
+			return fmt.Errorf("tx %d of the batch is nil", i)
+		case BatchTx:
+			return fmt.Errorf("tx %d of the batch is a batch", i)
+		}
+	}
+	return nil
+}
+
+// Encode returns the canonical encoding of the batch, the number of txs followed
+// by the length and the canonical encoding of every tx. The signature is not
+// part of it.  It fails if the batch is not valid or a tx has no canonical
+// encoding.
+func (tx BatchTx) Encode() ([]byte, error) {
+	if err := tx.Validate(); err != nil {
+		return nil, err
+	}
+	e := newEncoder(Batch, intBytes)
+	e.int(len(tx.Txs))
+	for i, inner := range tx.Txs {
+		b := inner.GetBytes()
+		if b[0] != CanonicalVersion {
+			return nil, fmt.Errorf("tx %d of the batch has no canonical encoding", i)
+		}
+		e.int(len(b))
+		e.buf = append(e.buf, b...)
+	}
+	return e.buf, nil
+}
+
+// GetBytes returns the canonical encoding of the batch.
+func (tx BatchTx) GetBytes() []byte {
+	b, err := tx.Encode()
+	if err != nil {
+		return nonCanonicalBytes(Batch, tx)
+	}
+	return b
+}
+
+// DecodeBatchTx decodes a BatchTx from its canonical encoding, the signatures
+// are left empty.
+func DecodeBatchTx(b []byte) (BatchTx, error) {
+	if len(b) < 2+intBytes {
+		return BatchTx{}, fmt.Errorf("tx encoding is too short")
+	}
+	d, err := newDecoder(Batch, b[:2+intBytes], intBytes)
+	if err != nil {
+		return BatchTx{}, err
+	}
+	n := d.int()
+	if n <= 0 || n > MaxBatchSize {
+		return BatchTx{}, fmt.Errorf("invalid number of txs in the batch %d", n)
+	}
+	d.buf = b[2+intBytes:]
+
+	batch := BatchTx{Txs: make([]ZionTx, 0, n)}
+	for i := 0; i < n; i++ {
+		if len(d.buf) < intBytes {
+			return BatchTx{}, fmt.Errorf("batch encoding is too short")
+		}
+		size := d.int()
+		if size < 2 || size > len(d.buf) {
+			return BatchTx{}, fmt.Errorf("invalid size %d of the tx %d of the batch", size, i)
+		}
+		inner := d.next(size)
+		if inner[1] == txTypeBytes[Batch] {
+			return BatchTx{}, fmt.Errorf("tx %d of the batch is a batch", i)
+		}
+		innerTx, err := DecodeZionTx(inner)
+		if err != nil {
+			return BatchTx{}, err
+		}
+		batch.Txs = append(batch.Txs, innerTx)
+	}
+	if len(d.buf) != 0 {
+		return BatchTx{}, fmt.Errorf("%d trailing bytes after the batch", len(d.buf))
+	}
+	return batch, nil
+}
+
+// HashEncodeData returns the hash signed by the L1 account in the Signature, for
+// the chain chainId.
+func (tx BatchTx) HashEncodeData(chainId int) []byte {
+	return crypto.Keccak256(sigPrefixBytes(Batch, chainId), tx.GetBytes())
+}
+
+// AccountAddress returns the L1 address of the account of the id, and whether the
+// account exists.
+type AccountAddress func(accountId int) (common.Address, bool)
+
+// Initiator returns the L1 address of the account that initiates the tx, it's
+// false for a tx that is not initiated by an account.  A forced exit only names
+// its initiator by account id, whose address is given by accountAddr.
+func Initiator(tx ZionTx, accountAddr AccountAddress) (common.Address, bool) {
+	switch t := tx.(type) {
+	case TransferTx:
+		return t.From, true
+	case WithdrawTx:
+		return t.From, true
+	case PubkeyUpdateTx:
+		return t.Account, true
+	case SwapTx:
+		return t.SubmitterAddress, true
+	case MintNFTTx:
+		return t.CreatorAddress, true
+	case ForcedExitTx:
+		if accountAddr == nil {
+			return common.Address{}, false
+		}
+		return accountAddr(t.AccountId)
+	}
+	return common.Address{}, false
+}
+
+// VerifySignature checks that the Signature is made for the chain chainId by the
+// initiator of every tx of the batch, see Initiator.  It doesn't modify the batch.
+func (tx BatchTx) VerifySignature(chainId int, accountAddr AccountAddress) error {
+	if len(tx.Signature) != crypto.SignatureLength {
+		return ErrAuthDataMalformed
+	}
+	v := tx.Signature[crypto.RecoveryIDOffset]
+	if v != 27 && v != 28 {
+		return ErrAuthDataMalformed
+	}
+	sig := make([]byte, crypto.SignatureLength)
+	copy(sig, tx.Signature)
+	sig[crypto.RecoveryIDOffset] -= 27
+	pubkey, err := crypto.SigToPub(tx.HashEncodeData(chainId), sig)
+	if err != nil {
+		return ErrAuthDataMalformed
+	}
+	signer := crypto.PubkeyToAddress(*pubkey)
+	for _, inner := range tx.Txs {
+		if addr, ok := Initiator(inner, accountAddr); !ok || addr != signer {
+			return ErrAuthDataSigner
+		}
+	}
+	return nil
+}
+
+type batchTxJson struct {
+	Txs       []TypedZionTx
+	Signature hexutil.Bytes
+}
+
+// MarshalJSON implements the json.Marshaler interface, the txs of the batch are
+// marshalled with their type.
+func (tx BatchTx) MarshalJSON() ([]byte, error) {
+	jtx := batchTxJson{
+		Txs:       make([]TypedZionTx, len(tx.Txs)),
+		Signature: tx.Signature,
+	}
+	for i, inner := range tx.Txs {
+		jtx.Txs[i] = TypedZionTx{Value: inner}
+	}
+	return json.Marshal(jtx)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (tx *BatchTx) UnmarshalJSON(data []byte) error {
+	var jtx batchTxJson
+	if err := decodeStrict(data, &jtx); err != nil {
+		return err
+	}
+	txs := make([]ZionTx, len(jtx.Txs))
+	for i, inner := range jtx.Txs {
+		if inner.Type == Batch {
+			return fmt.Errorf("tx %d of the batch is a batch", i)
+		}
+		txs[i] = inner.Value
+	}
+	tx.Txs = txs
+	tx.Signature = jtx.Signature
+	return nil
+}
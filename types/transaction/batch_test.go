@@ -0,0 +1,82 @@
+package transaction
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBatchTx() BatchTx {
+	return BatchTx{Txs: []ZionTx{testTransferTx(), testWithdrawTx(), testPubkeyUpdateTx()}}
+}
+
+func TestBatchValidate(t *testing.T) {
+	assert.NoError(t, testBatchTx().Validate())
+	assert.Error(t, BatchTx{}.Validate())
+
+	nested := BatchTx{Txs: []ZionTx{testTransferTx(), testBatchTx()}}
+	assert.Error(t, nested.Validate())
+	_, err := nested.Encode()
+	assert.Error(t, err)
+
+	tooBig := BatchTx{Txs: make([]ZionTx, MaxBatchSize+1)}
+	for i := range tooBig.Txs {
+		tooBig.Txs[i] = testTransferTx()
+	}
+	assert.Error(t, tooBig.Validate())
+}
+
+func TestBatchOrder(t *testing.T) {
+	batch := testBatchTx()
+	swapped := testBatchTx()
+	swapped.Txs[0], swapped.Txs[1] = swapped.Txs[1], swapped.Txs[0]
+	assert.NotEqual(t, ZionTxHash(batch), ZionTxHash(swapped))
+}
+
+func TestBatchJson(t *testing.T) {
+	batch := testBatchTx()
+	batch.Signature = []byte{1, 2, 3}
+	b, err := json.Marshal(TypedZionTx{Value: batch})
+	require.NoError(t, err)
+
+	var typed TypedZionTx
+	require.NoError(t, json.Unmarshal(b, &typed))
+	decoded, ok := typed.Value.(BatchTx)
+	require.True(t, ok)
+	assert.Equal(t, batch.Signature, decoded.Signature)
+	assert.Equal(t, batch.GetBytes(), decoded.GetBytes())
+}
+
+func TestBatchSignatureForcedExit(t *testing.T) {
+	ethKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer := crypto.PubkeyToAddress(ethKey.PublicKey)
+	transfer := testTransferTx()
+	transfer.From = signer
+	forcedExit := testForcedExitTx()
+	batch := BatchTx{Txs: []ZionTx{transfer, forcedExit}}
+	batch.Signature, err = crypto.Sign(batch.HashEncodeData(testChainId), ethKey)
+	require.NoError(t, err)
+	batch.Signature[crypto.RecoveryIDOffset] += 27
+
+	accountAddr := func(addr common.Address) AccountAddress {
+		return func(id int) (common.Address, bool) {
+			return addr, id == forcedExit.AccountId
+		}
+	}
+	assert.NoError(t, batch.VerifySignature(testChainId, accountAddr(signer)))
+	assert.Equal(t, ErrAuthDataSigner, batch.VerifySignature(testChainId, accountAddr(common.Address{1})))
+	assert.Equal(t, ErrAuthDataSigner, batch.VerifySignature(testChainId, nil))
+}
+
+func TestDecodeBatchInvalid(t *testing.T) {
+	b := testBatchTx().GetBytes()
+	_, err := DecodeBatchTx(b[:len(b)-1])
+	assert.Error(t, err)
+	_, err = DecodeBatchTx(append(b, 0))
+	assert.Error(t, err)
+}
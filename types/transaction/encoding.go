@@ -0,0 +1,195 @@
+package transaction
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+	"github.com/vivijj/ziongo/crypto/utils"
+)
+
+// The canonical encoding of a ZionTx is a fixed width big-endian byte sequence:
+//
+//	version (1) | tx type (1) | fields...
+//
+// where every int field takes 8 bytes (two's complement), every amount 32
+// bytes, every address 20 bytes and a public key its 32 bytes compressed form.
+// Since every field has a fixed width, two different txs never have the same
+// encoding, which is what ZionTxHash is computed over.
+
+// CanonicalVersion is the version byte of the canonical tx encoding.
+const CanonicalVersion byte = 1
+
+// nonCanonicalVersion prefixes the bytes of a tx that has no canonical
+// encoding, e.g. a negative amount. Such a tx is invalid, but it still needs
+// distinct bytes to be identified by its hash.
+const nonCanonicalVersion byte = 0xff
+
+const (
+	intBytes     = 8
+	amountBytes  = 32
+	addressBytes = common.AddressLength
+	hashBytes    = common.HashLength
+	pubkeyBytes  = 32
+)
+
+// txTypeBytes is the tx type byte of the canonical encoding.
+var txTypeBytes = map[TxType]byte{
+	Noop:         0,
+	Deposit:      1,
+	Withdraw:     2,
+	Transfer:     3,
+	PubKeyUpdate: 4,
+	Batch:        5,
+	ForcedExit:   6,
+	Swap:         7,
+	MintNFT:      8,
+}
+
+// encoder appends the fields of a tx to buf, the first error encountered is
+// kept in err and the following fields are ignored.
+type encoder struct {
+	buf []byte
+	err error
+}
+
+func newEncoder(txType TxType, size int) *encoder {
+	buf := make([]byte, 0, 2+size)
+	buf = append(buf, CanonicalVersion, txTypeBytes[txType])
+	return &encoder{buf: buf}
+}
+
+func (e *encoder) int(v int) {
+	var b [intBytes]byte
+	binary.BigEndian.PutUint64(b[:], uint64(int64(v)))
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) amount(name string, v *big.Int) {
+	if e.err != nil {
+		return
+	}
+	if v == nil || v.Sign() < 0 || v.BitLen() > 8*amountBytes {
+		e.err = fmt.Errorf("%s is not an unsigned 256 bits integer", name)
+		return
+	}
+	var b [amountBytes]byte
+	e.buf = append(e.buf, v.FillBytes(b[:])...)
+}
+
+func (e *encoder) address(v common.Address) {
+	e.buf = append(e.buf, v.Bytes()...)
+}
+
+func (e *encoder) hash(v common.Hash) {
+	e.buf = append(e.buf, v.Bytes()...)
+}
+
+func (e *encoder) pubkey(v babyjub.PublicKey) {
+	if e.err != nil {
+		return
+	}
+	p := v.Point()
+	// the compressed form is only unique for points of the curve.
+	if p.X == nil || p.Y == nil || p.X.Sign() < 0 || p.Y.Sign() < 0 ||
+		!utils.CheckBigIntInField(p.X) || !utils.CheckBigIntInField(p.Y) || !p.InCurve() {
+		e.err = fmt.Errorf("public key is not a point of the curve")
+		return
+	}
+	pkComp := v.Compress()
+	e.buf = append(e.buf, pkComp[:]...)
+}
+
+// decoder reads the fields of a tx from buf, in the order they were encoded.
+type decoder struct {
+	buf []byte
+}
+
+func newDecoder(txType TxType, b []byte, size int) (*decoder, error) {
+	if len(b) < 2 {
+		return nil, fmt.Errorf("tx encoding is too short")
+	}
+	if b[0] != CanonicalVersion {
+		return nil, fmt.Errorf("unknown tx encoding version %d", b[0])
+	}
+	if b[1] != txTypeBytes[txType] {
+		return nil, fmt.Errorf("tx type %d is not %s", b[1], txType)
+	}
+	if len(b) != 2+size {
+		return nil, fmt.Errorf("expected %d bytes of %s tx, got %d", 2+size, txType, len(b))
+	}
+	return &decoder{buf: b[2:]}, nil
+}
+
+func (d *decoder) next(n int) []byte {
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) int() int {
+	return int(int64(binary.BigEndian.Uint64(d.next(intBytes))))
+}
+
+func (d *decoder) amount() *big.Int {
+	return new(big.Int).SetBytes(d.next(amountBytes))
+}
+
+func (d *decoder) address() common.Address {
+	return common.BytesToAddress(d.next(addressBytes))
+}
+
+func (d *decoder) hash() common.Hash {
+	return common.BytesToHash(d.next(hashBytes))
+}
+
+func (d *decoder) pubkey() (babyjub.PublicKey, error) {
+	var pkComp babyjub.PublicKeyComp
+	copy(pkComp[:], d.next(pubkeyBytes))
+	pk, err := pkComp.Decompress()
+	if err != nil {
+		return babyjub.PublicKey{}, err
+	}
+	if pk.Compress() != pkComp {
+		return babyjub.PublicKey{}, fmt.Errorf("public key is not in its canonical compressed form")
+	}
+	return *pk, nil
+}
+
+// nonCanonicalBytes returns the bytes of a tx without canonical encoding.
+func nonCanonicalBytes(txType TxType, tx ZionTx) []byte {
+	txJson, err := json.Marshal(tx)
+	if err != nil {
+		// only a signature that can't be compressed fails to be marshalled.
+		txJson = []byte(fmt.Sprintf("%v", tx))
+	}
+	return append([]byte{nonCanonicalVersion, txTypeBytes[txType]}, txJson...)
+}
+
+// DecodeZionTx decodes a ZionTx from its canonical encoding.
+func DecodeZionTx(b []byte) (ZionTx, error) {
+	if len(b) < 2 {
+		return nil, fmt.Errorf("tx encoding is too short")
+	}
+	switch b[1] {
+	case txTypeBytes[Transfer]:
+		return DecodeTransferTx(b)
+	case txTypeBytes[Withdraw]:
+		return DecodeWithdrawTx(b)
+	case txTypeBytes[PubKeyUpdate]:
+		return DecodePubkeyUpdateTx(b)
+	case txTypeBytes[Batch]:
+		return DecodeBatchTx(b)
+	case txTypeBytes[ForcedExit]:
+		return DecodeForcedExitTx(b)
+	case txTypeBytes[Swap]:
+		return DecodeSwapTx(b)
+	case txTypeBytes[MintNFT]:
+		return DecodeMintNFTTx(b)
+	}
+	return nil, fmt.Errorf("unknown tx type %d", b[1])
+}
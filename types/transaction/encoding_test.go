@@ -0,0 +1,187 @@
+package transaction
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+)
+
+func testTransferTx() TransferTx {
+	return TransferTx{
+		AccountId:  1,
+		Nonce:      12,
+		ValidUntil: 1700000000,
+		FeeToken:   0,
+		Fee:        big.NewInt(1000),
+		From:       common.HexToAddress("0x2a500A5e1950aea40C22d8885C8DC3c02e99b3E2"),
+		To:         common.HexToAddress("0x0000000000000000000000000000000000000abc"),
+		Token:      2,
+		Amount:     new(big.Int).Lsh(big.NewInt(1), 200),
+	}
+}
+
+func testWithdrawTx() WithdrawTx {
+	return WithdrawTx{
+		AccountId:       7,
+		Nonce:           3,
+		ValidUntil:      1700000000,
+		FeeToken:        1,
+		Fee:             big.NewInt(5),
+		From:            common.HexToAddress("0x2a500A5e1950aea40C22d8885C8DC3c02e99b3E2"),
+		To:              common.HexToAddress("0x2a500A5e1950aea40C22d8885C8DC3c02e99b3E2"),
+		Token:           1,
+		Amount:          big.NewInt(123456789),
+		MinGas:          big.NewInt(21000),
+		OnchainDataHash: common.HexToHash("0x1234"),
+	}
+}
+
+func testForcedExitTx() ForcedExitTx {
+	return ForcedExitTx{
+		AccountId:  7,
+		Nonce:      3,
+		ValidUntil: 1700000000,
+		FeeToken:   1,
+		Fee:        big.NewInt(5),
+		Target:     common.HexToAddress("0x0000000000000000000000000000000000000abc"),
+		Token:      2,
+	}
+}
+
+func testSwapTx() SwapTx {
+	order := func(accountId, tokenSell, tokenBuy int) Order {
+		return Order{
+			AccountId:  accountId,
+			Nonce:      1,
+			TokenSell:  tokenSell,
+			TokenBuy:   tokenBuy,
+			PriceSell:  big.NewInt(1),
+			PriceBuy:   big.NewInt(25),
+			Amount:     big.NewInt(1000),
+			ValidUntil: 1700000000,
+		}
+	}
+	return SwapTx{
+		SubmitterId:      1,
+		SubmitterAddress: common.HexToAddress("0x2a500A5e1950aea40C22d8885C8DC3c02e99b3E2"),
+		Nonce:            4,
+		Orders:           [2]Order{order(2, 3, 4), order(5, 4, 3)},
+		Amounts:          [2]*big.Int{big.NewInt(1000), big.NewInt(25000)},
+		FeeToken:         0,
+		Fee:              big.NewInt(10),
+	}
+}
+
+func testMintNFTTx() MintNFTTx {
+	return MintNFTTx{
+		CreatorId:      7,
+		CreatorAddress: common.HexToAddress("0x2a500A5e1950aea40C22d8885C8DC3c02e99b3E2"),
+		ContentHash:    common.HexToHash("0xc0ffee"),
+		Recipient:      common.HexToAddress("0x0000000000000000000000000000000000000abc"),
+		FeeToken:       0,
+		Fee:            big.NewInt(10),
+		Nonce:          2,
+		ValidUntil:     1700000000,
+	}
+}
+
+func testPubkeyUpdateTx() PubkeyUpdateTx {
+	k := babyjub.PrivateKey{1, 2, 3}
+	return PubkeyUpdateTx{
+		AccountId:  7,
+		Nonce:      0,
+		ValidUntil: 1700000000,
+		FeeToken:   0,
+		Fee:        big.NewInt(0),
+		Account:    common.HexToAddress("0x2a500A5e1950aea40C22d8885C8DC3c02e99b3E2"),
+		PubKey:     *k.Public(),
+	}
+}
+
+func TestCanonicalRoundTrip(t *testing.T) {
+	for _, tx := range []ZionTx{testTransferTx(), testWithdrawTx(), testPubkeyUpdateTx(), testBatchTx(), testForcedExitTx(), testSwapTx(), testMintNFTTx()} {
+		b := tx.GetBytes()
+		assert.Equal(t, CanonicalVersion, b[0])
+
+		decoded, err := DecodeZionTx(b)
+		require.Nil(t, err)
+		assert.IsType(t, tx, decoded)
+		assert.Equal(t, b, decoded.GetBytes())
+		// big.Int values are not comparable with assert.Equal
+		want, err := FromZionTxToJson(tx)
+		require.Nil(t, err)
+		got, err := FromZionTxToJson(decoded)
+		require.Nil(t, err)
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestCanonicalNoCollision(t *testing.T) {
+	// with decimal digits, (1, 12) and (11, 2) had the same bytes.
+	tx1 := testTransferTx()
+	tx2 := testTransferTx()
+	tx2.AccountId, tx2.Nonce = 11, 2
+	assert.NotEqual(t, ZionTxHash(tx1), ZionTxHash(tx2))
+
+	// with variable length amounts, moving a byte from fee to amount did too.
+	tx3 := testTransferTx()
+	tx3.Fee = big.NewInt(3)
+	tx3.Amount = big.NewInt(0x0300)
+	tx4 := testTransferTx()
+	tx4.Fee = big.NewInt(0x0303)
+	tx4.Amount = big.NewInt(0)
+	assert.NotEqual(t, ZionTxHash(tx3), ZionTxHash(tx4))
+}
+
+func TestNonCanonicalTx(t *testing.T) {
+	tx := testTransferTx()
+	tx.Amount = big.NewInt(-1)
+	_, err := tx.Encode()
+	assert.NotNil(t, err)
+
+	b := tx.GetBytes()
+	assert.Equal(t, nonCanonicalVersion, b[0])
+	_, err = DecodeZionTx(b)
+	assert.NotNil(t, err)
+
+	tx2 := tx
+	tx2.Amount = big.NewInt(-2)
+	assert.NotEqual(t, ZionTxHash(tx), ZionTxHash(tx2))
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	b := testTransferTx().GetBytes()
+	_, err := DecodeTransferTx(b[:len(b)-1])
+	assert.NotNil(t, err)
+	_, err = DecodeWithdrawTx(b)
+	assert.NotNil(t, err)
+
+	b[0] = 2
+	_, err = DecodeTransferTx(b)
+	assert.NotNil(t, err)
+}
+
+func FuzzDecodeZionTx(f *testing.F) {
+	f.Add(testTransferTx().GetBytes())
+	f.Add(testWithdrawTx().GetBytes())
+	f.Add(testPubkeyUpdateTx().GetBytes())
+	f.Add(testBatchTx().GetBytes())
+	f.Add(testForcedExitTx().GetBytes())
+	f.Add(testSwapTx().GetBytes())
+	f.Add(testMintNFTTx().GetBytes())
+	f.Fuzz(func(t *testing.T, b []byte) {
+		tx, err := DecodeZionTx(b)
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(b, tx.GetBytes()) {
+			t.Fatalf("decoded tx is encoded as %x instead of %x", tx.GetBytes(), b)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package transaction
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+	"github.com/vivijj/ziongo/utils/hasher"
+)
+
+var (
+	forcedExitHasher = hasher.NewPoseidonHasher(10)
+)
+
+// ForcedExitTx withdraws the whole balance of a token of the Target account, which
+// has no public key set, to its L1 address. It's signed by the initiator account,
+// which pays the fee.
+type ForcedExitTx struct {
+	// account id of the transaction initiator.
+	AccountId  int
+	Nonce      int
+	ValidUntil int
+	FeeToken   int
+	Fee        *big.Int
+
+	Target    common.Address
+	Token     int
+	Signature babyjub.Signature
+}
+
+func (tx ForcedExitTx) isZionTx() {}
+
+// forcedExitTxBytes is the size of the canonical encoding of a ForcedExitTx
+// (without the version and type bytes).
+const forcedExitTxBytes = 5*intBytes + amountBytes + addressBytes
+
+// Encode returns the canonical encoding of the tx, the signature is not part of
+// it.  It fails if the fee is not an unsigned 256 bits integer.
+func (tx ForcedExitTx) Encode() ([]byte, error) {
+	e := newEncoder(ForcedExit, forcedExitTxBytes)
+	e.int(tx.AccountId)
+	e.int(tx.Nonce)
+	e.int(tx.ValidUntil)
+	e.int(tx.FeeToken)
+	e.amount("fee", tx.Fee)
+	e.address(tx.Target)
+	e.int(tx.Token)
+	return e.buf, e.err
+}
+
+// GetBytes returns the canonical encoding of the tx.
+func (tx ForcedExitTx) GetBytes() []byte {
+	b, err := tx.Encode()
+	if err != nil {
+		return nonCanonicalBytes(ForcedExit, tx)
+	}
+	return b
+}
+
+// DecodeForcedExitTx decodes a ForcedExitTx from its canonical encoding, the
+// signature is left empty.
+func DecodeForcedExitTx(b []byte) (ForcedExitTx, error) {
+	d, err := newDecoder(ForcedExit, b, forcedExitTxBytes)
+	if err != nil {
+		return ForcedExitTx{}, err
+	}
+	var tx ForcedExitTx
+	tx.AccountId = d.int()
+	tx.Nonce = d.int()
+	tx.ValidUntil = d.int()
+	tx.FeeToken = d.int()
+	tx.Fee = d.amount()
+	tx.Target = d.address()
+	tx.Token = d.int()
+	return tx, nil
+}
+
+// EncodeBi Encode the transaction data as *big.Int by poseidon hash, this is the
+// message signed for the chain chainId.
+func (tx ForcedExitTx) EncodeBi(chainId int) *big.Int {
+	out := sigPrefixBi(ForcedExit, chainId)
+	out = append(out, big.NewInt(int64(tx.AccountId)))
+	out = append(out, new(big.Int).SetBytes(tx.Target.Bytes()))
+	out = append(out, big.NewInt(int64(tx.Token)))
+	out = append(out, big.NewInt(int64(tx.FeeToken)))
+	out = append(out, tx.Fee)
+	out = append(out, big.NewInt(int64(tx.ValidUntil)))
+	out = append(out, big.NewInt(int64(tx.Nonce)))
+
+	return forcedExitHasher.HashBi(out)
+}
+
+// VerifySignature verifies the signature of the tx made by pubKey for the chain
+// chainId.
+func (tx ForcedExitTx) VerifySignature(chainId int, pubKey *babyjub.PublicKey) error {
+	return pubKey.VerifyPoseidonStrict(tx.EncodeBi(chainId), &tx.Signature)
+}
+
+type forcedExitTxJson struct {
+	AccountId  int
+	Nonce      int
+	ValidUntil int
+	FeeToken   int
+	Fee        jsonAmount
+	Target     common.Address
+	Token      int
+	Signature  jsonSignature
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (tx ForcedExitTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(forcedExitTxJson{
+		AccountId:  tx.AccountId,
+		Nonce:      tx.Nonce,
+		ValidUntil: tx.ValidUntil,
+		FeeToken:   tx.FeeToken,
+		Fee:        jsonAmount{tx.Fee},
+		Target:     tx.Target,
+		Token:      tx.Token,
+		Signature:  jsonSignature(tx.Signature),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (tx *ForcedExitTx) UnmarshalJSON(data []byte) error {
+	var jtx forcedExitTxJson
+	if err := decodeStrict(data, &jtx); err != nil {
+		return err
+	}
+	*tx = ForcedExitTx{
+		AccountId:  jtx.AccountId,
+		Nonce:      jtx.Nonce,
+		ValidUntil: jtx.ValidUntil,
+		FeeToken:   jtx.FeeToken,
+		Fee:        jtx.Fee.Int,
+		Target:     jtx.Target,
+		Token:      jtx.Token,
+		Signature:  babyjub.Signature(jtx.Signature),
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package transaction
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// FullExitTx is submitted on L1 by the owner of an account to withdraw its whole
+// balance of a token. Since it's a priority tx, the operator can't censor it.
+type FullExitTx struct {
+	AccountId int
+	// EthAddress is the L1 sender of the request, the balance is only withdrawn
+	// if it's the address of the account.
+	EthAddress common.Address
+	Token      int
+}
+
+func (tx FullExitTx) isZionPriTx() {}
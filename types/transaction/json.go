@@ -1,79 +1,339 @@
 package transaction
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+	"github.com/vivijj/ziongo/crypto/utils"
 )
 
-// a simple helper to marshal and unmarshal ZionTx interface
+// The JSON codec of the txs is strict, since the txs come from the clients: every
+// field must be present (only a signature may be null), unknown fields and
+// trailing data are rejected, amounts are unsigned decimal strings, and addresses,
+// hashes, byte strings, signatures and public keys are 0x-hex strings, the last
+// two in their compressed form.
 
+// ZionTxJson is the JSON form of a ZionTx along with its type.
 type ZionTxJson struct {
 	Type  TxType
 	Value json.RawMessage
 }
 
-func FromZionTxToJson(txData ZionTx) ZionTxJson {
-	var txType TxType
-	switch txData.(type) {
+// txTypeOf returns the type of the tx.
+func txTypeOf(tx ZionTx) (TxType, error) {
+	switch tx.(type) {
 	case TransferTx:
-		txType = Transfer
+		return Transfer, nil
 	case WithdrawTx:
-		txType = Withdraw
+		return Withdraw, nil
 	case PubkeyUpdateTx:
-		txType = PubKeyUpdate
+		return PubKeyUpdate, nil
+	case BatchTx:
+		return Batch, nil
+	case ForcedExitTx:
+		return ForcedExit, nil
+	case SwapTx:
+		return Swap, nil
+	case MintNFTTx:
+		return MintNFT, nil
+	}
+	return "", fmt.Errorf("unknown tx type %T", tx)
+}
+
+// FromZionTxToJson returns the JSON form of the tx with its type.
+func FromZionTxToJson(txData ZionTx) (ZionTxJson, error) {
+	txType, err := txTypeOf(txData)
+	if err != nil {
+		return ZionTxJson{}, err
+	}
+	jtx, err := json.Marshal(txData)
+	if err != nil {
+		return ZionTxJson{}, fmt.Errorf("%s tx: %w", txType, err)
 	}
-	jtx, _ := json.Marshal(txData)
 	return ZionTxJson{
 		Type:  txType,
 		Value: jtx,
-	}
+	}, nil
 }
 
-// ParseZionTx Parse Zion tx from the ZionTxJson, if failed, return the nil interface.
-func (jtx *ZionTxJson) ParseZionTx() ZionTx {
+// ParseZionTx parses the Zion tx of the ZionTxJson according to its type.
+func (jtx *ZionTxJson) ParseZionTx() (ZionTx, error) {
+	var (
+		tx  ZionTx
+		err error
+	)
 	switch jtx.Type {
 	case Withdraw:
 		var withdraw WithdrawTx
-		_ = json.Unmarshal(jtx.Value, &withdraw)
-		return withdraw
-
+		err = json.Unmarshal(jtx.Value, &withdraw)
+		tx = withdraw
 	case Transfer:
 		var transfer TransferTx
-		_ = json.Unmarshal(jtx.Value, &transfer)
-		return transfer
-
+		err = json.Unmarshal(jtx.Value, &transfer)
+		tx = transfer
 	case PubKeyUpdate:
 		var pubkeyUpdate PubkeyUpdateTx
-		_ = json.Unmarshal(jtx.Value, &pubkeyUpdate)
-		return pubkeyUpdate
+		err = json.Unmarshal(jtx.Value, &pubkeyUpdate)
+		tx = pubkeyUpdate
+	case Batch:
+		var batch BatchTx
+		err = json.Unmarshal(jtx.Value, &batch)
+		tx = batch
+	case ForcedExit:
+		var forcedExit ForcedExitTx
+		err = json.Unmarshal(jtx.Value, &forcedExit)
+		tx = forcedExit
+	case Swap:
+		var swap SwapTx
+		err = json.Unmarshal(jtx.Value, &swap)
+		tx = swap
+	case MintNFT:
+		var mintNFT MintNFTTx
+		err = json.Unmarshal(jtx.Value, &mintNFT)
+		tx = mintNFT
+	default:
+		return nil, fmt.Errorf("unknown tx type %q", jtx.Type)
 	}
-	return nil
+	if err != nil {
+		return nil, fmt.Errorf("%s tx: %w", jtx.Type, err)
+	}
+	return tx, nil
 }
 
+// TypedZionTx is a ZionTx marshalled as its ZionTxJson.
 type TypedZionTx struct {
 	Type  TxType
 	Value ZionTx
 }
 
+// MarshalJSON implements the json.Marshaler interface.
+func (tx TypedZionTx) MarshalJSON() ([]byte, error) {
+	if tx.Value == nil {
+		return nil, fmt.Errorf("tx is nil")
+	}
+	jtx, err := FromZionTxToJson(tx.Value)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Type != "" && tx.Type != jtx.Type {
+		return nil, fmt.Errorf("tx type %s is not %s", jtx.Type, tx.Type)
+	}
+	return json.Marshal(jtx)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
 func (tx *TypedZionTx) UnmarshalJSON(data []byte) error {
-	var txJSon ZionTxJson
-	err := json.Unmarshal(data, &txJSon)
-	switch txJSon.Type {
-	case Withdraw:
-		var withdraw WithdrawTx
-		err = json.Unmarshal(txJSon.Value, &withdraw)
-		tx.Value = withdraw
-	case Transfer:
-		var transfer TransferTx
-		err = json.Unmarshal(txJSon.Value, &transfer)
-		tx.Value = transfer
-	case PubKeyUpdate:
-		var pubkeyUpdate PubkeyUpdateTx
-		err = json.Unmarshal(txJSon.Value, &pubkeyUpdate)
-		tx.Value = pubkeyUpdate
-	default:
-		return fmt.Errorf("invalid ZionTx type")
+	var jtx ZionTxJson
+	if err := decodeStrict(data, &jtx); err != nil {
+		return err
+	}
+	value, err := jtx.ParseZionTx()
+	if err != nil {
+		return err
+	}
+	tx.Type = jtx.Type
+	tx.Value = value
+	return nil
+}
+
+var jsonSignatureType = reflect.TypeOf(jsonSignature{})
+
+// decodeStrict decodes the JSON object data into the struct pointed by v. Every
+// field of v must be in data once with its exact name, and not null unless it's a
+// signature, while unknown fields and trailing data are rejected.  The keys are
+// checked before decoding, since encoding/json matches them case-insensitively
+// and keeps the last of duplicated keys.
+func decodeStrict(data []byte, v interface{}) error {
+	fields, err := objectFields(data)
+	if err != nil {
+		return err
+	}
+	t := reflect.TypeOf(v).Elem()
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		names[f.Name] = true
+		raw, ok := fields[f.Name]
+		if !ok {
+			return fmt.Errorf("missing field %s", f.Name)
+		}
+		if bytes.Equal(raw, []byte("null")) && f.Type != jsonSignatureType {
+			return fmt.Errorf("field %s is null", f.Name)
+		}
+	}
+	for name := range fields {
+		if !names[name] {
+			return fmt.Errorf("unknown field %q", name)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after the JSON object")
+	}
+	return nil
+}
 
+// objectFields returns the raw values of the JSON object data by key, it fails if
+// data is not an object or has a duplicated key.
+func objectFields(data []byte) (map[string]json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, fmt.Errorf("expected a JSON object, got %v", tok)
+	}
+	fields := make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a field name, got %v", tok)
+		}
+		if _, ok := fields[key]; ok {
+			return nil, fmt.Errorf("duplicated field %q", key)
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		fields[key] = raw
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
 	}
-	return err
+	return fields, nil
+}
+
+// maxAmountDigits is the number of decimal digits of the biggest 256 bits amount.
+const maxAmountDigits = 78
+
+// jsonAmount is the JSON form of an amount: an unsigned 256 bits integer as a
+// decimal string, without leading zeros.
+type jsonAmount struct {
+	*big.Int
+}
+
+// MarshalJSON implements the json.Marshaler interface, a nil amount is null.
+func (a jsonAmount) MarshalJSON() ([]byte, error) {
+	if a.Int == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(a.Int.String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (a *jsonAmount) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("amount is not a decimal string: %s", data)
+	}
+	if len(s) == 0 || len(s) > maxAmountDigits || (len(s) > 1 && s[0] == '0') {
+		return fmt.Errorf("amount %q is not an unsigned 256 bits decimal", s)
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("amount %q is not an unsigned 256 bits decimal", s)
+		}
+	}
+	v, _ := new(big.Int).SetString(s, 10)
+	if v.BitLen() > 8*amountBytes {
+		return fmt.Errorf("amount %q is not an unsigned 256 bits decimal", s)
+	}
+	a.Int = v
+	return nil
+}
+
+// jsonHex decodes the 0x-hex string data into dst, which is filled exactly.
+func jsonHex(name string, dst []byte, data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("%s is not a hex string: %s", name, data)
+	}
+	if len(s) < 2 || s[:2] != "0x" {
+		return fmt.Errorf("%s %q has no 0x prefix", name, s)
+	}
+	if err := utils.HexDecodeInto(dst, []byte(s[2:])); err != nil {
+		return fmt.Errorf("%s %q: %w", name, s, err)
+	}
+	return nil
+}
+
+// jsonSignature is the JSON form of a signature: its compressed form as a 0x-hex
+// string, or null when the tx is not signed.
+type jsonSignature babyjub.Signature
+
+// MarshalJSON implements the json.Marshaler interface.
+func (sig jsonSignature) MarshalJSON() ([]byte, error) {
+	if sig.R8 == nil || sig.S == nil {
+		return []byte("null"), nil
+	}
+	if sig.R8.X == nil || sig.R8.Y == nil || sig.S.Sign() < 0 || sig.S.BitLen() > 256 {
+		return nil, fmt.Errorf("signature can't be compressed")
+	}
+	s := babyjub.Signature(sig)
+	sComp := s.Compress()
+	return json.Marshal(utils.HexEncode(sComp[:]))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (sig *jsonSignature) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*sig = jsonSignature{}
+		return nil
+	}
+	var sComp babyjub.SignatureComp
+	if err := jsonHex("signature", sComp[:], data); err != nil {
+		return err
+	}
+	s, err := sComp.Decompress()
+	if err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+	*sig = jsonSignature(*s)
+	return nil
+}
+
+// jsonPubKey is the JSON form of a public key: its compressed form as a 0x-hex
+// string.  Unlike a signature, it's never null.
+type jsonPubKey babyjub.PublicKey
+
+// MarshalJSON implements the json.Marshaler interface, it fails for a missing key.
+func (pk jsonPubKey) MarshalJSON() ([]byte, error) {
+	if pk.X == nil || pk.Y == nil {
+		return nil, fmt.Errorf("public key is missing")
+	}
+	pkComp := (*babyjub.PublicKey)(&pk).Compress()
+	return json.Marshal(utils.HexEncode(pkComp[:]))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pk *jsonPubKey) UnmarshalJSON(data []byte) error {
+	var pkComp babyjub.PublicKeyComp
+	if err := jsonHex("public key", pkComp[:], data); err != nil {
+		return err
+	}
+	p, err := pkComp.Decompress()
+	if err != nil {
+		return fmt.Errorf("public key: %w", err)
+	}
+	*pk = jsonPubKey(*p)
+	return nil
 }
@@ -0,0 +1,168 @@
+package transaction
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+)
+
+func testJsonTxs() []ZionTx {
+	k := babyjub.PrivateKey{1, 2, 3}
+	transfer := testTransferTx()
+	transfer.Signature = *k.SignPoseidon(transfer.EncodeBi(1))
+	swap := testSwapTx()
+	swap.Orders[0].Signature = *k.SignPoseidon(swap.Orders[0].EncodeBi(1))
+	pubkeyUpdate := testPubkeyUpdateTx()
+	pubkeyUpdate.AuthData = []byte{1, 2, 3}
+	return []ZionTx{
+		transfer, testWithdrawTx(), pubkeyUpdate, testBatchTx(), testForcedExitTx(), swap, testMintNFTTx(),
+	}
+}
+
+func TestTypedZionTxJson(t *testing.T) {
+	for _, tx := range testJsonTxs() {
+		b, err := json.Marshal(TypedZionTx{Value: tx})
+		require.NoError(t, err)
+
+		var typed TypedZionTx
+		require.NoError(t, json.Unmarshal(b, &typed), string(b))
+		assert.IsType(t, tx, typed.Value)
+		assert.Equal(t, tx.GetBytes(), typed.Value.GetBytes())
+
+		b2, err := json.Marshal(typed)
+		require.NoError(t, err)
+		assert.Equal(t, string(b), string(b2))
+	}
+
+	_, err := json.Marshal(TypedZionTx{Type: Withdraw, Value: testTransferTx()})
+	assert.Error(t, err)
+	_, err = json.Marshal(TypedZionTx{})
+	assert.Error(t, err)
+}
+
+func TestTypedZionTxJsonFormat(t *testing.T) {
+	b, err := json.Marshal(testJsonTxs()[0])
+	require.NoError(t, err)
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(b, &fields))
+	assert.Equal(t, `"1000"`, string(fields["Fee"]))
+	assert.Equal(t, `"0x2a500a5e1950aea40c22d8885c8dc3c02e99b3e2"`, strings.ToLower(string(fields["From"])))
+	assert.True(t, strings.HasPrefix(string(fields["Signature"]), `"0x`))
+	assert.Len(t, fields["Signature"], 2+2+128)
+
+	b, err = json.Marshal(testTransferTx())
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, &fields))
+	assert.Equal(t, "null", string(fields["Signature"]))
+}
+
+func TestTypedZionTxJsonInvalid(t *testing.T) {
+	b, err := json.Marshal(TypedZionTx{Value: testJsonTxs()[0]})
+	require.NoError(t, err)
+	valid := string(b)
+
+	for name, data := range map[string]string{
+		"unknown type":     strings.Replace(valid, `"Transfer"`, `"Teleport"`, 1),
+		"unknown field":    strings.Replace(valid, `"Nonce":`, `"Nonce2":1,"Nonce":`, 1),
+		"unknown top":      strings.Replace(valid, `"Type":`, `"Extra":1,"Type":`, 1),
+		"missing field":    strings.Replace(valid, `"Nonce":12,`, ``, 1),
+		"number amount":    strings.Replace(valid, `"Fee":"1000"`, `"Fee":1000`, 1),
+		"negative amount":  strings.Replace(valid, `"Fee":"1000"`, `"Fee":"-1000"`, 1),
+		"leading zero":     strings.Replace(valid, `"Fee":"1000"`, `"Fee":"01000"`, 1),
+		"hex amount":       strings.Replace(valid, `"Fee":"1000"`, `"Fee":"0x3e8"`, 1),
+		"null amount":      strings.Replace(valid, `"Fee":"1000"`, `"Fee":null`, 1),
+		"null int":         strings.Replace(valid, `"Nonce":12`, `"Nonce":null`, 1),
+		"float int":        strings.Replace(valid, `"Nonce":12`, `"Nonce":12.5`, 1),
+		"short address":    strings.Replace(valid, `"0x0000000000000000000000000000000000000abc"`, `"0xabc"`, 1),
+		"bare address":     strings.Replace(valid, `"0x0000000000000000000000000000000000000abc"`, `"0000000000000000000000000000000000000abc"`, 1),
+		"bad signature":    strings.Replace(valid, `"Signature":"0x`, `"Signature":"0xzz`, 1),
+		"trailing data":    valid + `{}`,
+		"lower case field": strings.Replace(valid, `"Fee":`, `"fee":`, 1),
+		"lower case top":   strings.Replace(valid, `"Type":`, `"type":`, 1),
+		"duplicate field":  strings.Replace(valid, `"Fee":"1000"`, `"Fee":"1000","Fee":"999"`, 1),
+		"case duplicate":   strings.Replace(valid, `"Fee":"1000"`, `"Fee":"1000","fee":"999"`, 1),
+		"duplicate top":    strings.Replace(valid, `"Type":"Transfer"`, `"Type":"Transfer","Type":"Withdraw"`, 1),
+		"null value":       `{"Type":"Transfer","Value":null}`,
+		"missing value":    `{"Type":"Transfer"}`,
+		"not an object":    `[]`,
+		"nested batch":     `{"Type":"Batch","Value":{"Txs":[{"Type":"Batch","Value":{"Txs":[],"Signature":"0x"}}],"Signature":"0x"}}`,
+		"swap short array": `{"Type":"Swap","Value":{"SubmitterId":0,"SubmitterAddress":"0x0000000000000000000000000000000000000000","Nonce":0,"Orders":[],"Amounts":[],"FeeToken":0,"Fee":"0","Signature":null}}`,
+	} {
+		var typed TypedZionTx
+		assert.Error(t, json.Unmarshal([]byte(data), &typed), name)
+		assert.Nil(t, typed.Value, name)
+	}
+}
+
+func TestJsonPubKey(t *testing.T) {
+	tx := testPubkeyUpdateTx()
+	b, err := json.Marshal(tx)
+	require.NoError(t, err)
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(b, &fields))
+	fields["PubKey"] = json.RawMessage("null")
+	b, err = json.Marshal(fields)
+	require.NoError(t, err)
+	var decoded PubkeyUpdateTx
+	assert.Error(t, json.Unmarshal(b, &decoded))
+
+	// a missing key is neither written nor read as null.
+	tx.PubKey = babyjub.PublicKey{}
+	_, err = json.Marshal(TypedZionTx{Value: tx})
+	assert.Error(t, err)
+	var pk jsonPubKey
+	assert.Error(t, pk.UnmarshalJSON([]byte("null")))
+}
+
+func TestJsonAmountTooBig(t *testing.T) {
+	var a jsonAmount
+	// 2^256 has 78 digits, but doesn't fit in 256 bits.
+	assert.Error(t, a.UnmarshalJSON([]byte(`"115792089237316195423570985008687907853269984665640564039457584007913129639936"`)))
+	assert.NoError(t, a.UnmarshalJSON([]byte(`"115792089237316195423570985008687907853269984665640564039457584007913129639935"`)))
+}
+
+func FuzzTypedZionTxJson(f *testing.F) {
+	for _, tx := range testJsonTxs() {
+		b, err := json.Marshal(TypedZionTx{Value: tx})
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	// keys that encoding/json alone would match case-insensitively, or keep the
+	// last of.
+	b, err := json.Marshal(TypedZionTx{Value: testJsonTxs()[0]})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add([]byte(strings.Replace(string(b), `"Fee":"1000"`, `"Fee":"1000","fee":"999"`, 1)))
+	f.Add([]byte(strings.Replace(string(b), `"Fee":"1000"`, `"Fee":"1000","Fee":"999"`, 1)))
+	f.Add([]byte(strings.Replace(string(b), `"Nonce":`, `"NONCE":`, 1)))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var typed TypedZionTx
+		if err := json.Unmarshal(b, &typed); err != nil {
+			return
+		}
+		if typed.Value == nil {
+			t.Fatalf("tx of %s is nil", b)
+		}
+		// a parsed tx is marshalled again, to the same tx.
+		b2, err := json.Marshal(typed)
+		if err != nil {
+			t.Fatalf("parsed tx of %s is not marshalled: %v", b, err)
+		}
+		var typed2 TypedZionTx
+		if err := json.Unmarshal(b2, &typed2); err != nil {
+			t.Fatalf("marshalled tx %s is not parsed: %v", b2, err)
+		}
+		if !bytes.Equal(typed.Value.GetBytes(), typed2.Value.GetBytes()) {
+			t.Fatalf("tx of %s is %s after a round trip", b, b2)
+		}
+	})
+}
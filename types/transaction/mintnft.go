@@ -0,0 +1,150 @@
+package transaction
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+	"github.com/vivijj/ziongo/utils/hasher"
+)
+
+var (
+	mintNFTHasher = hasher.NewPoseidonHasher(12)
+)
+
+// MintNFTTx mints a NFT with the ContentHash to the Recipient account, the token
+// id and the serial of the NFT are assigned by the state. It's signed by the
+// creator account, which pays the fee.
+type MintNFTTx struct {
+	CreatorId      int
+	CreatorAddress common.Address
+	ContentHash    common.Hash
+	Recipient      common.Address
+	FeeToken       int
+	Fee            *big.Int
+	Nonce          int
+	ValidUntil     int
+	Signature      babyjub.Signature
+}
+
+func (tx MintNFTTx) isZionTx() {}
+
+// mintNFTTxBytes is the size of the canonical encoding of a MintNFTTx (without
+// the version and type bytes).
+const mintNFTTxBytes = 4*intBytes + 2*addressBytes + hashBytes + amountBytes
+
+// Encode returns the canonical encoding of the tx, the signature is not part of
+// it.  It fails if the fee is not an unsigned 256 bits integer.
+func (tx MintNFTTx) Encode() ([]byte, error) {
+	e := newEncoder(MintNFT, mintNFTTxBytes)
+	e.int(tx.CreatorId)
+	e.address(tx.CreatorAddress)
+	e.hash(tx.ContentHash)
+	e.address(tx.Recipient)
+	e.int(tx.FeeToken)
+	e.amount("fee", tx.Fee)
+	e.int(tx.Nonce)
+	e.int(tx.ValidUntil)
+	return e.buf, e.err
+}
+
+// GetBytes returns the canonical encoding of the tx.
+func (tx MintNFTTx) GetBytes() []byte {
+	b, err := tx.Encode()
+	if err != nil {
+		return nonCanonicalBytes(MintNFT, tx)
+	}
+	return b
+}
+
+// DecodeMintNFTTx decodes a MintNFTTx from its canonical encoding, the signature
+// is left empty.
+func DecodeMintNFTTx(b []byte) (MintNFTTx, error) {
+	d, err := newDecoder(MintNFT, b, mintNFTTxBytes)
+	if err != nil {
+		return MintNFTTx{}, err
+	}
+	var tx MintNFTTx
+	tx.CreatorId = d.int()
+	tx.CreatorAddress = d.address()
+	tx.ContentHash = d.hash()
+	tx.Recipient = d.address()
+	tx.FeeToken = d.int()
+	tx.Fee = d.amount()
+	tx.Nonce = d.int()
+	tx.ValidUntil = d.int()
+	return tx, nil
+}
+
+// EncodeBi Encode the transaction data as *big.Int by poseidon hash, this is the
+// message signed for the chain chainId.
+func (tx MintNFTTx) EncodeBi(chainId int) *big.Int {
+	out := sigPrefixBi(MintNFT, chainId)
+	out = append(out, big.NewInt(int64(tx.CreatorId)))
+	out = append(out, new(big.Int).SetBytes(tx.CreatorAddress.Bytes()))
+	// the content hash is split in two halves to fit in field elements.
+	out = append(out, new(big.Int).SetBytes(tx.ContentHash[:16]))
+	out = append(out, new(big.Int).SetBytes(tx.ContentHash[16:]))
+	out = append(out, new(big.Int).SetBytes(tx.Recipient.Bytes()))
+	out = append(out, big.NewInt(int64(tx.FeeToken)))
+	out = append(out, tx.Fee)
+	out = append(out, big.NewInt(int64(tx.Nonce)))
+	out = append(out, big.NewInt(int64(tx.ValidUntil)))
+
+	return mintNFTHasher.HashBi(out)
+}
+
+// VerifySignature verifies the signature of the tx made by pubKey for the chain
+// chainId.
+func (tx MintNFTTx) VerifySignature(chainId int, pubKey *babyjub.PublicKey) error {
+	return pubKey.VerifyPoseidonStrict(tx.EncodeBi(chainId), &tx.Signature)
+}
+
+type mintNFTTxJson struct {
+	CreatorId      int
+	CreatorAddress common.Address
+	ContentHash    common.Hash
+	Recipient      common.Address
+	FeeToken       int
+	Fee            jsonAmount
+	Nonce          int
+	ValidUntil     int
+	Signature      jsonSignature
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (tx MintNFTTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(mintNFTTxJson{
+		CreatorId:      tx.CreatorId,
+		CreatorAddress: tx.CreatorAddress,
+		ContentHash:    tx.ContentHash,
+		Recipient:      tx.Recipient,
+		FeeToken:       tx.FeeToken,
+		Fee:            jsonAmount{tx.Fee},
+		Nonce:          tx.Nonce,
+		ValidUntil:     tx.ValidUntil,
+		Signature:      jsonSignature(tx.Signature),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (tx *MintNFTTx) UnmarshalJSON(data []byte) error {
+	var jtx mintNFTTxJson
+	if err := decodeStrict(data, &jtx); err != nil {
+		return err
+	}
+	*tx = MintNFTTx{
+		CreatorId:      jtx.CreatorId,
+		CreatorAddress: jtx.CreatorAddress,
+		ContentHash:    jtx.ContentHash,
+		Recipient:      jtx.Recipient,
+		FeeToken:       jtx.FeeToken,
+		Fee:            jtx.Fee.Int,
+		Nonce:          jtx.Nonce,
+		ValidUntil:     jtx.ValidUntil,
+		Signature:      babyjub.Signature(jtx.Signature),
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package transaction
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NewTokenTx is emitted by the contract when a token is registered on L1, the
+// token is not fee eligible until the operator enables it.
+type NewTokenTx struct {
+	Id       int
+	Address  common.Address
+	Symbol   string
+	Decimals uint8
+}
+
+func (tx NewTokenTx) isZionPriTx() {}
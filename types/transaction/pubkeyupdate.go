@@ -1,12 +1,15 @@
 package transaction
 
 import (
-	"bytes"
-	"fmt"
+	"crypto/ecdsa"
+	"encoding/json"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 
 	"github.com/vivijj/ziongo/crypto/babyjub"
 )
@@ -21,51 +24,227 @@ type PubkeyUpdateTx struct {
 	Fee        *big.Int
 	Account    common.Address
 	PubKey     babyjub.PublicKey
+	AuthType   PubkeyAuthType
 	AuthData   []byte
 }
 
 func (tx PubkeyUpdateTx) isZionTx() {}
 
-func (tx PubkeyUpdateTx) GetBytes() (out []byte) {
+// NewPubkeyUpdateTx builds the PubkeyUpdateTx that sets pubKey as the L2 key of the
+// account of ethKey, with the AuthData of the authType signed by ethKey in the
+// domain.
+func NewPubkeyUpdateTx(
+	ethKey *ecdsa.PrivateKey,
+	domain AuthDomain,
+	authType PubkeyAuthType,
+	pubKey babyjub.PublicKey,
+	accountId int,
+	nonce int,
+	validUntil int,
+	feeToken int,
+	fee *big.Int,
+) (PubkeyUpdateTx, error) {
+	tx := PubkeyUpdateTx{
+		AccountId:  accountId,
+		Nonce:      nonce,
+		ValidUntil: validUntil,
+		FeeToken:   feeToken,
+		Fee:        fee,
+		Account:    crypto.PubkeyToAddress(ethKey.PublicKey),
+		PubKey:     pubKey,
+		AuthType:   authType,
+	}
+	msgHash, err := tx.AuthHash(domain)
+	if err != nil {
+		return PubkeyUpdateTx{}, err
+	}
+	authData, err := crypto.Sign(msgHash, ethKey)
+	if err != nil {
+		return PubkeyUpdateTx{}, err
+	}
+	// the recovery id is expected in the 27/28 form.
+	authData[crypto.RecoveryIDOffset] += 27
+	tx.AuthData = authData
+	return tx, nil
+}
+
+// pubkeyUpdateTxBytes is the size of the canonical encoding of a PubkeyUpdateTx
+// (without the version and type bytes).
+const pubkeyUpdateTxBytes = 4*intBytes + amountBytes + addressBytes + pubkeyBytes
+
+// Encode returns the canonical encoding of the tx, the AuthData is not part of
+// it.  It fails if the fee is not an unsigned 256 bits integer or the public
+// key is not a point of the curve.
+func (tx PubkeyUpdateTx) Encode() ([]byte, error) {
+	e := newEncoder(PubKeyUpdate, pubkeyUpdateTxBytes)
+	e.int(tx.AccountId)
+	e.int(tx.Nonce)
+	e.int(tx.ValidUntil)
+	e.int(tx.FeeToken)
+	e.amount("fee", tx.Fee)
+	e.address(tx.Account)
+	e.pubkey(tx.PubKey)
+	return e.buf, e.err
+}
+
+// GetBytes returns the canonical encoding of the tx.
+func (tx PubkeyUpdateTx) GetBytes() []byte {
+	b, err := tx.Encode()
+	if err != nil {
+		return nonCanonicalBytes(PubKeyUpdate, tx)
+	}
+	return b
+}
 
-	out = append(out, []byte(PubKeyUpdate)...)
-	out = append(out, IntToBytes(tx.AccountId)...)
-	out = append(out, IntToBytes(tx.Nonce)...)
-	out = append(out, IntToBytes(tx.ValidUntil)...)
-	out = append(out, IntToBytes(tx.FeeToken)...)
-	out = append(out, tx.Fee.Bytes()...)
-	out = append(out, tx.Account.Bytes()...)
-	out = append(out, tx.PubKey.X.Bytes()...)
-	out = append(out, tx.PubKey.Y.Bytes()...)
+// DecodePubkeyUpdateTx decodes a PubkeyUpdateTx from its canonical encoding, the
+// AuthData is left empty.
+func DecodePubkeyUpdateTx(b []byte) (PubkeyUpdateTx, error) {
+	d, err := newDecoder(PubKeyUpdate, b, pubkeyUpdateTxBytes)
+	if err != nil {
+		return PubkeyUpdateTx{}, err
+	}
+	var tx PubkeyUpdateTx
+	tx.AccountId = d.int()
+	tx.Nonce = d.int()
+	tx.ValidUntil = d.int()
+	tx.FeeToken = d.int()
+	tx.Fee = d.amount()
+	tx.Account = d.address()
+	if tx.PubKey, err = d.pubkey(); err != nil {
+		return PubkeyUpdateTx{}, err
+	}
+	return tx, nil
+}
+
+// HashEncodeData returns the hash signed by the L1 account in the AuthData of the
+// legacy auth type, for the chain chainId.
+func (tx PubkeyUpdateTx) HashEncodeData(chainId int) []byte {
+	return crypto.Keccak256(sigPrefixBytes(PubKeyUpdate, chainId), tx.GetBytes())
+}
+
+// TypedData returns the EIP-712 typed data of the tx in the domain.
+func (tx PubkeyUpdateTx) TypedData(domain AuthDomain) apitypes.TypedData {
+	pkComp := tx.PubKey.Compress()
+	return apitypes.TypedData{
+		Types:       pubkeyUpdateTypes,
+		PrimaryType: pubkeyUpdateTypeName,
+		Domain:      domain.typedDataDomain(),
+		Message: apitypes.TypedDataMessage{
+			"accountId":  intValue(tx.AccountId),
+			"nonce":      intValue(tx.Nonce),
+			"validUntil": intValue(tx.ValidUntil),
+			"feeToken":   intValue(tx.FeeToken),
+			"fee":        (*math.HexOrDecimal256)(tx.Fee),
+			"account":    tx.Account.Hex(),
+			"pubKey":     pkComp[:],
+		},
+	}
+}
 
-	return
+// HashTypedData returns the EIP-712 hash of the tx in the domain, it fails if
+// a field is out of the range of its type.
+func (tx PubkeyUpdateTx) HashTypedData(domain AuthDomain) ([]byte, error) {
+	if tx.Fee == nil {
+		return nil, ErrAuthDataMalformed
+	}
+	typedData := tx.TypedData(domain)
+	domainSeparator, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+	if err != nil {
+		return nil, err
+	}
+	structHash, err := typedData.HashStruct(typedData.PrimaryType, typedData.Message)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256([]byte("\x19\x01"), domainSeparator, structHash), nil
 }
 
-func (tx PubkeyUpdateTx) HashEncodeData() []byte {
-	return crypto.Keccak256(tx.GetBytes())
+// AuthHash returns the hash signed in the AuthData, according to the AuthType of
+// the tx.
+func (tx PubkeyUpdateTx) AuthHash(domain AuthDomain) ([]byte, error) {
+	switch tx.AuthType {
+	case EIP712Auth:
+		return tx.HashTypedData(domain)
+	case LegacyAuth:
+		return tx.HashEncodeData(domain.ChainId), nil
+	}
+	return nil, ErrAuthTypeUnknown
 }
 
-func (tx PubkeyUpdateTx) IsAuthDataValid() bool {
-	userAddr := tx.Account
-	sig := tx.AuthData
-	msgHash := tx.HashEncodeData()
-	fmt.Println("msgHash is: ", msgHash)
-	if len(sig) != 65 {
-		return false
+// VerifyAuthData checks that the AuthData is a signature of the AuthHash made by
+// the L1 account of the tx.  It doesn't modify the tx.
+func (tx PubkeyUpdateTx) VerifyAuthData(domain AuthDomain) error {
+	if len(tx.AuthData) != crypto.SignatureLength {
+		return ErrAuthDataMalformed
 	}
-	if sig[64] != 27 && sig[64] != 28 {
-		return false
+	v := tx.AuthData[crypto.RecoveryIDOffset]
+	if v != 27 && v != 28 {
+		return ErrAuthDataMalformed
 	}
-	sig[64] -= 27
+	msgHash, err := tx.AuthHash(domain)
+	if err != nil {
+		return err
+	}
+	sig := make([]byte, crypto.SignatureLength)
+	copy(sig, tx.AuthData)
+	sig[crypto.RecoveryIDOffset] -= 27
 	pubkey, err := crypto.SigToPub(msgHash, sig)
 	if err != nil {
-		return false
+		return ErrAuthDataMalformed
+	}
+	if crypto.PubkeyToAddress(*pubkey) != tx.Account {
+		return ErrAuthDataSigner
+	}
+	return nil
+}
+
+func (tx PubkeyUpdateTx) IsAuthDataValid(domain AuthDomain) bool {
+	return tx.VerifyAuthData(domain) == nil
+}
+
+type pubkeyUpdateTxJson struct {
+	AccountId  int
+	Nonce      int
+	ValidUntil int
+	FeeToken   int
+	Fee        jsonAmount
+	Account    common.Address
+	PubKey     jsonPubKey
+	AuthType   PubkeyAuthType
+	AuthData   hexutil.Bytes
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (tx PubkeyUpdateTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pubkeyUpdateTxJson{
+		AccountId:  tx.AccountId,
+		Nonce:      tx.Nonce,
+		ValidUntil: tx.ValidUntil,
+		FeeToken:   tx.FeeToken,
+		Fee:        jsonAmount{tx.Fee},
+		Account:    tx.Account,
+		PubKey:     jsonPubKey(tx.PubKey),
+		AuthType:   tx.AuthType,
+		AuthData:   tx.AuthData,
+	})
+}
 
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (tx *PubkeyUpdateTx) UnmarshalJSON(data []byte) error {
+	var jtx pubkeyUpdateTxJson
+	if err := decodeStrict(data, &jtx); err != nil {
+		return err
 	}
-	recoverAddr := crypto.PubkeyToAddress(*pubkey)
-	fmt.Println("recover address is: ", recoverAddr)
-	if !bytes.Equal(recoverAddr.Bytes(), userAddr.Bytes()) {
-		return false
+	*tx = PubkeyUpdateTx{
+		AccountId:  jtx.AccountId,
+		Nonce:      jtx.Nonce,
+		ValidUntil: jtx.ValidUntil,
+		FeeToken:   jtx.FeeToken,
+		Fee:        jtx.Fee.Int,
+		Account:    jtx.Account,
+		PubKey:     babyjub.PublicKey(jtx.PubKey),
+		AuthType:   jtx.AuthType,
+		AuthData:   jtx.AuthData,
 	}
-	return true
+	return nil
 }
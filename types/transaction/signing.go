@@ -0,0 +1,34 @@
+package transaction
+
+import (
+	"encoding/binary"
+	"math/big"
+)
+
+// Every signed message of a tx commits to the chain id and to the domain tag of
+// the tx type, so a signature made for a tx on one chain is neither valid on
+// another chain nor for a tx of another type with the same fields.
+
+// sigDomainTag is the domain tag of the signed messages of the tx type.
+func sigDomainTag(txType TxType) []byte {
+	return []byte("zion.tx." + string(txType))
+}
+
+// sigPrefixBi returns the domain tag of the tx type and the chain id, as the first
+// inputs of the poseidon hash of a L2 signed message.
+func sigPrefixBi(txType TxType, chainId int) []*big.Int {
+	return []*big.Int{
+		new(big.Int).SetBytes(sigDomainTag(txType)),
+		big.NewInt(int64(chainId)),
+	}
+}
+
+// sigPrefixBytes returns the domain tag of the tx type followed by the chain id,
+// as the prefix of the keccak hash of a L1 signed message.
+func sigPrefixBytes(txType TxType, chainId int) []byte {
+	tag := sigDomainTag(txType)
+	b := make([]byte, len(tag)+intBytes)
+	copy(b, tag)
+	binary.BigEndian.PutUint64(b[len(tag):], uint64(chainId))
+	return b
+}
@@ -0,0 +1,77 @@
+package transaction
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+)
+
+const (
+	testChainId  = 1
+	otherChainId = 5
+)
+
+func TestL2SignatureChainId(t *testing.T) {
+	k := babyjub.PrivateKey{4, 5, 6}
+	pk := k.Public()
+
+	transfer := testTransferTx()
+	transfer.Signature = *k.SignPoseidon(transfer.EncodeBi(testChainId))
+	assert.NoError(t, transfer.VerifySignature(testChainId, pk))
+	assert.Error(t, transfer.VerifySignature(otherChainId, pk))
+
+	withdraw := testWithdrawTx()
+	withdraw.Signature = *k.SignPoseidon(withdraw.EncodeBi(testChainId))
+	assert.NoError(t, withdraw.VerifySignature(testChainId, pk))
+	assert.Error(t, withdraw.VerifySignature(otherChainId, pk))
+}
+
+func TestWithdrawSignatureRecipient(t *testing.T) {
+	k := babyjub.PrivateKey{4, 5, 6}
+	withdraw := testWithdrawTx()
+	expected, _ := new(big.Int).SetString("13465005974100468247205306611599091883000733435845994357985662667195952230711", 10)
+	assert.Equal(t, expected, withdraw.EncodeBi(testChainId))
+
+	withdraw.Signature = *k.SignPoseidon(withdraw.EncodeBi(testChainId))
+	require.NoError(t, withdraw.VerifySignature(testChainId, k.Public()))
+	withdraw.To = common.HexToAddress("0x0000000000000000000000000000000000000bad")
+	assert.Error(t, withdraw.VerifySignature(testChainId, k.Public()))
+}
+
+func TestL2SignatureDomain(t *testing.T) {
+	transfer := testTransferTx()
+	withdraw := WithdrawTx{
+		AccountId:  transfer.AccountId,
+		Nonce:      transfer.Nonce,
+		ValidUntil: transfer.ValidUntil,
+		FeeToken:   transfer.FeeToken,
+		Fee:        transfer.Fee,
+		To:         transfer.To,
+		Token:      transfer.Token,
+		Amount:     transfer.Amount,
+	}
+	assert.NotEqual(t, transfer.EncodeBi(testChainId), withdraw.EncodeBi(testChainId))
+	assert.NotEqual(t, transfer.EncodeBi(testChainId), transfer.EncodeBi(otherChainId))
+}
+
+func TestAuthDataChainId(t *testing.T) {
+	ethKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	k := babyjub.PrivateKey{7, 8, 9}
+
+	newTx := func() PubkeyUpdateTx {
+		domain := AuthDomain{ChainId: testChainId}
+		tx, err := NewPubkeyUpdateTx(ethKey, domain, LegacyAuth, *k.Public(), 3, 0, 1700000000, 0, testPubkeyUpdateTx().Fee)
+		require.NoError(t, err)
+		return tx
+	}
+	assert.True(t, newTx().IsAuthDataValid(AuthDomain{ChainId: testChainId}))
+	assert.False(t, newTx().IsAuthDataValid(AuthDomain{ChainId: otherChainId}))
+	assert.NotEqual(t, newTx().HashEncodeData(testChainId), newTx().HashEncodeData(otherChainId))
+}
@@ -0,0 +1,271 @@
+package transaction
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vivijj/ziongo/crypto/babyjub"
+	"github.com/vivijj/ziongo/utils/hasher"
+)
+
+var (
+	orderHasher = hasher.NewPoseidonHasher(11)
+	swapHasher  = hasher.NewPoseidonHasher(12)
+)
+
+// orderDomain is the domain of the signed messages of the orders, which are not
+// txs by themselves.
+const orderDomain TxType = "Order"
+
+// Order is a limit order signed by its account: it sells at most Amount of
+// TokenSell, at a price of at least PriceBuy of TokenBuy for PriceSell of
+// TokenSell. It can be filled by several swaps while the nonce of the account is
+// Nonce, and the nonce is incremented when the order is completely filled.
+type Order struct {
+	AccountId  int
+	Nonce      int
+	TokenSell  int
+	TokenBuy   int
+	PriceSell  *big.Int
+	PriceBuy   *big.Int
+	Amount     *big.Int
+	ValidUntil int
+	Signature  babyjub.Signature
+}
+
+// orderBytes is the size of the canonical encoding of an Order.
+const orderBytes = 5*intBytes + 3*amountBytes
+
+func (o Order) encode(e *encoder) {
+	e.int(o.AccountId)
+	e.int(o.Nonce)
+	e.int(o.TokenSell)
+	e.int(o.TokenBuy)
+	e.amount("sell price", o.PriceSell)
+	e.amount("buy price", o.PriceBuy)
+	e.amount("order amount", o.Amount)
+	e.int(o.ValidUntil)
+}
+
+func decodeOrder(d *decoder) Order {
+	var o Order
+	o.AccountId = d.int()
+	o.Nonce = d.int()
+	o.TokenSell = d.int()
+	o.TokenBuy = d.int()
+	o.PriceSell = d.amount()
+	o.PriceBuy = d.amount()
+	o.Amount = d.amount()
+	o.ValidUntil = d.int()
+	return o
+}
+
+// EncodeBi Encode the order as *big.Int by poseidon hash, this is the message
+// signed for the chain chainId.
+func (o Order) EncodeBi(chainId int) *big.Int {
+	out := sigPrefixBi(orderDomain, chainId)
+	out = append(out, big.NewInt(int64(o.AccountId)))
+	out = append(out, big.NewInt(int64(o.Nonce)))
+	out = append(out, big.NewInt(int64(o.TokenSell)))
+	out = append(out, big.NewInt(int64(o.TokenBuy)))
+	out = append(out, o.PriceSell)
+	out = append(out, o.PriceBuy)
+	out = append(out, o.Amount)
+	out = append(out, big.NewInt(int64(o.ValidUntil)))
+
+	return orderHasher.HashBi(out)
+}
+
+// VerifySignature verifies the signature of the order made by pubKey for the
+// chain chainId.
+func (o Order) VerifySignature(chainId int, pubKey *babyjub.PublicKey) error {
+	return pubKey.VerifyPoseidonStrict(o.EncodeBi(chainId), &o.Signature)
+}
+
+// SwapTx matches two orders: Amounts[0] of the TokenSell of Orders[0] goes to the
+// account of Orders[1], and Amounts[1] of the TokenSell of Orders[1] goes to the
+// account of Orders[0]. It's signed by the submitter, which pays the fee.
+type SwapTx struct {
+	SubmitterId      int
+	SubmitterAddress common.Address
+	Nonce            int
+	Orders           [2]Order
+	Amounts          [2]*big.Int
+	FeeToken         int
+	Fee              *big.Int
+	Signature        babyjub.Signature
+}
+
+func (tx SwapTx) isZionTx() {}
+
+// swapTxBytes is the size of the canonical encoding of a SwapTx (without the
+// version and type bytes).
+const swapTxBytes = 3*intBytes + addressBytes + 2*orderBytes + 3*amountBytes
+
+// Encode returns the canonical encoding of the tx, the signatures of the tx and
+// of the orders are not part of it.  It fails if an amount or a price is not an
+// unsigned 256 bits integer.
+func (tx SwapTx) Encode() ([]byte, error) {
+	e := newEncoder(Swap, swapTxBytes)
+	e.int(tx.SubmitterId)
+	e.address(tx.SubmitterAddress)
+	e.int(tx.Nonce)
+	tx.Orders[0].encode(e)
+	tx.Orders[1].encode(e)
+	e.amount("amount", tx.Amounts[0])
+	e.amount("amount", tx.Amounts[1])
+	e.int(tx.FeeToken)
+	e.amount("fee", tx.Fee)
+	return e.buf, e.err
+}
+
+// GetBytes returns the canonical encoding of the tx.
+func (tx SwapTx) GetBytes() []byte {
+	b, err := tx.Encode()
+	if err != nil {
+		return nonCanonicalBytes(Swap, tx)
+	}
+	return b
+}
+
+// DecodeSwapTx decodes a SwapTx from its canonical encoding, the signatures are
+// left empty.
+func DecodeSwapTx(b []byte) (SwapTx, error) {
+	d, err := newDecoder(Swap, b, swapTxBytes)
+	if err != nil {
+		return SwapTx{}, err
+	}
+	var tx SwapTx
+	tx.SubmitterId = d.int()
+	tx.SubmitterAddress = d.address()
+	tx.Nonce = d.int()
+	tx.Orders[0] = decodeOrder(d)
+	tx.Orders[1] = decodeOrder(d)
+	tx.Amounts[0] = d.amount()
+	tx.Amounts[1] = d.amount()
+	tx.FeeToken = d.int()
+	tx.Fee = d.amount()
+	return tx, nil
+}
+
+// EncodeBi Encode the transaction data as *big.Int by poseidon hash, this is the
+// message signed by the submitter for the chain chainId. It commits to the
+// orders through their signed messages.
+func (tx SwapTx) EncodeBi(chainId int) *big.Int {
+	out := sigPrefixBi(Swap, chainId)
+	out = append(out, big.NewInt(int64(tx.SubmitterId)))
+	out = append(out, new(big.Int).SetBytes(tx.SubmitterAddress.Bytes()))
+	out = append(out, big.NewInt(int64(tx.Nonce)))
+	out = append(out, tx.Orders[0].EncodeBi(chainId))
+	out = append(out, tx.Orders[1].EncodeBi(chainId))
+	out = append(out, tx.Amounts[0])
+	out = append(out, tx.Amounts[1])
+	out = append(out, big.NewInt(int64(tx.FeeToken)))
+	out = append(out, tx.Fee)
+
+	return swapHasher.HashBi(out)
+}
+
+// VerifySignature verifies the signature of the submitter made by pubKey for the
+// chain chainId, the signatures of the orders are verified by Order.VerifySignature.
+func (tx SwapTx) VerifySignature(chainId int, pubKey *babyjub.PublicKey) error {
+	return pubKey.VerifyPoseidonStrict(tx.EncodeBi(chainId), &tx.Signature)
+}
+
+type orderJson struct {
+	AccountId  int
+	Nonce      int
+	TokenSell  int
+	TokenBuy   int
+	PriceSell  jsonAmount
+	PriceBuy   jsonAmount
+	Amount     jsonAmount
+	ValidUntil int
+	Signature  jsonSignature
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (o Order) MarshalJSON() ([]byte, error) {
+	return json.Marshal(orderJson{
+		AccountId:  o.AccountId,
+		Nonce:      o.Nonce,
+		TokenSell:  o.TokenSell,
+		TokenBuy:   o.TokenBuy,
+		PriceSell:  jsonAmount{o.PriceSell},
+		PriceBuy:   jsonAmount{o.PriceBuy},
+		Amount:     jsonAmount{o.Amount},
+		ValidUntil: o.ValidUntil,
+		Signature:  jsonSignature(o.Signature),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (o *Order) UnmarshalJSON(data []byte) error {
+	var jo orderJson
+	if err := decodeStrict(data, &jo); err != nil {
+		return err
+	}
+	*o = Order{
+		AccountId:  jo.AccountId,
+		Nonce:      jo.Nonce,
+		TokenSell:  jo.TokenSell,
+		TokenBuy:   jo.TokenBuy,
+		PriceSell:  jo.PriceSell.Int,
+		PriceBuy:   jo.PriceBuy.Int,
+		Amount:     jo.Amount.Int,
+		ValidUntil: jo.ValidUntil,
+		Signature:  babyjub.Signature(jo.Signature),
+	}
+	return nil
+}
+
+type swapTxJson struct {
+	SubmitterId      int
+	SubmitterAddress common.Address
+	Nonce            int
+	Orders           []Order
+	Amounts          []jsonAmount
+	FeeToken         int
+	Fee              jsonAmount
+	Signature        jsonSignature
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (tx SwapTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(swapTxJson{
+		SubmitterId:      tx.SubmitterId,
+		SubmitterAddress: tx.SubmitterAddress,
+		Nonce:            tx.Nonce,
+		Orders:           tx.Orders[:],
+		Amounts:          []jsonAmount{{tx.Amounts[0]}, {tx.Amounts[1]}},
+		FeeToken:         tx.FeeToken,
+		Fee:              jsonAmount{tx.Fee},
+		Signature:        jsonSignature(tx.Signature),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, both orders and both
+// amounts are required.
+func (tx *SwapTx) UnmarshalJSON(data []byte) error {
+	var jtx swapTxJson
+	if err := decodeStrict(data, &jtx); err != nil {
+		return err
+	}
+	if len(jtx.Orders) != 2 || len(jtx.Amounts) != 2 {
+		return fmt.Errorf("swap needs 2 orders and 2 amounts")
+	}
+	*tx = SwapTx{
+		SubmitterId:      jtx.SubmitterId,
+		SubmitterAddress: jtx.SubmitterAddress,
+		Nonce:            jtx.Nonce,
+		Orders:           [2]Order{jtx.Orders[0], jtx.Orders[1]},
+		Amounts:          [2]*big.Int{jtx.Amounts[0].Int, jtx.Amounts[1].Int},
+		FeeToken:         jtx.FeeToken,
+		Fee:              jtx.Fee.Int,
+		Signature:        babyjub.Signature(jtx.Signature),
+	}
+	return nil
+}
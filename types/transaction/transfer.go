@@ -1,16 +1,17 @@
 package transaction
 
 import (
+	"encoding/json"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 
 	"github.com/vivijj/ziongo/crypto/babyjub"
-	"github.com/vivijj/ziongo/crypto/poseidon"
+	"github.com/vivijj/ziongo/utils/hasher"
 )
 
 var (
-	TransferHasher = poseidon.NewHasher(9)
+	TransferHasher = hasher.NewPoseidonHasher(11)
 )
 
 type TransferTx struct {
@@ -28,24 +29,59 @@ type TransferTx struct {
 
 func (tx TransferTx) isZionTx() {}
 
-func (tx TransferTx) GetBytes() (out []byte) {
-	out = append(out, []byte(Transfer)...)
-	out = append(out, IntToBytes(tx.AccountId)...)
-	out = append(out, IntToBytes(tx.Nonce)...)
-	out = append(out, IntToBytes(tx.ValidUntil)...)
-	out = append(out, IntToBytes(tx.FeeToken)...)
-	out = append(out, tx.Fee.Bytes()...)
-	out = append(out, tx.From.Bytes()...)
-	out = append(out, tx.To.Bytes()...)
-	out = append(out, IntToBytes(tx.Token)...)
-	out = append(out, tx.Amount.Bytes()...)
+// transferTxBytes is the size of the canonical encoding of a TransferTx (without
+// the version and type bytes).
+const transferTxBytes = 5*intBytes + 2*amountBytes + 2*addressBytes
 
-	return
+// Encode returns the canonical encoding of the tx, the signature is not part of
+// it.  It fails if an amount is not an unsigned 256 bits integer.
+func (tx TransferTx) Encode() ([]byte, error) {
+	e := newEncoder(Transfer, transferTxBytes)
+	e.int(tx.AccountId)
+	e.int(tx.Nonce)
+	e.int(tx.ValidUntil)
+	e.int(tx.FeeToken)
+	e.amount("fee", tx.Fee)
+	e.address(tx.From)
+	e.address(tx.To)
+	e.int(tx.Token)
+	e.amount("amount", tx.Amount)
+	return e.buf, e.err
 }
 
-// EncodeBi Encode the transaction data as *big.Int by poseidon hash
-func (tx TransferTx) EncodeBi() *big.Int {
-	var out []*big.Int
+// GetBytes returns the canonical encoding of the tx.
+func (tx TransferTx) GetBytes() []byte {
+	b, err := tx.Encode()
+	if err != nil {
+		return nonCanonicalBytes(Transfer, tx)
+	}
+	return b
+}
+
+// DecodeTransferTx decodes a TransferTx from its canonical encoding, the
+// signature is left empty.
+func DecodeTransferTx(b []byte) (TransferTx, error) {
+	d, err := newDecoder(Transfer, b, transferTxBytes)
+	if err != nil {
+		return TransferTx{}, err
+	}
+	var tx TransferTx
+	tx.AccountId = d.int()
+	tx.Nonce = d.int()
+	tx.ValidUntil = d.int()
+	tx.FeeToken = d.int()
+	tx.Fee = d.amount()
+	tx.From = d.address()
+	tx.To = d.address()
+	tx.Token = d.int()
+	tx.Amount = d.amount()
+	return tx, nil
+}
+
+// EncodeBi Encode the transaction data as *big.Int by poseidon hash, this is the
+// message signed for the chain chainId.
+func (tx TransferTx) EncodeBi(chainId int) *big.Int {
+	out := sigPrefixBi(Transfer, chainId)
 	out = append(out, big.NewInt(int64(tx.AccountId)))
 	out = append(out, new(big.Int).SetBytes(tx.To.Bytes()))
 	out = append(out, big.NewInt(int64(tx.Token)))
@@ -57,3 +93,59 @@ func (tx TransferTx) EncodeBi() *big.Int {
 
 	return TransferHasher.HashBi(out)
 }
+
+// VerifySignature verifies the signature of the tx made by pubKey for the chain
+// chainId.
+func (tx TransferTx) VerifySignature(chainId int, pubKey *babyjub.PublicKey) error {
+	return pubKey.VerifyPoseidonStrict(tx.EncodeBi(chainId), &tx.Signature)
+}
+
+type transferTxJson struct {
+	AccountId  int
+	Nonce      int
+	ValidUntil int
+	FeeToken   int
+	Fee        jsonAmount
+	From       common.Address
+	To         common.Address
+	Token      int
+	Amount     jsonAmount
+	Signature  jsonSignature
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (tx TransferTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(transferTxJson{
+		AccountId:  tx.AccountId,
+		Nonce:      tx.Nonce,
+		ValidUntil: tx.ValidUntil,
+		FeeToken:   tx.FeeToken,
+		Fee:        jsonAmount{tx.Fee},
+		From:       tx.From,
+		To:         tx.To,
+		Token:      tx.Token,
+		Amount:     jsonAmount{tx.Amount},
+		Signature:  jsonSignature(tx.Signature),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (tx *TransferTx) UnmarshalJSON(data []byte) error {
+	var jtx transferTxJson
+	if err := decodeStrict(data, &jtx); err != nil {
+		return err
+	}
+	*tx = TransferTx{
+		AccountId:  jtx.AccountId,
+		Nonce:      jtx.Nonce,
+		ValidUntil: jtx.ValidUntil,
+		FeeToken:   jtx.FeeToken,
+		Fee:        jtx.Fee.Int,
+		From:       jtx.From,
+		To:         jtx.To,
+		Token:      jtx.Token,
+		Amount:     jtx.Amount.Int,
+		Signature:  babyjub.Signature(jtx.Signature),
+	}
+	return nil
+}
@@ -3,7 +3,6 @@ package transaction
 
 import (
 	"crypto/sha256"
-	"strconv"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -16,13 +15,18 @@ const (
 	Withdraw     TxType = "Withdraw"
 	Transfer     TxType = "Transfer"
 	PubKeyUpdate TxType = "PubKeyUpdate"
+	Batch        TxType = "Batch"
+	ForcedExit   TxType = "ForcedExit"
+	Swap         TxType = "Swap"
+	MintNFT      TxType = "MintNFT"
 )
 
 // ZionTx is the L2 transaction(transfer, pubkey update, withdraw) init from user directly.
 type ZionTx interface {
 	isZionTx()
 
-	// GetBytes Encode the transaction data as the byte sequence according to zion protocol.
+	// GetBytes Encode the transaction data as the canonical byte sequence according to zion
+	// protocol.
 	GetBytes() []byte
 
 	// // AuxData will return the auxiliary data of this specific transaction.
@@ -34,7 +38,7 @@ func ZionTxHash(tx ZionTx) common.Hash {
 	return sha256.Sum256(txBytes)
 }
 
-// ZionPriTx is the transaction init from contract(only include deposit now).
+// ZionPriTx is the transaction init from contract(deposit and full exit).
 type ZionPriTx interface {
 	// flag function
 	isZionPriTx()
@@ -58,18 +62,11 @@ func PriTxHash(tx PriorityTx) common.Hash {
 
 func (ptx PriorityTx) isZionPriTx() {}
 
-// GetBytes will return the bytes that consist of the tx layer info.
-func (ptx PriorityTx) GetBytes() (out []byte) {
-	out = append(out, ptx.L1Hash.Bytes()...)
-	out = append(out, IntToBytes(ptx.L1Block)...)
-	out = append(out, IntToBytes(ptx.L1BlockIndex)...)
-	return
-}
-
-type Integer interface {
-	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
-}
-
-func IntToBytes[T Integer](i T) []byte {
-	return []byte(strconv.Itoa(int(i)))
+// GetBytes will return the bytes that consist of the tx layer info, in fixed width.
+func (ptx PriorityTx) GetBytes() []byte {
+	e := &encoder{}
+	e.hash(ptx.L1Hash)
+	e.int(ptx.L1Block)
+	e.int(ptx.L1BlockIndex)
+	return e.buf
 }
@@ -1,16 +1,18 @@
 package transaction
 
 import (
+	"encoding/json"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 
 	"github.com/vivijj/ziongo/crypto/babyjub"
-	"github.com/vivijj/ziongo/crypto/poseidon"
+	"github.com/vivijj/ziongo/utils/hasher"
 )
 
 var (
-	withdrawHasher = poseidon.NewHasher(9)
+	withdrawHasher = hasher.NewPoseidonHasher(12)
 )
 
 // WithdrawTx  perform a withdrawal of funds from L2 account to L1 account
@@ -34,10 +36,13 @@ type WithdrawTx struct {
 
 func (tx WithdrawTx) isZionTx() {}
 
-// EncodeBi Encode the transaction data as the *big.Int by using poseidon hash
-func (tx WithdrawTx) EncodeBi() *big.Int {
-	var out []*big.Int
+// EncodeBi Encode the transaction data as the *big.Int by using poseidon hash, this
+// is the message signed for the chain chainId. It commits to the L1 recipient To,
+// so a relayer can't redirect the withdrawal.
+func (tx WithdrawTx) EncodeBi(chainId int) *big.Int {
+	out := sigPrefixBi(Withdraw, chainId)
 	out = append(out, big.NewInt(int64(tx.AccountId)))
+	out = append(out, new(big.Int).SetBytes(tx.To.Bytes()))
 	out = append(out, big.NewInt(int64(tx.Token)))
 	out = append(out, tx.Amount)
 	out = append(out, big.NewInt(int64(tx.FeeToken)))
@@ -49,18 +54,125 @@ func (tx WithdrawTx) EncodeBi() *big.Int {
 	return withdrawHasher.HashBi(out)
 }
 
-// GetBytes Encode the transaction data as the byte sequence
-func (tx WithdrawTx) GetBytes() (out []byte) {
-
-	out = append(out, []byte(Withdraw)...)
-	out = append(out, IntToBytes(tx.AccountId)...)
-	out = append(out, IntToBytes(tx.Nonce)...)
-	out = append(out, IntToBytes(tx.ValidUntil)...)
-	out = append(out, IntToBytes(tx.FeeToken)...)
-	out = append(out, tx.Fee.Bytes()...)
-	out = append(out, tx.From.Bytes()...)
-	out = append(out, tx.To.Bytes()...)
-	out = append(out, IntToBytes(tx.Token)...)
-	out = append(out, tx.Amount.Bytes()...)
-	return
+// VerifySignature verifies the signature of the tx made by pubKey for the chain
+// chainId.
+func (tx WithdrawTx) VerifySignature(chainId int, pubKey *babyjub.PublicKey) error {
+	return pubKey.VerifyPoseidonStrict(tx.EncodeBi(chainId), &tx.Signature)
+}
+
+// withdrawTxBytes is the size of the canonical encoding of a WithdrawTx (without
+// the version and type bytes).
+const withdrawTxBytes = 5*intBytes + 3*amountBytes + 2*addressBytes + hashBytes
+
+// Encode returns the canonical encoding of the tx.  The signature and the
+// ExtraData, which is committed by the OnchainDataHash, are not part of it.
+// It fails if an amount is not an unsigned 256 bits integer.
+func (tx WithdrawTx) Encode() ([]byte, error) {
+	e := newEncoder(Withdraw, withdrawTxBytes)
+	e.int(tx.AccountId)
+	e.int(tx.Nonce)
+	e.int(tx.ValidUntil)
+	e.int(tx.FeeToken)
+	e.amount("fee", tx.Fee)
+	e.address(tx.From)
+	e.address(tx.To)
+	e.int(tx.Token)
+	e.amount("amount", tx.Amount)
+	if tx.MinGas != nil {
+		e.amount("min gas", tx.MinGas)
+	} else {
+		e.amount("min gas", big.NewInt(0))
+	}
+	e.hash(tx.OnchainDataHash)
+	return e.buf, e.err
+}
+
+// GetBytes returns the canonical encoding of the tx.
+func (tx WithdrawTx) GetBytes() []byte {
+	b, err := tx.Encode()
+	if err != nil {
+		return nonCanonicalBytes(Withdraw, tx)
+	}
+	return b
+}
+
+// DecodeWithdrawTx decodes a WithdrawTx from its canonical encoding, the
+// signature and the ExtraData are left empty.
+func DecodeWithdrawTx(b []byte) (WithdrawTx, error) {
+	d, err := newDecoder(Withdraw, b, withdrawTxBytes)
+	if err != nil {
+		return WithdrawTx{}, err
+	}
+	var tx WithdrawTx
+	tx.AccountId = d.int()
+	tx.Nonce = d.int()
+	tx.ValidUntil = d.int()
+	tx.FeeToken = d.int()
+	tx.Fee = d.amount()
+	tx.From = d.address()
+	tx.To = d.address()
+	tx.Token = d.int()
+	tx.Amount = d.amount()
+	tx.MinGas = d.amount()
+	tx.OnchainDataHash = d.hash()
+	return tx, nil
+}
+
+type withdrawTxJson struct {
+	AccountId       int
+	Nonce           int
+	ValidUntil      int
+	FeeToken        int
+	Fee             jsonAmount
+	From            common.Address
+	To              common.Address
+	Token           int
+	Amount          jsonAmount
+	Signature       jsonSignature
+	MinGas          jsonAmount
+	ExtraData       hexutil.Bytes
+	OnchainDataHash common.Hash
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (tx WithdrawTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(withdrawTxJson{
+		AccountId:       tx.AccountId,
+		Nonce:           tx.Nonce,
+		ValidUntil:      tx.ValidUntil,
+		FeeToken:        tx.FeeToken,
+		Fee:             jsonAmount{tx.Fee},
+		From:            tx.From,
+		To:              tx.To,
+		Token:           tx.Token,
+		Amount:          jsonAmount{tx.Amount},
+		Signature:       jsonSignature(tx.Signature),
+		MinGas:          jsonAmount{tx.MinGas},
+		ExtraData:       tx.ExtraData,
+		OnchainDataHash: tx.OnchainDataHash,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (tx *WithdrawTx) UnmarshalJSON(data []byte) error {
+	var jtx withdrawTxJson
+	if err := decodeStrict(data, &jtx); err != nil {
+		return err
+	}
+	*tx = WithdrawTx{
+		AccountId:       jtx.AccountId,
+		Nonce:           jtx.Nonce,
+		ValidUntil:      jtx.ValidUntil,
+		FeeToken:        jtx.FeeToken,
+		Fee:             jtx.Fee.Int,
+		From:            jtx.From,
+		To:              jtx.To,
+		Token:           jtx.Token,
+		Amount:          jtx.Amount.Int,
+		Signature:       babyjub.Signature(jtx.Signature),
+		MinGas:          jtx.MinGas.Int,
+		ExtraData:       jtx.ExtraData,
+		OnchainDataHash: jtx.OnchainDataHash,
+	}
+	return nil
 }
@@ -85,3 +85,19 @@ type TxWitness struct {
 type NoopWitness struct {
 	TxType string
 }
+
+// SwapWitness is the combined witness of a swap: the balances of both tokens of
+// the accounts of both orders, and the fee paid by the submitter.
+type SwapWitness struct {
+	SignatureSubmitter *babyjub.Signature
+	SignatureOrders    [2]*babyjub.Signature
+	AccountMerkleRoot  string
+
+	// BalanceUpdateSell[i] and BalanceUpdateBuy[i] are the balances of the tokens
+	// sold and bought by the account of the order i.
+	BalanceUpdateSell [2]BalanceUpdateWitness
+	BalanceUpdateBuy  [2]BalanceUpdateWitness
+
+	BalanceUpdateFee      BalanceUpdateWitness
+	BalanceUpdateOperator BalanceUpdateWitness
+}
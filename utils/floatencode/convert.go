@@ -16,18 +16,50 @@ var (
 	Float8Encoding  = FloatEncoding{5, 3, 10}
 )
 
-func ToFloat(value *big.Int, floatEncoding FloatEncoding) int64 {
-	ebase := big.NewInt(floatEncoding.ExponentBase)
+type EncodeError struct{ msg string }
 
-	maxPower := big.NewInt(1<<floatEncoding.NumBitsExponent - 1)
-	maxMantissa := big.NewInt(1<<floatEncoding.NumBitsMantissa - 1)
-	maxExponent := new(big.Int).Exp(ebase, maxPower, nil)
-	maxValue := new(big.Int).Mul(maxMantissa, maxExponent)
+func (err EncodeError) Error() string {
+	return err.msg
+}
 
-	if value.Cmp(maxValue) == 1 {
-		panic("value too large")
+var (
+	ErrNilValue      = &EncodeError{"value is nil"}
+	ErrNegativeValue = &EncodeError{"value is negative"}
+	ErrValueTooLarge = &EncodeError{"value too large"}
+	ErrInvalidFloat  = &EncodeError{"float is out of the encoding range"}
+)
+
+// maxValue returns the biggest value that the encoding can represent.
+func (e FloatEncoding) maxValue() *big.Int {
+	maxMantissa := big.NewInt(1<<e.NumBitsMantissa - 1)
+	maxExponent := new(big.Int).Exp(big.NewInt(e.ExponentBase), big.NewInt(1<<e.NumBitsExponent-1), nil)
+	return maxMantissa.Mul(maxMantissa, maxExponent)
+}
+
+// ToFloat is like TryToFloat, but panics if the value can't be encoded.
+func ToFloat(value *big.Int, floatEncoding FloatEncoding) int64 {
+	f, err := TryToFloat(value, floatEncoding)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// TryToFloat encodes the value, rounded down to the closest float, it fails if the
+// value is negative or bigger than the max value of the encoding.
+func TryToFloat(value *big.Int, floatEncoding FloatEncoding) (int64, error) {
+	if value == nil {
+		return 0, ErrNilValue
+	}
+	if value.Sign() < 0 {
+		return 0, ErrNegativeValue
+	}
+	if value.Cmp(floatEncoding.maxValue()) == 1 {
+		return 0, ErrValueTooLarge
 	}
 
+	ebase := big.NewInt(floatEncoding.ExponentBase)
+	maxMantissa := big.NewInt(1<<floatEncoding.NumBitsMantissa - 1)
 	exponent := 0
 	r := new(big.Int).Div(value, maxMantissa)
 	d := big.NewInt(1)
@@ -38,14 +70,11 @@ func ToFloat(value *big.Int, floatEncoding FloatEncoding) int64 {
 	}
 	mantissa := big.NewInt(0).Div(value, d)
 
-	if maxExponent.Cmp(big.NewInt(int64(exponent))) < 0 {
-		panic("exponent too large.")
-	}
-	if mantissa.Cmp(maxMantissa) > 0 {
-		panic("mantissa too large.")
+	if int64(exponent) > 1<<floatEncoding.NumBitsExponent-1 || mantissa.Cmp(maxMantissa) > 0 {
+		return 0, ErrValueTooLarge
 	}
 	f := int64(exponent<<floatEncoding.NumBitsMantissa) + mantissa.Int64()
-	return f
+	return f, nil
 }
 
 func FromFloat(f int64, floatEncoding FloatEncoding) *big.Int {
@@ -59,8 +88,43 @@ func FromFloat(f int64, floatEncoding FloatEncoding) *big.Int {
 
 }
 
+// TryFromFloat is like FromFloat, but it fails if f doesn't fit in the bits of the
+// encoding.
+func TryFromFloat(f int64, floatEncoding FloatEncoding) (*big.Int, error) {
+	if f < 0 || f >= 1<<(floatEncoding.NumBitsExponent+floatEncoding.NumBitsMantissa) {
+		return nil, ErrInvalidFloat
+	}
+	return FromFloat(f, floatEncoding), nil
+}
+
 func RoundToFloatValue(value *big.Int, encoding FloatEncoding) *big.Int {
 	f := ToFloat(value, encoding)
 	floatValue := FromFloat(f, encoding)
 	return floatValue
 }
+
+// IsPackable reports whether the value is encoded without any loss, that is the
+// RoundToFloatValue of the value is the value itself.
+func IsPackable(value *big.Int, encoding FloatEncoding) bool {
+	f, err := TryToFloat(value, encoding)
+	if err != nil {
+		return false
+	}
+	return FromFloat(f, encoding).Cmp(value) == 0
+}
+
+// RoundUpToFloatValue returns the smallest value of the encoding which is not
+// lower than value, e.g. to round a required fee up to a packable fee.
+func RoundUpToFloatValue(value *big.Int, encoding FloatEncoding) (*big.Int, error) {
+	f, err := TryToFloat(value, encoding)
+	if err != nil {
+		return nil, err
+	}
+	rounded := FromFloat(f, encoding)
+	if rounded.Cmp(value) == 0 {
+		return rounded, nil
+	}
+	// TryToFloat uses the smallest exponent whose max mantissa is enough for value,
+	// so the mantissa rounded down is lower than the max and can be incremented.
+	return FromFloat(f+1, encoding), nil
+}
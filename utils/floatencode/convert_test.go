@@ -4,10 +4,72 @@ import (
 	"fmt"
 	"math/big"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRoundToFloatValue(t *testing.T) {
 	tv, _ := new(big.Int).SetString("1000000000000000000000000000000000000000000", 10)
-	rtv := RoundToFloatValue(tv, Float8Encoding)
+	assert.Panics(t, func() { RoundToFloatValue(tv, Float8Encoding) })
+	rtv := RoundToFloatValue(new(big.Int).Div(tv, big.NewInt(1e10)), Float28Encoding)
 	fmt.Println(rtv)
 }
+
+func TestIsPackable(t *testing.T) {
+	assert.True(t, IsPackable(big.NewInt(0), Float16Encoding))
+	assert.True(t, IsPackable(big.NewInt(2047), Float16Encoding))
+	assert.True(t, IsPackable(big.NewInt(2047000), Float16Encoding))
+	assert.False(t, IsPackable(big.NewInt(2049), Float16Encoding))
+	assert.False(t, IsPackable(big.NewInt(-1), Float16Encoding))
+	assert.False(t, IsPackable(nil, Float16Encoding))
+
+	maxValue := Float16Encoding.maxValue()
+	assert.True(t, IsPackable(maxValue, Float16Encoding))
+	assert.False(t, IsPackable(new(big.Int).Add(maxValue, big.NewInt(1)), Float16Encoding))
+}
+
+func TestTryToFloat(t *testing.T) {
+	tooLarge := new(big.Int).Add(Float8Encoding.maxValue(), big.NewInt(1))
+	_, err := TryToFloat(tooLarge, Float8Encoding)
+	assert.Equal(t, ErrValueTooLarge, err)
+	assert.Panics(t, func() { ToFloat(tooLarge, Float8Encoding) })
+
+	_, err = TryToFloat(big.NewInt(-5), Float8Encoding)
+	assert.Equal(t, ErrNegativeValue, err)
+
+	f, err := TryToFloat(big.NewInt(123456000), Float24Encoding)
+	require.NoError(t, err)
+	v, err := TryFromFloat(f, Float24Encoding)
+	require.NoError(t, err)
+	assert.Equal(t, int64(123456000), v.Int64())
+
+	_, err = TryFromFloat(1<<24, Float24Encoding)
+	assert.Equal(t, ErrInvalidFloat, err)
+	_, err = TryFromFloat(-1, Float24Encoding)
+	assert.Equal(t, ErrInvalidFloat, err)
+}
+
+func TestRoundUpToFloatValue(t *testing.T) {
+	for _, c := range []struct{ value, want int64 }{
+		{0, 0},
+		{2047, 2047},
+		{2048, 2050},
+		{2049, 2050},
+		{12345, 12350},
+		{20469, 20470},
+		{20471, 20500},
+		{2047001, 2050000},
+	} {
+		up, err := RoundUpToFloatValue(big.NewInt(c.value), Float16Encoding)
+		require.NoError(t, err)
+		assert.Equal(t, c.want, up.Int64(), "value %d", c.value)
+		assert.True(t, IsPackable(up, Float16Encoding))
+	}
+
+	maxValue := Float16Encoding.maxValue()
+	_, err := RoundUpToFloatValue(new(big.Int).Sub(maxValue, big.NewInt(1)), Float16Encoding)
+	assert.NoError(t, err)
+	_, err = RoundUpToFloatValue(new(big.Int).Add(maxValue, big.NewInt(1)), Float16Encoding)
+	assert.Equal(t, ErrValueTooLarge, err)
+}
@@ -24,7 +24,7 @@ func (h *PoseidonHasher) HashBi(inputBi []*big.Int) *big.Int {
 
 func (h *PoseidonHasher) HashFrRepr(frs []fr.Repr) fr.Repr {
 	bis := make([]*big.Int, 0, len(frs))
-	for i := 0; i < len(bis); i++ {
+	for i := 0; i < len(frs); i++ {
 		bis = append(bis, frs[i].ToBigInt())
 	}
 	resBi := h.HashBi(bis)
@@ -0,0 +1,18 @@
+package hasher
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vivijj/ziongo/types/fr"
+)
+
+func TestHashFrRepr(t *testing.T) {
+	h := NewPoseidonHasher(3)
+	frs := []fr.Repr{fr.FromInt(1), fr.FromInt(2)}
+	want := h.HashBi([]*big.Int{big.NewInt(1), big.NewInt(2)})
+	assert.Equal(t, fr.FromBigInt(want), h.HashFrRepr(frs))
+	// every input must take part in the hash.
+	assert.NotEqual(t, h.HashFrRepr(frs), h.HashFrRepr([]fr.Repr{fr.FromInt(1), fr.FromInt(3)}))
+}